@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 	"errors"
+	"expvar"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -28,11 +29,12 @@ import (
 )
 
 type App struct {
-	log        *slog.Logger
-	cfg        *config.Config
-	httpServer *http.Server
-	pool       *pgxpool.Pool
-	redis      *redis.Client
+	log            *slog.Logger
+	cfg            *config.Config
+	httpServer     *http.Server
+	internalServer *http.Server // nil if disabled
+	pool           *pgxpool.Pool
+	redis          *redis.Client
 }
 
 func New(log *slog.Logger, cfg *config.Config) *App {
@@ -67,27 +69,120 @@ func New(log *slog.Logger, cfg *config.Config) *App {
 
 	// 4. Init Layers
 	repo := pgdb.New(pool)
-	fileService := service.NewFileService(minioClient, cfg.MinIO.Bucket, cfg.MinIO.Endpoint)
+	fileService := service.NewFileService(
+		minioClient, cfg.MinIO.Bucket, cfg.MinIO.Endpoint,
+		repo, pool, cfg.Storage.UserQuota,
+	)
 
 	userService := service.NewUserService(repo, cfg.TokenSecret)
-	userHandler := handler.NewUserHandler(userService, cfg.TokenSecret, rdb, fileService)
+	userService.SetTokenTTL(cfg.Auth)
+	if cfg.Auth.KeysDir != "" {
+		keys, err := service.LoadKeySet(cfg.Auth)
+		if err != nil {
+			panic(fmt.Errorf("failed to load signing keys: %w", err))
+		}
+		userService.SetKeySet(keys)
+	} else {
+		log.Warn("access tokens are signed with token_secret, set auth.keys_dir to publish a JWKS")
+	}
+
+	var mailer service.Mailer
+	if cfg.Mail.SMTPAddress != "" {
+		mailer, err = service.NewSMTPMailer(cfg.Mail)
+	} else {
+		log.Warn("no smtp server configured, emails go to the outbox directory", "dir", cfg.Mail.OutboxDir)
+		mailer, err = service.NewFileMailer(cfg.Mail)
+	}
+	if err != nil {
+		panic(fmt.Errorf("failed to init mailer: %w", err))
+	}
+	userService.SetMailer(mailer, cfg.Mail.LinkBaseURL)
+
+	limiter := service.NewRateLimiter(rdb)
+	rateLimit := func(name, rate string) func(http.Handler) http.Handler {
+		if !cfg.RateLimit.Enabled {
+			return func(next http.Handler) http.Handler { return next }
+		}
+		parsed, err := service.ParseRate(rate)
+		if err != nil {
+			panic(fmt.Errorf("invalid rate_limit.%s: %w", name, err))
+		}
+		return handler.RateLimit(limiter, name, parsed)
+	}
+	if cfg.RateLimit.Enabled {
+		userService.SetLoginGuard(service.NewLoginGuard(
+			rdb, cfg.RateLimit.LockoutThreshold, cfg.RateLimit.LockoutBase, cfg.RateLimit.LockoutMax,
+		))
+	}
+
+	revocationService := service.NewRevocationService(rdb, cfg.Auth)
+	userService.SetRevocations(revocationService)
+	go userService.RunSessionCleanup(time.Hour)
+	userHandler := handler.NewUserHandler(userService, rdb, fileService)
+
+	oidcService, err := service.NewOIDCService(rdb, userService, cfg.OIDC)
+	if err != nil {
+		panic(fmt.Errorf("invalid oidc config: %w", err))
+	}
+	oidcHandler := handler.NewOIDCHandler(oidcService)
 
 	chatService := service.NewChatService(repo, pool)
 	chatHandler := handler.NewChatHandler(chatService, userService)
 
+	contactService := service.NewContactService(repo, pool)
+	contactHandler := handler.NewContactHandler(contactService, rdb)
+
+	uploadService := service.NewUploadService(repo, pool, fileService, cfg.Uploads)
+	uploadHandler := handler.NewUploadHandler(uploadService)
+	go uploadService.RunCleanup(time.Hour)
+
+	voiceService := service.NewVoiceService(repo, fileService)
+	voiceHandler := handler.NewVoiceHandler(voiceService)
+
+	gc := service.NewGarbageCollector(repo, pool, fileService, cfg.GC)
+	go gc.Run()
+
 	hub := ws.NewHub(repo, rdb)
+	hub.SetPresenceDebounce(cfg.WebSocket.PresenceDebounce)
 	go hub.Run()
+	go hub.WatchRevocations(revocationService.Subscribe(context.Background()))
+	chatService.OnSettingsChanged(hub.NotifyChatSettings)
+	chatService.OnDraftChanged(hub.NotifyDraft)
+	chatService.OnPinChanged(hub.NotifyPin)
+
+	if cfg.Scanner.ClamAVAddress != "" {
+		scanner := service.NewClamAVScanner(cfg.Scanner.ClamAVAddress, cfg.Scanner.Timeout)
+		scanService := service.NewScanService(repo, fileService, scanner, cfg.Scanner)
+		scanService.OnScanned(hub.NotifyFileScanned)
+		fileService.SetScanQueue(scanService)
+		go scanService.Run()
+	} else {
+		log.Warn("malware scanning is disabled")
+	}
 
-	wsHandler := ws.NewWSHandler(hub)
+	ticketService := service.NewTicketService(rdb, revocationService)
+	wsHandler := ws.NewWSHandler(hub, ticketService)
+	wsLimits, err := ws.NewLimits(cfg.WebSocket)
+	if err != nil {
+		panic(fmt.Errorf("invalid websocket config: %w", err))
+	}
+	wsHandler.SetLimits(wsLimits)
 
 	// 5. Router
 	router := chi.NewRouter()
 
 	router.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000", "http://localhost:8082"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedOrigins: []string{"http://localhost:3000", "http://localhost:8082"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+		AllowedHeaders: []string{
+			"Accept", "Authorization", "Content-Type", "X-CSRF-Token",
+			"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata",
+		},
+		ExposedHeaders: []string{
+			"Link", "Location", "Retry-After",
+			"Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+			"Upload-Offset", "Upload-Length", "Upload-Expires", "Upload-Part-Size", "X-File-Id",
+		},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -96,21 +191,86 @@ func New(log *slog.Logger, cfg *config.Config) *App {
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 
+	router.Get("/.well-known/jwks.json", userHandler.JWKS)
+
 	router.Route("/api", func(r chi.Router) {
-		r.Post("/users/register", userHandler.Register)
-		r.Post("/users/login", userHandler.Login)
+		emailLinks := rateLimit("email_links", cfg.RateLimit.EmailLinks)
+		r.With(rateLimit("register", cfg.RateLimit.Register)).Post("/users/register", userHandler.Register)
+		r.With(rateLimit("login", cfg.RateLimit.Login)).Post("/users/login", userHandler.Login)
+		r.With(rateLimit("login_2fa", cfg.RateLimit.LoginTwoFactor)).Post("/users/login/2fa", userHandler.LoginTwoFactor)
+		r.With(emailLinks).Post("/users/verify-email", userHandler.VerifyEmail)
+		r.With(rateLimit("forgot_password", cfg.RateLimit.ForgotPassword)).Post("/users/password/forgot", userHandler.ForgotPassword)
+		r.With(emailLinks).Post("/users/password/reset", userHandler.ResetPassword)
+		r.With(emailLinks).Post("/users/email/confirm", userHandler.ConfirmEmailChange)
+		r.With(rateLimit("refresh", cfg.RateLimit.Refresh)).Post("/auth/refresh", userHandler.Refresh)
+		r.Get("/auth/oidc", oidcHandler.ListProviders)
+		r.With(rateLimit("login", cfg.RateLimit.Login)).Get("/auth/oidc/{provider}/login", oidcHandler.Login)
+		r.With(rateLimit("login", cfg.RateLimit.Login)).Get("/auth/oidc/{provider}/callback", oidcHandler.Callback)
+		r.Post("/auth/logout", userHandler.Logout)
+		r.Options("/uploads", uploadHandler.Options)
+		r.Get("/ws", wsHandler.HandleWS)
 
 		r.Group(func(r chi.Router) {
 			r.Use(userHandler.AuthMiddleware)
 
 			r.Get("/users/me", userHandler.GetMe)
+			r.Patch("/users/me", userHandler.UpdateMe)
+			r.Delete("/users/me", userHandler.DeleteMe)
+			r.Put("/users/me/password", userHandler.ChangePassword)
+			r.Post("/users/me/email", userHandler.ChangeEmail)
 			r.Post("/users/me/avatar", userHandler.UploadAvatar)
+			r.Get("/users/me/storage", userHandler.GetStorage)
+			r.Get("/users/me/privacy", userHandler.GetPrivacy)
+			r.Patch("/users/me/privacy", userHandler.UpdatePrivacy)
+			r.Get("/users/me/sessions", userHandler.ListSessions)
+			r.Delete("/users/me/sessions", userHandler.DeleteOtherSessions)
+			r.Delete("/users/me/sessions/{session_id}", userHandler.DeleteSession)
+			r.Post("/users/me/verify-email", userHandler.ResendVerification)
+			r.Get("/users/me/2fa", userHandler.GetTwoFactor)
+			r.Post("/users/me/2fa/setup", userHandler.SetupTwoFactor)
+			r.Post("/users/me/2fa/confirm", userHandler.ConfirmTwoFactor)
+			r.Post("/users/me/2fa/disable", userHandler.DisableTwoFactor)
+			r.Post("/users/me/2fa/recovery-codes", userHandler.RegenerateRecoveryCodes)
+			r.Get("/users/search", userHandler.SearchUsers)
+			r.Get("/users/{user_id}", userHandler.GetProfile)
 			r.Get("/users/{user_id}/status", userHandler.GetOnlineStatus)
 
+			r.Get("/chats", chatHandler.ListChats)
 			r.Post("/chats", chatHandler.CreateChat)
+			r.Put("/chats/pinned", chatHandler.ReorderPinned)
+			r.Get("/chats/{chat_id}/settings", chatHandler.GetSettings)
+			r.Patch("/chats/{chat_id}/settings", chatHandler.UpdateSettings)
+			r.Get("/chats/{chat_id}/draft", chatHandler.GetDraft)
+			r.Put("/chats/{chat_id}/draft", chatHandler.PutDraft)
+			r.Patch("/chats/{chat_id}", chatHandler.UpdateChat)
+			r.Get("/chats/{chat_id}/pins", chatHandler.ListPinned)
+			r.Post("/chats/{chat_id}/pins", chatHandler.PinMessage)
+			r.Delete("/chats/{chat_id}/pins/{message_id}", chatHandler.UnpinMessage)
+			r.Get("/folders", chatHandler.ListFolders)
+			r.Post("/folders", chatHandler.CreateFolder)
+			r.Patch("/folders/{folder_id}", chatHandler.UpdateFolder)
+			r.Delete("/folders/{folder_id}", chatHandler.DeleteFolder)
 			r.Get("/chats/{chat_id}/messages", chatHandler.GetMessages)
 
-			r.Get("/ws", wsHandler.HandleWS)
+			r.Get("/contacts", contactHandler.ListContacts)
+			r.Delete("/contacts/{user_id}", contactHandler.RemoveContact)
+			r.Get("/contacts/requests", contactHandler.ListRequests)
+			r.Post("/contacts/requests", contactHandler.SendRequest)
+			r.Delete("/contacts/requests/{user_id}", contactHandler.CancelRequest)
+			r.Post("/contacts/requests/{user_id}/accept", contactHandler.AcceptRequest)
+			r.Post("/contacts/requests/{user_id}/decline", contactHandler.DeclineRequest)
+			r.Get("/blocks", contactHandler.ListBlocked)
+			r.Post("/blocks", contactHandler.Block)
+			r.Delete("/blocks/{user_id}", contactHandler.Unblock)
+
+			r.Post("/uploads", uploadHandler.Create)
+			r.Head("/uploads/{upload_id}", uploadHandler.Head)
+			r.Patch("/uploads/{upload_id}", uploadHandler.Patch)
+			r.Delete("/uploads/{upload_id}", uploadHandler.Delete)
+			r.Post("/files/voice", voiceHandler.Upload)
+			r.Get("/files/{file_id}", uploadHandler.GetFile)
+
+			r.With(rateLimit("ws_ticket", cfg.RateLimit.WSTicket)).Post("/ws/ticket", wsHandler.IssueTicket)
 		})
 	})
 
@@ -118,6 +278,18 @@ func New(log *slog.Logger, cfg *config.Config) *App {
 	filesDir := http.Dir(filepath.Join(workDir, "static"))
 	FileServer(router, "/", filesDir)
 
+	// 6. Internal router, metrics of the GC and the like
+	var internalServer *http.Server
+	if cfg.HTTPServer.InternalAddress != "" {
+		internal := chi.NewRouter()
+		internal.Handle("/debug/vars", expvar.Handler())
+
+		internalServer = &http.Server{
+			Addr:    cfg.HTTPServer.InternalAddress,
+			Handler: internal,
+		}
+	}
+
 	return &App{
 		log:   log,
 		cfg:   cfg,
@@ -127,6 +299,7 @@ func New(log *slog.Logger, cfg *config.Config) *App {
 			Addr:    cfg.HTTPServer.Address,
 			Handler: router,
 		},
+		internalServer: internalServer,
 	}
 }
 
@@ -141,6 +314,16 @@ func (a *App) Run() {
 		}
 	}()
 
+	if a.internalServer != nil {
+		go func() {
+			a.log.Info("internal server starting", slog.String("address", a.internalServer.Addr))
+			if err := a.internalServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				a.log.Error("failed to start internal server", slog.String("op", op), slog.String("error", err.Error()))
+				os.Exit(1)
+			}
+		}()
+	}
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
@@ -155,10 +338,15 @@ func (a *App) Stop() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// 1. Stop HTTP-server
+	// 1. Stop HTTP-servers
 	if err := a.httpServer.Shutdown(ctx); err != nil {
 		a.log.Error("failed to stop server gracefully", slog.String("op", op), slog.String("error", err.Error()))
 	}
+	if a.internalServer != nil {
+		if err := a.internalServer.Shutdown(ctx); err != nil {
+			a.log.Error("failed to stop internal server gracefully", slog.String("op", op), slog.String("error", err.Error()))
+		}
+	}
 
 	// 2. Close DB
 	a.log.Info("closing database connection")
@@ -15,15 +15,46 @@ type Config struct {
 	TokenSecret string `yaml:"token_secret" env-default:"super-secret-key-change-me"`
 
 	HTTPServer `yaml:"http_server"`
+	Auth       `yaml:"auth"`
 	Database   `yaml:"database"`
 	Redis      `yaml:"redis"`
 	MinIO      `yaml:"minio"`
+	Uploads    `yaml:"uploads"`
+	Storage    `yaml:"storage"`
+	GC         `yaml:"gc"`
+	Scanner    `yaml:"scanner"`
+	Mail       `yaml:"mail"`
+	RateLimit  `yaml:"rate_limit"`
+	WebSocket  `yaml:"websocket"`
+
+	OIDC []OIDCProvider `yaml:"oidc_providers"`
 }
 
+// HTTPServer - InternalAddress serves expvar metrics at /debug/vars, keep it
+// unreachable from outside. Empty disables it.
 type HTTPServer struct {
-	Address     string        `yaml:"address" env-default:"localhost:8080"`
-	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
-	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	Address         string        `yaml:"address" env-default:"localhost:8080"`
+	InternalAddress string        `yaml:"internal_address" env-default:""`
+	Timeout         time.Duration `yaml:"timeout" env-default:"4s"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env-default:"60s"`
+}
+
+// Auth - access tokens are short-lived JWTs, sessions live as long as
+// their refresh token keeps being used.
+//
+// With KeysDir set tokens are signed with RS256/EdDSA keys instead of
+// token_secret. Every *.pem there is a key named by its file name: a private
+// key (PKCS#8 RSA or Ed25519, PKCS#1 RSA) or the public key of a retired one.
+// To rotate, put the new key on every instance, then switch SigningKey to it,
+// and drop the old one after access_ttl.
+type Auth struct {
+	AccessTTL  time.Duration `yaml:"access_ttl" env-default:"15m"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl" env-default:"720h"` // 30 days of inactivity
+	KeysDir    string        `yaml:"keys_dir" env-default:""`
+	SigningKey string        `yaml:"signing_key" env-default:""` // may be empty with a single private key
+
+	VerificationTTL  time.Duration `yaml:"verification_ttl" env-default:"48h"`
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl" env-default:"1h"`
 }
 
 type Database struct {
@@ -42,6 +73,93 @@ type MinIO struct {
 	UseSSL          bool   `yaml:"use_ssl" env-default:"false"`
 }
 
+type Uploads struct {
+	MaxSize  int64         `yaml:"max_size" env-default:"2147483648"` // 2 GiB
+	PartSize int64         `yaml:"part_size" env-default:"5242880"`   // 5 MiB, minimum allowed by S3 multipart
+	TTL      time.Duration `yaml:"ttl" env-default:"24h"`
+}
+
+type Storage struct {
+	UserQuota int64 `yaml:"user_quota" env-default:"1073741824"` // 1 GiB per user
+}
+
+// GC - orphaned object collection. Unreferenced files are kept for
+// GracePeriod, so a just uploaded attachment can still be sent.
+type GC struct {
+	Interval    time.Duration `yaml:"interval" env-default:"1h"`
+	GracePeriod time.Duration `yaml:"grace_period" env-default:"24h"`
+	DryRun      bool          `yaml:"dry_run" env-default:"false"`
+}
+
+// Scanner - malware scanning of uploaded files. With an empty ClamAVAddress
+// scanning is off and files are available right away. clamd's StreamMaxLength
+// must not be below uploads.max_size, otherwise large files stay pending.
+type Scanner struct {
+	ClamAVAddress string        `yaml:"clamav_address" env-default:""`
+	Timeout       time.Duration `yaml:"timeout" env-default:"5m"`
+	Interval      time.Duration `yaml:"interval" env-default:"1m"` // retry of files left pending
+}
+
+// Mail - outgoing email. With an empty SMTPAddress emails are written to
+// OutboxDir instead. Links in emails point to LinkBaseURL, the frontend.
+type Mail struct {
+	SMTPAddress string `yaml:"smtp_address" env-default:""`
+	Username    string `yaml:"username" env-default:""`
+	Password    string `yaml:"password" env:"SMTP_PASSWORD" env-default:""`
+	From        string `yaml:"from" env-default:"Messenger <no-reply@localhost>"`
+	OutboxDir   string `yaml:"outbox_dir" env-default:"./outbox"`
+	LinkBaseURL string `yaml:"link_base_url" env-default:"http://localhost:8082"`
+}
+
+// RateLimit - per client IP limits of the public auth routes, per user of
+// the WebSocket tickets, written as "requests/window", e.g. "10/1m". After LockoutThreshold failed logins in a
+// row an account is locked for LockoutBase, doubling with every further
+// failure up to LockoutMax.
+type RateLimit struct {
+	Enabled        bool   `yaml:"enabled" env-default:"true"`
+	Register       string `yaml:"register" env-default:"5/1h"`
+	Login          string `yaml:"login" env-default:"20/1m"`
+	LoginTwoFactor string `yaml:"login_2fa" env-default:"20/1m"`
+	Refresh        string `yaml:"refresh" env-default:"60/1m"`
+	ForgotPassword string `yaml:"forgot_password" env-default:"5/1h"`
+	EmailLinks     string `yaml:"email_links" env-default:"20/1m"` // verify-email, password reset, email change
+	WSTicket       string `yaml:"ws_ticket" env-default:"30/1m"`   // per user
+
+	LockoutThreshold int           `yaml:"lockout_threshold" env-default:"5"`
+	LockoutBase      time.Duration `yaml:"lockout_base" env-default:"1m"`
+	LockoutMax       time.Duration `yaml:"lockout_max" env-default:"1h"`
+}
+
+// WebSocket - limits of what a user may send over all of their connections,
+// rates are written like in RateLimit. An event over a limit gets an error
+// frame back, after MaxViolations of those within a minute the connection
+// is closed.
+type WebSocket struct {
+	MaxFrameSize    int64         `yaml:"max_frame_size" env-default:"65536"`
+	MaxConnections  int           `yaml:"max_connections" env-default:"10"` // per user
+	MessageRate     string        `yaml:"message_rate" env-default:"20/10s"`
+	ChatMessageRate string        `yaml:"chat_message_rate" env-default:"10/10s"` // per chat
+	MarkReadRate    string        `yaml:"mark_read_rate" env-default:"30/10s"`
+	TypingInterval  time.Duration `yaml:"typing_interval" env-default:"3s"`
+	MaxViolations   int           `yaml:"max_violations" env-default:"10"`
+
+	// how long going online or offline must hold before contacts are told
+	PresenceDebounce time.Duration `yaml:"presence_debounce" env-default:"5s"`
+}
+
+// OIDCProvider - login through an OpenID Connect identity provider, with the
+// authorization code flow and PKCE. Endpoints are discovered from Issuer.
+// RedirectURL is /api/auth/oidc/{name}/callback of this server, as
+// registered at the provider. Unknown users are created on first login.
+type OIDCProvider struct {
+	Name         string   `yaml:"name"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"` // empty for public clients
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"` // openid email profile when empty
+}
+
 func MustLoad() *Config {
 	configPath := os.Getenv("CONFIG_PATH")
 
@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Adopten123/go-messenger/internal/service"
+)
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// ChangePasswordRequest - CurrentPassword stays empty for SSO accounts
+// setting their first password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangeEmailRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// VerifyEmail - POST /users/verify-email, the token comes from the emailed link
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.VerifyEmail(r.Context(), req.Token); err != nil {
+		if errors.Is(err, service.ErrInvalidEmailToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Error("failed to verify email", "error", err)
+		http.Error(w, "failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification - POST /users/me/verify-email
+func (h *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.ResendVerificationEmail(r.Context(), userID); err != nil {
+		if errors.Is(err, service.ErrEmailAlreadyVerified) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		slog.Error("failed to resend verification email", "error", err)
+		http.Error(w, "failed to send email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ForgotPassword - POST /users/password/forgot, 202 whether the email is registered or not
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RequestPasswordReset(r.Context(), req.Email); err != nil {
+		slog.Error("failed to request password reset", "error", err)
+		http.Error(w, "failed to send email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword - POST /users/password/reset, every session of the user ends
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || req.Password == "" {
+		http.Error(w, "token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
+		if errors.Is(err, service.ErrInvalidEmailToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Error("failed to reset password", "error", err)
+		http.Error(w, "failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePassword - PUT /users/me/password, other sessions of the user end
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+	currentID, _ := r.Context().Value(SessionIDKey).(string)
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.NewPassword == "" {
+		http.Error(w, "new_password is required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.service.ChangePassword(r.Context(), userID, currentID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, service.ErrWrongPassword) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		slog.Error("failed to change password", "error", err)
+		http.Error(w, "failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangeEmail - POST /users/me/email, the new address has to be confirmed
+func (h *UserHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+	if !validEmail(req.Email) {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.RequestEmailChange(r.Context(), userID, req.Password, req.Email); err != nil {
+		switch {
+		case errors.Is(err, service.ErrWrongPassword):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, service.ErrEmailTaken):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			slog.Error("failed to request email change", "error", err)
+			http.Error(w, "failed to send email", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ConfirmEmailChange - POST /users/email/confirm, the token comes from the emailed link
+func (h *UserHandler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.ConfirmEmailChange(r.Context(), req.Token); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidEmailToken):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, service.ErrEmailTaken):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			slog.Error("failed to change email", "error", err)
+			http.Error(w, "failed to change email", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteMe - DELETE /users/me, messages stay in the chats as from a deleted account
+func (h *UserHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.DeleteAccount(r.Context(), userID, req.Password); err != nil {
+		if errors.Is(err, service.ErrWrongPassword) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		slog.Error("failed to delete account", "error", err)
+		http.Error(w, "failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
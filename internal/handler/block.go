@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// ListBlocked - GET /blocks, users the current user blocked
+func (h *ContactHandler) ListBlocked(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	blocked, err := h.service.ListBlocked(r.Context(), userID)
+	if err != nil {
+		slog.Error("failed to list blocked users", "error", err)
+		http.Error(w, "failed to list blocked users", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]ContactResponse, 0, len(blocked))
+	for _, b := range blocked {
+		resp = append(resp, newContactResponse(b.ID, b.Username, b.DisplayName, b.AvatarUrl, b.CreatedAt))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Block - POST /blocks
+func (h *ContactHandler) Block(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req ContactRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.BlockUser(r.Context(), userID, req.UserID); err != nil {
+		writeContactError(w, err, "failed to block user")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unblock - DELETE /blocks/{user_id}
+func (h *ContactHandler) Unblock(w http.ResponseWriter, r *http.Request) {
+	h.do(w, r, h.service.UnblockUser, "failed to unblock user")
+}
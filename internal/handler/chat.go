@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -59,6 +60,14 @@ func (h *ChatHandler) CreateChat(w http.ResponseWriter, r *http.Request) {
 	// 3. Calling server
 	chat, err := h.service.CreateChat(r.Context(), req.Name, creatorID, req.UserIDs)
 	if err != nil {
+		if errors.Is(err, service.ErrContactsOnly) || errors.Is(err, service.ErrBlocked) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, service.ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "failed to create chat", http.StatusInternalServerError)
 		return
 	}
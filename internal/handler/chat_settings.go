@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ChatSettingsResponse - how a chat shows up for the current user
+type ChatSettingsResponse struct {
+	ChatID       string     `json:"chat_id"`
+	Muted        bool       `json:"muted"`
+	MutedUntil   *time.Time `json:"muted_until,omitempty"`
+	Archived     bool       `json:"archived"`
+	Pinned       bool       `json:"pinned"`
+	PinOrder     *int32     `json:"pin_order,omitempty"`
+	MarkedUnread bool       `json:"marked_unread"`
+}
+
+// NewChatSettingsResponse - a mute that ran out is no mute
+func NewChatSettingsResponse(member *pgdb.ChatMember) ChatSettingsResponse {
+	return newChatSettingsResponse(member.ChatID, member.MutedUntil, member.Archived, member.PinOrder, member.MarkedUnread)
+}
+
+func newChatSettingsResponse(chatID pgtype.UUID, mutedUntil pgtype.Timestamptz, archived bool, pinOrder pgtype.Int4, markedUnread bool) ChatSettingsResponse {
+	resp := ChatSettingsResponse{
+		ChatID:       chatID.String(),
+		Archived:     archived,
+		Pinned:       pinOrder.Valid,
+		MarkedUnread: markedUnread,
+	}
+	if mutedUntil.Valid && mutedUntil.Time.After(time.Now()) {
+		resp.Muted = true
+		resp.MutedUntil = &mutedUntil.Time
+	}
+	if pinOrder.Valid {
+		resp.PinOrder = &pinOrder.Int32
+	}
+	return resp
+}
+
+type ChatListItem struct {
+	ID             string               `json:"id"`
+	Name           string               `json:"name"`
+	IsGroup        bool                 `json:"is_group"`
+	CreatedAt      time.Time            `json:"created_at"`
+	LastActivityAt time.Time            `json:"last_activity_at"`
+	Settings       ChatSettingsResponse `json:"settings"`
+	Draft          *DraftResponse       `json:"draft,omitempty"`
+}
+
+// nullableTime - tells an absent field (leave as is) from null (clear it)
+type nullableTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+func (t *nullableTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	return json.Unmarshal(data, &t.Value)
+}
+
+// UpdateChatSettingsRequest - muted_until null unmutes, absent fields stay
+type UpdateChatSettingsRequest struct {
+	MutedUntil   nullableTime `json:"muted_until"`
+	Archived     *bool        `json:"archived"`
+	Pinned       *bool        `json:"pinned"`
+	MarkedUnread *bool        `json:"marked_unread"`
+}
+
+type ReorderPinnedRequest struct {
+	ChatIDs []string `json:"chat_ids"`
+}
+
+// ListChats - GET /chats, ?archived=true for the archive, ?folder_id= for
+// the chats of a folder
+func (h *ChatHandler) ListChats(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	archived := r.URL.Query().Get("archived") == "true"
+	folderID := r.URL.Query().Get("folder_id")
+
+	chats, err := h.service.ListChats(r.Context(), userID, archived, folderID)
+	if err != nil {
+		if errors.Is(err, service.ErrFolderNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to list chats", "error", err)
+		http.Error(w, "failed to list chats", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]ChatListItem, 0, len(chats))
+	for _, c := range chats {
+		item := ChatListItem{
+			ID:             c.ID.String(),
+			Name:           c.Name.String,
+			IsGroup:        c.IsGroup,
+			CreatedAt:      c.CreatedAt.Time,
+			LastActivityAt: c.LastActivityAt.Time,
+			Settings:       newChatSettingsResponse(c.ID, c.MutedUntil, c.Archived, c.PinOrder, c.MarkedUnread),
+		}
+		if c.Draft.Valid {
+			draft := newDraftResponse(c.ID, c.Draft, c.DraftUpdatedAt)
+			item.Draft = &draft
+		}
+		resp = append(resp, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetSettings - GET /chats/{chat_id}/settings
+func (h *ChatHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	member, err := h.service.GetSettings(r.Context(), userID, chi.URLParam(r, "chat_id"))
+	if err != nil {
+		writeChatSettingsError(w, err, "failed to get chat settings")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NewChatSettingsResponse(member))
+}
+
+// UpdateSettings - PATCH /chats/{chat_id}/settings
+func (h *ChatHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req UpdateChatSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	update := service.ChatSettingsUpdate{
+		Archived:     req.Archived,
+		Pinned:       req.Pinned,
+		MarkedUnread: req.MarkedUnread,
+	}
+	if req.MutedUntil.Set {
+		var mutedUntil pgtype.Timestamptz
+		if req.MutedUntil.Value != nil {
+			mutedUntil = pgtype.Timestamptz{Time: *req.MutedUntil.Value, Valid: true}
+		}
+		update.MutedUntil = &mutedUntil
+	}
+
+	member, err := h.service.UpdateSettings(r.Context(), userID, chi.URLParam(r, "chat_id"), update)
+	if err != nil {
+		writeChatSettingsError(w, err, "failed to update chat settings")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NewChatSettingsResponse(member))
+}
+
+// ReorderPinned - PUT /chats/pinned, the listed chats become the pinned ones
+// in this order
+func (h *ChatHandler) ReorderPinned(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req ReorderPinnedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	members, err := h.service.ReorderPinned(r.Context(), userID, req.ChatIDs)
+	if err != nil {
+		writeChatSettingsError(w, err, "failed to reorder pinned chats")
+		return
+	}
+
+	resp := make([]ChatSettingsResponse, 0, len(members))
+	for i := range members {
+		resp = append(resp, NewChatSettingsResponse(&members[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func writeChatSettingsError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrChatNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrTooManyPinned), errors.Is(err, service.ErrInvalidChatSettings):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		slog.Error(msg, "error", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+}
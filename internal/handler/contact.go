@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+)
+
+type ContactHandler struct {
+	service *service.ContactService
+	rdb     *redis.Client
+}
+
+func NewContactHandler(service *service.ContactService, rdb *redis.Client) *ContactHandler {
+	return &ContactHandler{
+		service: service,
+		rdb:     rdb,
+	}
+}
+
+type ContactRequestRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// ContactResponse - a contact or the other side of a request, since is when
+// the contact was added or the request was sent
+type ContactResponse struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Online      *bool  `json:"online,omitempty"`
+	Since       string `json:"since"`
+}
+
+type ContactRequestsResponse struct {
+	Incoming []ContactResponse `json:"incoming"`
+	Outgoing []ContactResponse `json:"outgoing"`
+}
+
+// ListContacts - GET /contacts
+func (h *ContactHandler) ListContacts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	contacts, err := h.service.ListContacts(r.Context(), userID)
+	if err != nil {
+		slog.Error("failed to list contacts", "error", err)
+		http.Error(w, "failed to list contacts", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]ContactResponse, 0, len(contacts))
+	var shown []int // contacts whose online state the user may see
+	for i, c := range contacts {
+		resp = append(resp, newContactResponse(c.ID, c.Username, c.DisplayName, c.AvatarUrl, c.CreatedAt))
+		if service.Visible(c.OnlineVisibility, true) {
+			shown = append(shown, i)
+		}
+	}
+
+	// online state is best effort, the list is still useful without it
+	if err := h.fillOnline(r.Context(), resp, shown); err != nil {
+		slog.Error("failed to get online state of contacts", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RemoveContact - DELETE /contacts/{user_id}
+func (h *ContactHandler) RemoveContact(w http.ResponseWriter, r *http.Request) {
+	h.do(w, r, h.service.RemoveContact, "failed to remove contact")
+}
+
+// ListRequests - GET /contacts/requests
+func (h *ContactHandler) ListRequests(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	requests, err := h.service.ListRequests(r.Context(), userID)
+	if err != nil {
+		slog.Error("failed to list contact requests", "error", err)
+		http.Error(w, "failed to list contact requests", http.StatusInternalServerError)
+		return
+	}
+
+	resp := ContactRequestsResponse{
+		Incoming: make([]ContactResponse, 0, len(requests.Incoming)),
+		Outgoing: make([]ContactResponse, 0, len(requests.Outgoing)),
+	}
+	for _, c := range requests.Incoming {
+		resp.Incoming = append(resp.Incoming, newContactResponse(c.ID, c.Username, c.DisplayName, c.AvatarUrl, c.CreatedAt))
+	}
+	for _, c := range requests.Outgoing {
+		resp.Outgoing = append(resp.Outgoing, newContactResponse(c.ID, c.Username, c.DisplayName, c.AvatarUrl, c.CreatedAt))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// SendRequest - POST /contacts/requests, 201 while pending, 200 when it
+// accepted a request the other user had sent
+func (h *ContactHandler) SendRequest(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req ContactRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	accepted, err := h.service.SendRequest(r.Context(), userID, req.UserID)
+	if err != nil {
+		writeContactError(w, err, "failed to send contact request")
+		return
+	}
+
+	status := "pending"
+	w.Header().Set("Content-Type", "application/json")
+	if accepted {
+		status = "accepted"
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+// AcceptRequest - POST /contacts/requests/{user_id}/accept
+func (h *ContactHandler) AcceptRequest(w http.ResponseWriter, r *http.Request) {
+	h.do(w, r, h.service.AcceptRequest, "failed to accept contact request")
+}
+
+// DeclineRequest - POST /contacts/requests/{user_id}/decline
+func (h *ContactHandler) DeclineRequest(w http.ResponseWriter, r *http.Request) {
+	h.do(w, r, h.service.DeclineRequest, "failed to decline contact request")
+}
+
+// CancelRequest - DELETE /contacts/requests/{user_id}
+func (h *ContactHandler) CancelRequest(w http.ResponseWriter, r *http.Request) {
+	h.do(w, r, h.service.CancelRequest, "failed to cancel contact request")
+}
+
+// do - runs an action of the user on {user_id}, 204 on success
+func (h *ContactHandler) do(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, userID, otherID string) error, failure string) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	if err := action(r.Context(), userID, chi.URLParam(r, "user_id")); err != nil {
+		writeContactError(w, err, failure)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fillOnline - sets the online state of the contacts at the shown indexes
+func (h *ContactHandler) fillOnline(ctx context.Context, contacts []ContactResponse, shown []int) error {
+	if h.rdb == nil || len(shown) == 0 {
+		return nil
+	}
+
+	pipe := h.rdb.Pipeline()
+	cmds := make([]*redis.IntCmd, len(shown))
+	for i, idx := range shown {
+		cmds[i] = pipe.Exists(ctx, "user:"+contacts[idx].ID+":online")
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	for i, cmd := range cmds {
+		online := cmd.Val() > 0
+		contacts[shown[i]].Online = &online
+	}
+	return nil
+}
+
+func newContactResponse(id pgtype.UUID, username string, displayName, avatarURL pgtype.Text, since pgtype.Timestamptz) ContactResponse {
+	return ContactResponse{
+		ID:          id.String(),
+		Username:    username,
+		DisplayName: displayName.String,
+		AvatarURL:   avatarURL.String,
+		Since:       since.Time.UTC().Format(time.RFC3339),
+	}
+}
+
+func writeContactError(w http.ResponseWriter, err error, failure string) {
+	switch {
+	case errors.Is(err, service.ErrContactSelf), errors.Is(err, service.ErrBlockSelf):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrBlocked):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrUserNotFound),
+		errors.Is(err, service.ErrContactNotFound),
+		errors.Is(err, service.ErrContactRequestNotFound),
+		errors.Is(err, service.ErrNotBlocked):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrAlreadyContacts):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		slog.Error(failure, "error", err)
+		http.Error(w, failure, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type DraftRequest struct {
+	Content string `json:"content"`
+}
+
+// DraftResponse - updated_at is missing for an empty draft
+type DraftResponse struct {
+	ChatID    string     `json:"chat_id"`
+	Content   string     `json:"content"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+func NewDraftResponse(draft *pgdb.ChatDraft) DraftResponse {
+	return newDraftResponse(draft.ChatID, pgtype.Text{String: draft.Content, Valid: true}, draft.UpdatedAt)
+}
+
+func newDraftResponse(chatID pgtype.UUID, content pgtype.Text, updatedAt pgtype.Timestamptz) DraftResponse {
+	resp := DraftResponse{
+		ChatID:  chatID.String(),
+		Content: content.String,
+	}
+	if updatedAt.Valid {
+		resp.UpdatedAt = &updatedAt.Time
+	}
+	return resp
+}
+
+// GetDraft - GET /chats/{chat_id}/draft
+func (h *ChatHandler) GetDraft(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	draft, err := h.service.GetDraft(r.Context(), userID, chi.URLParam(r, "chat_id"))
+	if err != nil {
+		writeChatSettingsError(w, err, "failed to get draft")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NewDraftResponse(draft))
+}
+
+// PutDraft - PUT /chats/{chat_id}/draft, empty content clears the draft
+func (h *ChatHandler) PutDraft(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+	// the device that saved the draft already has it
+	sessionID, _ := r.Context().Value(SessionIDKey).(string)
+
+	var req DraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	draft, err := h.service.SaveDraft(r.Context(), userID, sessionID, chi.URLParam(r, "chat_id"), req.Content)
+	if err != nil {
+		if errors.Is(err, service.ErrDraftTooLong) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		writeChatSettingsError(w, err, "failed to save draft")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NewDraftResponse(draft))
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// FolderRequest - absent fields stay as they are on PATCH, chat_ids replaces
+// the chats of the folder
+type FolderRequest struct {
+	Name         *string   `json:"name"`
+	ChatIDs      *[]string `json:"chat_ids"`
+	GroupsOnly   *bool     `json:"groups_only"`
+	UnreadOnly   *bool     `json:"unread_only"`
+	ExcludeMuted *bool     `json:"exclude_muted"`
+}
+
+type FolderResponse struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	ChatIDs      []string  `json:"chat_ids"`
+	GroupsOnly   bool      `json:"groups_only"`
+	UnreadOnly   bool      `json:"unread_only"`
+	ExcludeMuted bool      `json:"exclude_muted"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ListFolders - GET /folders
+func (h *ChatHandler) ListFolders(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	folders, err := h.service.ListFolders(r.Context(), userID)
+	if err != nil {
+		slog.Error("failed to list folders", "error", err)
+		http.Error(w, "failed to list folders", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]FolderResponse, 0, len(folders))
+	for i := range folders {
+		resp = append(resp, newFolderResponse(&folders[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// CreateFolder - POST /folders
+func (h *ChatHandler) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req FolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	folder, err := h.service.CreateFolder(r.Context(), userID, service.FolderInput(req))
+	if err != nil {
+		writeFolderError(w, err, "failed to create folder")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newFolderResponse(folder))
+}
+
+// UpdateFolder - PATCH /folders/{folder_id}
+func (h *ChatHandler) UpdateFolder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req FolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	folder, err := h.service.UpdateFolder(r.Context(), userID, chi.URLParam(r, "folder_id"), service.FolderInput(req))
+	if err != nil {
+		writeFolderError(w, err, "failed to update folder")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newFolderResponse(folder))
+}
+
+// DeleteFolder - DELETE /folders/{folder_id}, the chats stay where they are
+func (h *ChatHandler) DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.service.DeleteFolder(r.Context(), userID, chi.URLParam(r, "folder_id")); err != nil {
+		writeFolderError(w, err, "failed to delete folder")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newFolderResponse(folder *service.ChatFolder) FolderResponse {
+	chatIDs := make([]string, 0, len(folder.ChatIDs))
+	for _, id := range folder.ChatIDs {
+		chatIDs = append(chatIDs, id.String())
+	}
+	return FolderResponse{
+		ID:           folder.ID.String(),
+		Name:         folder.Name,
+		ChatIDs:      chatIDs,
+		GroupsOnly:   folder.GroupsOnly,
+		UnreadOnly:   folder.UnreadOnly,
+		ExcludeMuted: folder.ExcludeMuted,
+		CreatedAt:    folder.CreatedAt.Time,
+	}
+}
+
+func writeFolderError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrFolderNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrTooManyFolders), errors.Is(err, service.ErrInvalidFolder):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		slog.Error(msg, "error", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+}
@@ -2,16 +2,23 @@ package handler
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/Adopten123/go-messenger/internal/service"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type contextKey string
 
-const UserIDKey contextKey = "UserID"
+const (
+	UserIDKey    contextKey = "UserID"
+	SessionIDKey contextKey = "SessionID"
+	ClaimsKey    contextKey = "Claims"
+)
 
 func (h *UserHandler) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -24,22 +31,12 @@ func (h *UserHandler) AuthMiddleware(next http.Handler) http.Handler {
 			}
 		}
 
-		if tokenString == "" {
-			tokenString = r.URL.Query().Get("token")
-		}
-
 		if tokenString == "" {
 			http.Error(w, "unauthorized: token required", http.StatusUnauthorized)
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(h.tokenSecret), nil
-		})
-
+		token, err := h.service.Keys().Parse(tokenString)
 		if err != nil || !token.Valid {
 			http.Error(w, "invalid token", http.StatusUnauthorized)
 			return
@@ -57,7 +54,37 @@ func (h *UserHandler) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		accessClaims := accessClaimsFrom(userID, claims)
+		revoked, err := h.service.IsRevoked(r.Context(), accessClaims)
+		if err != nil {
+			slog.Error("failed to check token revocation", "error", err)
+			http.Error(w, "failed to check token", http.StatusServiceUnavailable)
+			return
+		}
+		if revoked {
+			http.Error(w, "token revoked", http.StatusUnauthorized)
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), UserIDKey, userID)
+		ctx = context.WithValue(ctx, ClaimsKey, accessClaims)
+		if accessClaims.SessionID != "" {
+			ctx = context.WithValue(ctx, SessionIDKey, accessClaims.SessionID)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// accessClaimsFrom - iat carries milliseconds, exp whole seconds
+func accessClaimsFrom(userID string, claims jwt.MapClaims) service.AccessClaims {
+	accessClaims := service.AccessClaims{UserID: userID}
+	accessClaims.SessionID, _ = claims["sid"].(string)
+	accessClaims.TokenID, _ = claims["jti"].(string)
+	if iat, ok := claims["iat"].(float64); ok {
+		accessClaims.IssuedAt = time.UnixMilli(int64(math.Round(iat * 1000)))
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		accessClaims.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	return accessClaims
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type OIDCHandler struct {
+	service *service.OIDCService
+}
+
+func NewOIDCHandler(service *service.OIDCService) *OIDCHandler {
+	return &OIDCHandler{service: service}
+}
+
+type OIDCProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+// ListProviders - GET /auth/oidc, what the login page offers besides the password
+func (h *OIDCHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OIDCProvidersResponse{Providers: h.service.Providers()})
+}
+
+// Login - GET /auth/oidc/{provider}/login, redirects to the provider
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	authURL, err := h.service.AuthURL(r.Context(), chi.URLParam(r, "provider"))
+	if err != nil {
+		if errors.Is(err, service.ErrUnknownProvider) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to start oidc login", "error", err)
+		http.Error(w, "identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback - GET /auth/oidc/{provider}/callback, the provider redirects here.
+// Responds like POST /users/login.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		http.Error(w, "login was not completed: "+providerErr, http.StatusUnauthorized)
+		return
+	}
+	if query.Get("code") == "" || query.Get("state") == "" {
+		http.Error(w, "code and state are required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.Login(r.Context(), chi.URLParam(r, "provider"), query.Get("code"), query.Get("state"), deviceFromRequest(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnknownProvider):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrInvalidOIDCState), errors.Is(err, service.ErrCodeRejected),
+			errors.Is(err, service.ErrInvalidIDToken):
+			slog.Warn("oidc login rejected", "error", err)
+			http.Error(w, "login failed", http.StatusUnauthorized)
+		case errors.Is(err, service.ErrIdentityConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			slog.Error("failed to complete oidc login", "error", err)
+			http.Error(w, "failed to complete login", http.StatusBadGateway)
+		}
+		return
+	}
+
+	writeLoginResult(w, result)
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type PinMessageRequest struct {
+	MessageID string `json:"message_id"`
+}
+
+type PinnedMessageResponse struct {
+	ID             string    `json:"id"`
+	Content        string    `json:"content"`
+	Kind           string    `json:"kind"`
+	CreatedAt      time.Time `json:"created_at"`
+	SenderID       string    `json:"sender_id,omitempty"`
+	SenderUsername string    `json:"sender_username,omitempty"`
+	FileID         string    `json:"file_id,omitempty"`
+	PinnedBy       string    `json:"pinned_by,omitempty"`
+	PinnedAt       time.Time `json:"pinned_at"`
+}
+
+type UpdateChatRequest struct {
+	MembersCanPin *bool `json:"members_can_pin"`
+}
+
+type ChatResponse struct {
+	ID            string `json:"chat_id"`
+	Name          string `json:"name"`
+	IsGroup       bool   `json:"is_group"`
+	MembersCanPin bool   `json:"members_can_pin"`
+}
+
+// ListPinned - GET /chats/{chat_id}/pins
+func (h *ChatHandler) ListPinned(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	pinned, err := h.service.ListPinned(r.Context(), userID, chi.URLParam(r, "chat_id"))
+	if err != nil {
+		writePinError(w, err, "failed to list pinned messages")
+		return
+	}
+
+	resp := make([]PinnedMessageResponse, 0, len(pinned))
+	for _, p := range pinned {
+		resp = append(resp, newPinnedMessageResponse(p))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// PinMessage - POST /chats/{chat_id}/pins
+func (h *ChatHandler) PinMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req PinMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID == "" {
+		http.Error(w, "message_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.service.PinMessage(r.Context(), userID, chi.URLParam(r, "chat_id"), req.MessageID); err != nil {
+		writePinError(w, err, "failed to pin message")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnpinMessage - DELETE /chats/{chat_id}/pins/{message_id}
+func (h *ChatHandler) UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	_, err := h.service.UnpinMessage(r.Context(), userID, chi.URLParam(r, "chat_id"), chi.URLParam(r, "message_id"))
+	if err != nil {
+		writePinError(w, err, "failed to unpin message")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateChat - PATCH /chats/{chat_id}, admins only
+func (h *ChatHandler) UpdateChat(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req UpdateChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MembersCanPin == nil {
+		http.Error(w, "members_can_pin is required", http.StatusBadRequest)
+		return
+	}
+
+	chat, err := h.service.SetMembersCanPin(r.Context(), userID, chi.URLParam(r, "chat_id"), *req.MembersCanPin)
+	if err != nil {
+		writePinError(w, err, "failed to update chat")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ChatResponse{
+		ID:            chat.ID.String(),
+		Name:          chat.Name.String,
+		IsGroup:       chat.IsGroup,
+		MembersCanPin: chat.MembersCanPin,
+	})
+}
+
+func newPinnedMessageResponse(p pgdb.ListPinnedMessagesRow) PinnedMessageResponse {
+	resp := PinnedMessageResponse{
+		ID:             p.ID.String(),
+		Content:        p.Content,
+		Kind:           p.Kind,
+		CreatedAt:      p.CreatedAt.Time,
+		SenderUsername: p.SenderUsername.String,
+		PinnedAt:       p.PinnedAt.Time,
+	}
+	// missing for deleted accounts and messages without a file
+	if p.SenderID.Valid {
+		resp.SenderID = p.SenderID.String()
+	}
+	if p.FileID.Valid {
+		resp.FileID = p.FileID.String()
+	}
+	if p.PinnedBy.Valid {
+		resp.PinnedBy = p.PinnedBy.String()
+	}
+	return resp
+}
+
+func writePinError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, service.ErrChatNotFound), errors.Is(err, service.ErrMessageNotFound),
+		errors.Is(err, service.ErrNotPinned):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrPinForbidden), errors.Is(err, service.ErrNotChatAdmin):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrAlreadyPinned):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrTooManyPins):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		slog.Error(msg, "error", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+}
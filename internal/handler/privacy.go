@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Adopten123/go-messenger/internal/service"
+)
+
+// PrivacySettingsRequest - everyone, contacts or nobody, absent fields stay
+type PrivacySettingsRequest struct {
+	Online       *string `json:"online"`
+	LastSeen     *string `json:"last_seen"`
+	ReadReceipts *string `json:"read_receipts"`
+}
+
+type PrivacySettingsResponse struct {
+	Online       string `json:"online"`
+	LastSeen     string `json:"last_seen"`
+	ReadReceipts string `json:"read_receipts"`
+}
+
+// GetPrivacy - GET /users/me/privacy
+func (h *UserHandler) GetPrivacy(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	settings, err := h.service.GetPrivacy(r.Context(), userID)
+	if err != nil {
+		slog.Error("failed to get privacy settings", "error", err)
+		http.Error(w, "failed to get privacy settings", http.StatusInternalServerError)
+		return
+	}
+
+	writePrivacySettings(w, settings)
+}
+
+// UpdatePrivacy - PATCH /users/me/privacy
+func (h *UserHandler) UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req PrivacySettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.service.UpdatePrivacy(r.Context(), userID, service.PrivacyUpdate{
+		Online:       req.Online,
+		LastSeen:     req.LastSeen,
+		ReadReceipts: req.ReadReceipts,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPrivacy) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Error("failed to update privacy settings", "error", err)
+		http.Error(w, "failed to update privacy settings", http.StatusInternalServerError)
+		return
+	}
+
+	writePrivacySettings(w, settings)
+}
+
+func writePrivacySettings(w http.ResponseWriter, settings *service.PrivacySettings) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PrivacySettingsResponse{
+		Online:       settings.Online,
+		LastSeen:     settings.LastSeen,
+		ReadReceipts: settings.ReadReceipts,
+	})
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// UpdateProfileRequest - absent fields stay as they are, "" clears a field.
+// A new status_text drops the old expiry.
+type UpdateProfileRequest struct {
+	DisplayName     *string    `json:"display_name"`
+	Bio             *string    `json:"bio"`
+	StatusText      *string    `json:"status_text"`
+	StatusExpiresAt *time.Time `json:"status_expires_at"` // RFC 3339
+	Discoverable    *bool      `json:"discoverable"`
+	ContactsOnlyDms *bool      `json:"contacts_only_dms"`
+}
+
+// PublicProfileResponse - what anyone logged in may see, never the email
+type PublicProfileResponse struct {
+	ID              string `json:"id"`
+	Username        string `json:"username"`
+	DisplayName     string `json:"display_name,omitempty"`
+	Bio             string `json:"bio,omitempty"`
+	AvatarURL       string `json:"avatar_url,omitempty"`
+	StatusText      string `json:"status_text,omitempty"`
+	StatusExpiresAt string `json:"status_expires_at,omitempty"`
+	CreatedAt       string `json:"created_at"`
+}
+
+// UpdateMe - PATCH /users/me
+func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.service.UpdateProfile(r.Context(), userID, service.ProfileUpdate{
+		DisplayName:     req.DisplayName,
+		Bio:             req.Bio,
+		StatusText:      req.StatusText,
+		StatusExpiresAt: req.StatusExpiresAt,
+		Discoverable:    req.Discoverable,
+		ContactsOnlyDms: req.ContactsOnlyDms,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidProfile) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Error("failed to update profile", "error", err)
+		http.Error(w, "failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeMe(w, user)
+}
+
+// GetProfile - GET /users/{user_id}
+func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := h.service.GetUser(r.Context(), chi.URLParam(r, "user_id"))
+	if err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to get user", "error", err)
+		http.Error(w, "failed to get user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.newPublicProfile(user))
+}
+
+func (h *UserHandler) newPublicProfile(user *pgdb.User) PublicProfileResponse {
+	profile := PublicProfileResponse{
+		ID:          user.ID.String(),
+		Username:    user.Username,
+		DisplayName: user.DisplayName.String,
+		Bio:         user.Bio.String,
+		AvatarURL:   user.AvatarUrl.String,
+		CreatedAt:   user.CreatedAt.Time.UTC().Format(time.RFC3339),
+	}
+
+	status, expiresAt := h.service.ActiveStatus(user)
+	profile.StatusText = status
+	if expiresAt != nil {
+		profile.StatusExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	}
+	return profile
+}
+
+// writeMe - the public profile plus what only the user sees
+func (h *UserHandler) writeMe(w http.ResponseWriter, user *pgdb.User) {
+	profile := h.newPublicProfile(user)
+	response := map[string]any{
+		"id":                profile.ID,
+		"username":          profile.Username,
+		"email":             user.Email,
+		"email_verified":    user.EmailVerified,
+		"display_name":      profile.DisplayName,
+		"bio":               profile.Bio,
+		"avatar_url":        profile.AvatarURL,
+		"status_text":       profile.StatusText,
+		"status_expires_at": profile.StatusExpiresAt,
+		"created_at":        profile.CreatedAt,
+		"discoverable":      user.Discoverable,
+		"contacts_only_dms": user.ContactsOnlyDms,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+type UserSearchResult struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	IsContact   bool   `json:"is_contact"`
+}
+
+// SearchUsers - GET /users/search?q=&limit=&offset=
+func (h *UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	// 1. Parse query params
+	limit := 20
+	offset := 0
+
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o > 0 {
+		offset = o
+	}
+
+	// 2. Calling service
+	users, err := h.service.SearchUsers(r.Context(), userID, r.URL.Query().Get("q"), limit, offset)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSearch) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slog.Error("failed to search users", "error", err)
+		http.Error(w, "failed to search users", http.StatusInternalServerError)
+		return
+	}
+
+	// 3. Response JSON
+	results := make([]UserSearchResult, 0, len(users))
+	for _, user := range users {
+		results = append(results, UserSearchResult{
+			ID:          user.ID.String(),
+			Username:    user.Username,
+			DisplayName: user.DisplayName.String,
+			AvatarURL:   user.AvatarUrl.String,
+			IsContact:   user.IsContact,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/service"
+)
+
+// RateLimit - per client IP limit of a route, per user behind
+// AuthMiddleware. name keeps the counters of different routes apart.
+// A Redis outage lets requests through.
+func RateLimit(limiter *service.RateLimiter, name string, rate service.Rate) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := clientIP(r)
+			if userID, ok := r.Context().Value(UserIDKey).(string); ok {
+				key = "user:" + userID
+			}
+
+			allowed, retryAfter, err := limiter.Allow(r.Context(), name+":"+key, rate)
+			if err != nil {
+				slog.Error("failed to check rate limit", "route", name, "error", err)
+			} else if !allowed {
+				tooManyRequests(w, "too many requests", retryAfter)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tooManyRequests - 429 with Retry-After in whole seconds
+func tooManyRequests(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	http.Error(w, message, http.StatusTooManyRequests)
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type SessionResponse struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	Current    bool   `json:"current"`
+}
+
+// Refresh - POST /auth/refresh, the old refresh token stops working
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.service.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		slog.Error("failed to refresh token", "error", err)
+		http.Error(w, "failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newLoginResponse(tokens))
+}
+
+// Logout - POST /auth/logout, works with an expired access token too
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.Logout(r.Context(), req.RefreshToken); err != nil {
+		slog.Error("failed to logout", "error", err)
+		http.Error(w, "failed to logout", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListSessions - devices the current user is logged in on
+func (h *UserHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+	currentID, _ := r.Context().Value(SessionIDKey).(string)
+
+	sessions, err := h.service.ListSessions(r.Context(), userID)
+	if err != nil {
+		slog.Error("failed to list sessions", "error", err)
+		http.Error(w, "failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, SessionResponse{
+			ID:         s.ID.String(),
+			UserAgent:  s.UserAgent,
+			IPAddress:  s.IpAddress,
+			CreatedAt:  s.CreatedAt.Time.Format(time.RFC3339),
+			LastUsedAt: s.LastUsedAt.Time.Format(time.RFC3339),
+			Current:    s.ID.String() == currentID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// DeleteSession - DELETE /users/me/sessions/{session_id}
+func (h *UserHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	err := h.service.RevokeSession(r.Context(), userID, chi.URLParam(r, "session_id"))
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to revoke session", "error", err)
+		http.Error(w, "failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteOtherSessions - DELETE /users/me/sessions, keeps the current one
+func (h *UserHandler) DeleteOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+	currentID, _ := r.Context().Value(SessionIDKey).(string)
+
+	if _, err := h.service.RevokeOtherSessions(r.Context(), userID, currentID); err != nil {
+		slog.Error("failed to revoke sessions", "error", err)
+		http.Error(w, "failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JWKS - GET /.well-known/jwks.json, public keys other services verify access tokens with
+func (h *UserHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.service.Keys().JWKS())
+}
+
+func newLoginResponse(tokens *service.TokenPair) LoginResponse {
+	return LoginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt.UTC().Format(time.RFC3339),
+		SessionID:    tokens.SessionID,
+	}
+}
+
+func deviceFromRequest(r *http.Request) service.Device {
+	return service.Device{
+		UserAgent: r.UserAgent(),
+		IPAddress: clientIP(r),
+	}
+}
+
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
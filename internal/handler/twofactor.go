@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Adopten123/go-messenger/internal/service"
+)
+
+// TwoFactorChallengeResponse - login answer when the user has 2FA on
+type TwoFactorChallengeResponse struct {
+	ChallengeID string `json:"challenge_id"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeID string `json:"challenge_id"`
+	Code        string `json:"code"` // TOTP or recovery code
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorStatusResponse struct {
+	Enabled           bool  `json:"enabled"`
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
+
+type TOTPSetupResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// LoginTwoFactor - POST /users/login/2fa, second step of the login
+func (h *UserHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeID == "" || req.Code == "" {
+		http.Error(w, "challenge_id and code are required", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.service.CompleteLogin(r.Context(), req.ChallengeID, req.Code, deviceFromRequest(r))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidChallenge) || errors.Is(err, service.ErrInvalidCode) ||
+			errors.Is(err, service.ErrTwoFactorNotEnabled) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		slog.Error("failed to complete login", "error", err)
+		http.Error(w, "failed to complete login", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newLoginResponse(tokens))
+}
+
+// GetTwoFactor - GET /users/me/2fa
+func (h *UserHandler) GetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := h.service.TwoFactorStatus(r.Context(), userID)
+	if err != nil {
+		slog.Error("failed to get 2fa status", "error", err)
+		http.Error(w, "failed to get 2fa status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TwoFactorStatusResponse{
+		Enabled:           status.Enabled,
+		RecoveryCodesLeft: status.RecoveryCodesLeft,
+	})
+}
+
+// SetupTwoFactor - POST /users/me/2fa/setup, a new secret until it is confirmed
+func (h *UserHandler) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	setup, err := h.service.SetupTOTP(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, service.ErrTwoFactorEnabled) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		slog.Error("failed to setup totp", "error", err)
+		http.Error(w, "failed to setup 2fa", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TOTPSetupResponse{
+		Secret:     setup.Secret,
+		OtpauthURI: setup.URI,
+	})
+}
+
+// ConfirmTwoFactor - POST /users/me/2fa/confirm, turns 2FA on
+func (h *UserHandler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := decodeTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.service.ConfirmTOTP(r.Context(), userID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, "failed to confirm 2fa", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor - POST /users/me/2fa/disable
+func (h *UserHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := decodeTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DisableTOTP(r.Context(), userID, req.Code); err != nil {
+		writeTwoFactorError(w, "failed to disable 2fa", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes - POST /users/me/2fa/recovery-codes
+func (h *UserHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := decodeTwoFactorCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(r.Context(), userID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, "failed to regenerate recovery codes", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func decodeTwoFactorCode(w http.ResponseWriter, r *http.Request) (string, TwoFactorCodeRequest, bool) {
+	var req TwoFactorCodeRequest
+
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return "", req, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return "", req, false
+	}
+	return userID, req, true
+}
+
+func writeTwoFactorError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidCode):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, service.ErrTwoFactorEnabled), errors.Is(err, service.ErrTwoFactorNotEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		slog.Error(msg, "error", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+}
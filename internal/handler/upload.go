@@ -0,0 +1,268 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// Subset of the tus 1.0.0 resumable upload protocol (https://tus.io/protocols/resumable-upload)
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+)
+
+type UploadHandler struct {
+	service *service.UploadService
+}
+
+func NewUploadHandler(service *service.UploadService) *UploadHandler {
+	return &UploadHandler{service: service}
+}
+
+type FileResponse struct {
+	ID          string `json:"id"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+}
+
+// Options - tus discovery
+func (h *UploadHandler) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.service.MaxSize(), 10))
+	w.Header().Set("Upload-Part-Size", strconv.FormatInt(h.service.PartSize(), 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create - POST /uploads, opens a new upload session
+func (h *UploadHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	// 1. Parse headers
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	meta := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+
+	fileName := meta["filename"]
+	if fileName == "" {
+		fileName = "file"
+	}
+
+	// 2. Calling service
+	upload, err := h.service.CreateUpload(r.Context(), userID, fileName, meta["filetype"], size)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUploadTooLarge), errors.Is(err, service.ErrQuotaExceeded):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.Is(err, service.ErrUploadEmpty):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			slog.Error("failed to create upload", "error", err)
+			http.Error(w, "failed to create upload", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// 3. Response
+	w.Header().Set("Location", "/api/uploads/"+upload.ID.String())
+	writeUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Head - current offset, the client resumes from it
+func (h *UploadHandler) Head(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	upload, err := h.service.GetUpload(r.Context(), userID, chi.URLParam(r, "upload_id"))
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.TotalSize, 10))
+	writeUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusOK)
+}
+
+// Patch - appends a chunk of the file at Upload-Offset
+func (h *UploadHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "content type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, h.service.MaxSize())
+	upload, err := h.service.WriteChunk(r.Context(), userID, chi.URLParam(r, "upload_id"), offset, body)
+	if err != nil {
+		if upload != nil {
+			writeUploadHeaders(w, upload)
+		}
+		writeUploadError(w, err)
+		return
+	}
+
+	writeUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Delete - tus termination
+func (h *UploadHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+	if !checkTusVersion(w, r) {
+		return
+	}
+
+	if err := h.service.AbortUpload(r.Context(), userID, chi.URLParam(r, "upload_id")); err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetFile - file metadata with a short-lived download link
+func (h *UploadHandler) GetFile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	file, err := h.service.GetFile(r.Context(), userID, chi.URLParam(r, "file_id"))
+	if err != nil {
+		if errors.Is(err, service.ErrFileNotFound) {
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to get file", "error", err)
+		http.Error(w, "failed to get file", http.StatusInternalServerError)
+		return
+	}
+
+	url, err := h.service.DownloadURL(r.Context(), file)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrFilePending):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, service.ErrFileInfected), errors.Is(err, service.ErrFileScanFailed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			slog.Error("failed to make download url", "error", err)
+			http.Error(w, "failed to get file", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newFileResponse(file, url))
+}
+
+func newFileResponse(file *pgdb.File, url string) FileResponse {
+	return FileResponse{
+		ID:          file.ID.String(),
+		FileName:    file.FileName,
+		ContentType: file.ContentType,
+		Size:        file.Size,
+		URL:         url,
+	}
+}
+
+func checkTusVersion(w http.ResponseWriter, r *http.Request) bool {
+	if v := r.Header.Get("Tus-Resumable"); v != "" && v != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "unsupported tus version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+func writeUploadHeaders(w http.ResponseWriter, upload *pgdb.Upload) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.UploadOffset, 10))
+	if upload.FileID.Valid {
+		w.Header().Set("X-File-Id", upload.FileID.String())
+	} else {
+		w.Header().Set("Upload-Expires", upload.ExpiresAt.Time.UTC().Format(http.TimeFormat))
+	}
+}
+
+func writeUploadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUploadNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrUploadExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, service.ErrUploadOffsetMismatch):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrChunkNotAligned):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		slog.Error("upload failed", "error", err)
+		http.Error(w, "upload failed", http.StatusInternalServerError)
+	}
+}
+
+// parseUploadMetadata - "key base64value,key2 base64value2"
+func parseUploadMetadata(header string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		meta[key] = string(value)
+	}
+	return meta
+}
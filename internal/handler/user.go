@@ -2,9 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"net/mail"
 	"strings"
+	"time"
 
 	"github.com/Adopten123/go-messenger/internal/service"
 	"github.com/go-chi/chi/v5"
@@ -14,20 +17,17 @@ import (
 
 type UserHandler struct {
 	service     *service.UserService
-	tokenSecret string
 	rdb         *redis.Client
 	fileService *service.FileService
 }
 
 func NewUserHandler(
 	service *service.UserService,
-	tokenSecret string,
 	rdb *redis.Client,
 	fs *service.FileService) *UserHandler {
 
 	return &UserHandler{
 		service:     service,
-		tokenSecret: tokenSecret,
 		rdb:         rdb,
 		fileService: fs,
 	}
@@ -52,8 +52,12 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// LoginResponse - token is the access token, sent as "Authorization: Bearer"
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    string `json:"expires_at"`
+	SessionID    string `json:"session_id"`
 }
 
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -73,6 +77,10 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "email is required", http.StatusBadRequest)
 		return
 	}
+	if !validEmail(req.Email) {
+		http.Error(w, "invalid email", http.StatusBadRequest)
+		return
+	}
 	if req.Password == "" {
 		http.Error(w, "password is required", http.StatusBadRequest)
 		return
@@ -117,16 +125,33 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.service.Login(r.Context(), req.Email, req.Password)
+	result, err := h.service.Login(r.Context(), req.Email, req.Password, deviceFromRequest(r))
 	if err != nil {
+		var lockout *service.LockoutError
+		if errors.As(err, &lockout) {
+			tooManyRequests(w, err.Error(), lockout.RetryAfter)
+			return
+		}
 		http.Error(w, "invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
-	resp := LoginResponse{Token: token}
+	writeLoginResult(w, result)
+}
 
+// writeLoginResult - tokens, or 202 with the challenge when the user has 2FA on
+func writeLoginResult(w http.ResponseWriter, result *service.LoginResult) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	if result.Challenge != nil {
+		// 202 - the second factor goes to /users/login/2fa
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(TwoFactorChallengeResponse{
+			ChallengeID: result.Challenge.ID,
+			ExpiresAt:   result.Challenge.ExpiresAt.UTC().Format(time.RFC3339),
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(newLoginResponse(result.Tokens))
 }
 
 // GetMe - tests method, returns the current user ID
@@ -143,32 +168,49 @@ func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := map[string]string{
-		"id":       user.ID.String(),
-		"username": user.Username,
-		"email":    user.Email,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	h.writeMe(w, user)
 }
 
+// GetOnlineStatus - as much as the privacy settings of the user let the
+// current user see, last_seen only while offline
 func (h *UserHandler) GetOnlineStatus(w http.ResponseWriter, r *http.Request) {
 	targetID := chi.URLParam(r, "user_id")
 	if targetID == "" {
 		http.Error(w, "user_id is required", http.StatusBadRequest)
 		return
 	}
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
 
-	exists, err := h.rdb.Exists(r.Context(), "user:"+targetID+":online").Result()
+	presence, err := h.service.Presence(r.Context(), userID, targetID)
 	if err != nil {
-		http.Error(w, "redis error", http.StatusInternalServerError)
+		if errors.Is(err, service.ErrUserNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to get presence", "error", err)
+		http.Error(w, "failed to get status", http.StatusInternalServerError)
 		return
 	}
 
-	status := map[string]bool{
+	var exists int64
+	if presence.ShowOnline {
+		exists, err = h.rdb.Exists(r.Context(), "user:"+targetID+":online").Result()
+		if err != nil {
+			http.Error(w, "redis error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	status := map[string]any{
 		"online": exists > 0,
 	}
+	if exists == 0 && presence.LastSeen != nil {
+		status["last_seen"] = presence.LastSeen.UTC().Format(time.RFC3339)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(status)
@@ -191,22 +233,27 @@ func (h *UserHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 	defer file.Close()
 
 	// 3. Upload in MinIO
-	url, err := h.fileService.UploadFile(
-		r.Context(), file,
+	userID := r.Context().Value(UserIDKey).(string)
+
+	stored, err := h.fileService.StoreFile(
+		r.Context(), userID, file,
 		header.Size, header.Filename, header.Header.Get("Content-Type"),
 	)
 	if err != nil {
+		if errors.Is(err, service.ErrQuotaExceeded) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "failed to upload", http.StatusInternalServerError)
 		return
 	}
+	url := h.fileService.PublicURL(stored.ObjectKey)
 
-	// 4. Update user in DB
-	userID := r.Context().Value(UserIDKey).(string)
-
+	// 4. Update user in DB, the avatar is served once it's scanned clean
 	var userUUID pgtype.UUID
 	userUUID.Scan(userID)
 
-	err = h.service.UpdateAvatar(r.Context(), userUUID, url)
+	err = h.service.UpdateAvatar(r.Context(), userUUID, url, stored.ID)
 	if err != nil {
 		http.Error(w, "failed to update user profile", http.StatusInternalServerError)
 		return
@@ -214,5 +261,41 @@ func (h *UserHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 
 	// 5. Url response
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"avatar_url": url})
+	json.NewEncoder(w).Encode(map[string]string{"avatar_url": url, "scan_status": stored.ScanStatus})
+}
+
+type StorageResponse struct {
+	UsedBytes  int64 `json:"used_bytes"`
+	QuotaBytes int64 `json:"quota_bytes"`
+	FilesCount int64 `json:"files_count"`
+}
+
+// GetStorage - how much of the quota the current user has consumed
+func (h *UserHandler) GetStorage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user id not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	usage, err := h.fileService.GetUsage(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "failed to fetch storage usage", http.StatusInternalServerError)
+		return
+	}
+
+	resp := StorageResponse{
+		UsedBytes:  usage.UsedBytes,
+		QuotaBytes: usage.QuotaBytes,
+		FilesCount: usage.FilesCount,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// validEmail - a bare address, no display name
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
 }
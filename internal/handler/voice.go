@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/Adopten123/go-messenger/internal/service"
+)
+
+const maxVoiceSize = 20 << 20
+
+type VoiceHandler struct {
+	service *service.VoiceService
+}
+
+func NewVoiceHandler(service *service.VoiceService) *VoiceHandler {
+	return &VoiceHandler{service: service}
+}
+
+type VoiceResponse struct {
+	ID          string `json:"id"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	DurationMs  int32  `json:"duration_ms"`
+	Waveform    []byte `json:"waveform,omitempty"`
+}
+
+// Upload - POST /files/voice, WAV or Ogg/Opus recording in the "voice" form field.
+// The returned id is sent as file_id of a "voice" message.
+func (h *VoiceHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(UserIDKey).(string)
+	if !ok {
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	// 1. Parse multipart/form-data
+	r.Body = http.MaxBytesReader(w, r.Body, maxVoiceSize)
+	if err := r.ParseMultipartForm(maxVoiceSize); err != nil {
+		http.Error(w, "voice message too big", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	file, header, err := r.FormFile("voice")
+	if err != nil {
+		http.Error(w, "invalid file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// 2. Calling service
+	voice, err := h.service.StoreVoice(r.Context(), userID, file, header.Size, header.Filename)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnsupportedAudio):
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		case errors.Is(err, service.ErrQuotaExceeded):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		default:
+			slog.Error("failed to store voice message", "error", err)
+			http.Error(w, "failed to upload", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// 3. Response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(VoiceResponse{
+		ID:          voice.ID.String(),
+		FileName:    voice.FileName,
+		ContentType: voice.ContentType,
+		Size:        voice.Size,
+		DurationMs:  voice.DurationMs.Int32,
+		Waveform:    voice.Waveform,
+	})
+}
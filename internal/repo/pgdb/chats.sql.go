@@ -11,6 +11,74 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const clearMarkedUnread = `-- name: ClearMarkedUnread :one
+UPDATE chat_members
+SET marked_unread = FALSE
+WHERE chat_id = $1 AND user_id = $2 AND marked_unread
+    RETURNING chat_id, user_id, role, joined_at, muted_until, archived, pin_order, marked_unread
+`
+
+type ClearMarkedUnreadParams struct {
+	ChatID pgtype.UUID `json:"chat_id"`
+	UserID pgtype.UUID `json:"user_id"`
+}
+
+func (q *Queries) ClearMarkedUnread(ctx context.Context, arg ClearMarkedUnreadParams) (ChatMember, error) {
+	row := q.db.QueryRow(ctx, clearMarkedUnread, arg.ChatID, arg.UserID)
+	var i ChatMember
+	err := row.Scan(
+		&i.ChatID,
+		&i.UserID,
+		&i.Role,
+		&i.JoinedAt,
+		&i.MutedUntil,
+		&i.Archived,
+		&i.PinOrder,
+		&i.MarkedUnread,
+	)
+	return i, err
+}
+
+const countPinnedChats = `-- name: CountPinnedChats :one
+SELECT count(*)
+FROM chat_members
+WHERE user_id = $1 AND pin_order IS NOT NULL
+`
+
+func (q *Queries) CountPinnedChats(ctx context.Context, userID pgtype.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countPinnedChats, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const getChatMember = `-- name: GetChatMember :one
+SELECT chat_id, user_id, role, joined_at, muted_until, archived, pin_order, marked_unread
+FROM chat_members
+WHERE chat_id = $1 AND user_id = $2
+`
+
+type GetChatMemberParams struct {
+	ChatID pgtype.UUID `json:"chat_id"`
+	UserID pgtype.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetChatMember(ctx context.Context, arg GetChatMemberParams) (ChatMember, error) {
+	row := q.db.QueryRow(ctx, getChatMember, arg.ChatID, arg.UserID)
+	var i ChatMember
+	err := row.Scan(
+		&i.ChatID,
+		&i.UserID,
+		&i.Role,
+		&i.JoinedAt,
+		&i.MutedUntil,
+		&i.Archived,
+		&i.PinOrder,
+		&i.MarkedUnread,
+	)
+	return i, err
+}
+
 const getChatMembers = `-- name: GetChatMembers :many
 SELECT user_id
 FROM chat_members
@@ -56,3 +124,267 @@ func (q *Queries) IsChatMember(ctx context.Context, arg IsChatMemberParams) (boo
 	err := row.Scan(&exists)
 	return exists, err
 }
+
+const listChatMembersMuted = `-- name: ListChatMembersMuted :many
+SELECT user_id, (muted_until IS NOT NULL AND muted_until > now())::boolean AS muted
+FROM chat_members
+WHERE chat_id = $1
+`
+
+type ListChatMembersMutedRow struct {
+	UserID pgtype.UUID `json:"user_id"`
+	Muted  bool        `json:"muted"`
+}
+
+func (q *Queries) ListChatMembersMuted(ctx context.Context, chatID pgtype.UUID) ([]ListChatMembersMutedRow, error) {
+	rows, err := q.db.Query(ctx, listChatMembersMuted, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChatMembersMutedRow
+	for rows.Next() {
+		var i ListChatMembersMutedRow
+		if err := rows.Scan(&i.UserID, &i.Muted); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserChats = `-- name: ListUserChats :many
+SELECT
+    c.id,
+    c.name,
+    c.is_group,
+    c.created_at,
+    cm.muted_until,
+    cm.archived,
+    cm.pin_order,
+    cm.marked_unread,
+    COALESCE(last.created_at, c.created_at)::timestamptz AS last_activity_at,
+    d.content AS draft,
+    d.updated_at AS draft_updated_at
+FROM chats c
+         JOIN chat_members cm ON c.id = cm.chat_id
+         LEFT JOIN chat_drafts d ON d.chat_id = c.id AND d.user_id = cm.user_id
+         LEFT JOIN LATERAL (
+    SELECT m.created_at
+    FROM messages m
+    WHERE m.chat_id = c.id
+    ORDER BY m.created_at DESC
+    LIMIT 1
+    ) last ON TRUE
+WHERE cm.user_id = $1
+  AND cm.archived = $2
+  AND ($3::uuid IS NULL OR EXISTS (
+    SELECT 1
+    FROM chat_folders f
+    WHERE f.id = $3
+      AND f.user_id = cm.user_id
+      AND (NOT EXISTS (SELECT 1 FROM chat_folder_chats fc WHERE fc.folder_id = f.id)
+        OR EXISTS (SELECT 1 FROM chat_folder_chats fc WHERE fc.folder_id = f.id AND fc.chat_id = c.id))
+      -- chats named on creation are flagged is_group, count the members instead
+      AND (NOT f.groups_only OR (SELECT count(*) FROM chat_members g WHERE g.chat_id = c.id) > 2)
+      AND (NOT f.exclude_muted OR cm.muted_until IS NULL OR cm.muted_until <= now())
+      AND (NOT f.unread_only OR cm.marked_unread OR EXISTS (
+        SELECT 1
+        FROM messages m
+        WHERE m.chat_id = c.id
+          AND m.sender_id IS DISTINCT FROM cm.user_id
+          AND NOT m.is_read))
+))
+ORDER BY cm.pin_order IS NULL, cm.pin_order, last_activity_at DESC
+`
+
+type ListUserChatsParams struct {
+	UserID   pgtype.UUID `json:"user_id"`
+	Archived bool        `json:"archived"`
+	FolderID pgtype.UUID `json:"folder_id"`
+}
+
+type ListUserChatsRow struct {
+	ID             pgtype.UUID        `json:"id"`
+	Name           pgtype.Text        `json:"name"`
+	IsGroup        bool               `json:"is_group"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	MutedUntil     pgtype.Timestamptz `json:"muted_until"`
+	Archived       bool               `json:"archived"`
+	PinOrder       pgtype.Int4        `json:"pin_order"`
+	MarkedUnread   bool               `json:"marked_unread"`
+	LastActivityAt pgtype.Timestamptz `json:"last_activity_at"`
+	Draft          pgtype.Text        `json:"draft"`
+	DraftUpdatedAt pgtype.Timestamptz `json:"draft_updated_at"`
+}
+
+// The inbox or the archive of the user: pinned chats first in the user's
+// order, then the latest activity first. With folder_id only the chats of
+// that folder of the user.
+func (q *Queries) ListUserChats(ctx context.Context, arg ListUserChatsParams) ([]ListUserChatsRow, error) {
+	rows, err := q.db.Query(ctx, listUserChats, arg.UserID, arg.Archived, arg.FolderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserChatsRow
+	for rows.Next() {
+		var i ListUserChatsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.IsGroup,
+			&i.CreatedAt,
+			&i.MutedUntil,
+			&i.Archived,
+			&i.PinOrder,
+			&i.MarkedUnread,
+			&i.LastActivityAt,
+			&i.Draft,
+			&i.DraftUpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockUserChatMembers = `-- name: LockUserChatMembers :exec
+SELECT 1 FROM chat_members
+WHERE user_id = $1
+    FOR UPDATE
+`
+
+// Pin changes of the user wait for each other, so the pin limit holds.
+func (q *Queries) LockUserChatMembers(ctx context.Context, userID pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, lockUserChatMembers, userID)
+	return err
+}
+
+const nextPinOrder = `-- name: NextPinOrder :one
+SELECT (COALESCE(MIN(pin_order), 1) - 1)::integer AS pin_order
+FROM chat_members
+WHERE user_id = $1
+`
+
+// New pins go on top.
+func (q *Queries) NextPinOrder(ctx context.Context, userID pgtype.UUID) (int32, error) {
+	row := q.db.QueryRow(ctx, nextPinOrder, userID)
+	var pin_order int32
+	err := row.Scan(&pin_order)
+	return pin_order, err
+}
+
+const setPinOrder = `-- name: SetPinOrder :one
+UPDATE chat_members
+SET pin_order = $3
+WHERE chat_id = $1 AND user_id = $2 AND NOT archived
+    RETURNING chat_id, user_id, role, joined_at, muted_until, archived, pin_order, marked_unread
+`
+
+type SetPinOrderParams struct {
+	ChatID   pgtype.UUID `json:"chat_id"`
+	UserID   pgtype.UUID `json:"user_id"`
+	PinOrder pgtype.Int4 `json:"pin_order"`
+}
+
+func (q *Queries) SetPinOrder(ctx context.Context, arg SetPinOrderParams) (ChatMember, error) {
+	row := q.db.QueryRow(ctx, setPinOrder, arg.ChatID, arg.UserID, arg.PinOrder)
+	var i ChatMember
+	err := row.Scan(
+		&i.ChatID,
+		&i.UserID,
+		&i.Role,
+		&i.JoinedAt,
+		&i.MutedUntil,
+		&i.Archived,
+		&i.PinOrder,
+		&i.MarkedUnread,
+	)
+	return i, err
+}
+
+const unpinUserChats = `-- name: UnpinUserChats :many
+UPDATE chat_members
+SET pin_order = NULL
+WHERE user_id = $1 AND pin_order IS NOT NULL
+    RETURNING chat_id, user_id, role, joined_at, muted_until, archived, pin_order, marked_unread
+`
+
+func (q *Queries) UnpinUserChats(ctx context.Context, userID pgtype.UUID) ([]ChatMember, error) {
+	rows, err := q.db.Query(ctx, unpinUserChats, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChatMember
+	for rows.Next() {
+		var i ChatMember
+		if err := rows.Scan(
+			&i.ChatID,
+			&i.UserID,
+			&i.Role,
+			&i.JoinedAt,
+			&i.MutedUntil,
+			&i.Archived,
+			&i.PinOrder,
+			&i.MarkedUnread,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChatMemberSettings = `-- name: UpdateChatMemberSettings :one
+UPDATE chat_members
+SET muted_until   = $3,
+    archived      = $4,
+    pin_order     = $5,
+    marked_unread = $6
+WHERE chat_id = $1 AND user_id = $2
+    RETURNING chat_id, user_id, role, joined_at, muted_until, archived, pin_order, marked_unread
+`
+
+type UpdateChatMemberSettingsParams struct {
+	ChatID       pgtype.UUID        `json:"chat_id"`
+	UserID       pgtype.UUID        `json:"user_id"`
+	MutedUntil   pgtype.Timestamptz `json:"muted_until"`
+	Archived     bool               `json:"archived"`
+	PinOrder     pgtype.Int4        `json:"pin_order"`
+	MarkedUnread bool               `json:"marked_unread"`
+}
+
+func (q *Queries) UpdateChatMemberSettings(ctx context.Context, arg UpdateChatMemberSettingsParams) (ChatMember, error) {
+	row := q.db.QueryRow(ctx, updateChatMemberSettings,
+		arg.ChatID,
+		arg.UserID,
+		arg.MutedUntil,
+		arg.Archived,
+		arg.PinOrder,
+		arg.MarkedUnread,
+	)
+	var i ChatMember
+	err := row.Scan(
+		&i.ChatID,
+		&i.UserID,
+		&i.Role,
+		&i.JoinedAt,
+		&i.MutedUntil,
+		&i.Archived,
+		&i.PinOrder,
+		&i.MarkedUnread,
+	)
+	return i, err
+}
@@ -30,7 +30,7 @@ func (q *Queries) AddChatMember(ctx context.Context, arg AddChatMemberParams) er
 const createChat = `-- name: CreateChat :one
 INSERT INTO chats (name, is_group)
 VALUES ($1, $2)
-    RETURNING id, name, is_group, created_at
+    RETURNING id, name, is_group, created_at, members_can_pin
 `
 
 type CreateChatParams struct {
@@ -46,24 +46,33 @@ func (q *Queries) CreateChat(ctx context.Context, arg CreateChatParams) (Chat, e
 		&i.Name,
 		&i.IsGroup,
 		&i.CreatedAt,
+		&i.MembersCanPin,
 	)
 	return i, err
 }
 
 const createMessage = `-- name: CreateMessage :one
-INSERT INTO messages (chat_id, sender_id, content)
-VALUES ($1, $2, $3)
-    RETURNING id, chat_id, sender_id, content, created_at, is_read
+INSERT INTO messages (chat_id, sender_id, content, file_id, kind)
+VALUES ($1, $2, $3, $4, $5)
+    RETURNING id, chat_id, sender_id, content, created_at, is_read, file_id, kind
 `
 
 type CreateMessageParams struct {
 	ChatID   pgtype.UUID `json:"chat_id"`
 	SenderID pgtype.UUID `json:"sender_id"`
 	Content  string      `json:"content"`
+	FileID   pgtype.UUID `json:"file_id"`
+	Kind     string      `json:"kind"`
 }
 
 func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (Message, error) {
-	row := q.db.QueryRow(ctx, createMessage, arg.ChatID, arg.SenderID, arg.Content)
+	row := q.db.QueryRow(ctx, createMessage,
+		arg.ChatID,
+		arg.SenderID,
+		arg.Content,
+		arg.FileID,
+		arg.Kind,
+	)
 	var i Message
 	err := row.Scan(
 		&i.ID,
@@ -72,6 +81,8 @@ func (q *Queries) CreateMessage(ctx context.Context, arg CreateMessageParams) (M
 		&i.Content,
 		&i.CreatedAt,
 		&i.IsRead,
+		&i.FileID,
+		&i.Kind,
 	)
 	return i, err
 }
@@ -82,9 +93,18 @@ SELECT
     m.content,
     m.created_at,
     m.sender_id,
-    u.username as sender_username
+    u.username as sender_username,
+    m.kind,
+    m.file_id,
+    f.file_name,
+    f.content_type as file_content_type,
+    f.size as file_size,
+    f.scan_status as file_scan_status,
+    f.duration_ms as file_duration_ms,
+    f.waveform as file_waveform
 FROM messages m
-         JOIN users u ON m.sender_id = u.id
+         LEFT JOIN users u ON m.sender_id = u.id
+         LEFT JOIN files f ON m.file_id = f.id
 WHERE m.chat_id = $1
 ORDER BY m.created_at DESC
     LIMIT $2 OFFSET $3
@@ -97,11 +117,19 @@ type ListMessagesParams struct {
 }
 
 type ListMessagesRow struct {
-	ID             pgtype.UUID        `json:"id"`
-	Content        string             `json:"content"`
-	CreatedAt      pgtype.Timestamptz `json:"created_at"`
-	SenderID       pgtype.UUID        `json:"sender_id"`
-	SenderUsername string             `json:"sender_username"`
+	ID              pgtype.UUID        `json:"id"`
+	Content         string             `json:"content"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+	SenderID        pgtype.UUID        `json:"sender_id"`
+	SenderUsername  pgtype.Text        `json:"sender_username"`
+	Kind            string             `json:"kind"`
+	FileID          pgtype.UUID        `json:"file_id"`
+	FileName        pgtype.Text        `json:"file_name"`
+	FileContentType pgtype.Text        `json:"file_content_type"`
+	FileSize        pgtype.Int8        `json:"file_size"`
+	FileScanStatus  pgtype.Text        `json:"file_scan_status"`
+	FileDurationMs  pgtype.Int4        `json:"file_duration_ms"`
+	FileWaveform    []byte             `json:"file_waveform"`
 }
 
 func (q *Queries) ListMessages(ctx context.Context, arg ListMessagesParams) ([]ListMessagesRow, error) {
@@ -119,6 +147,14 @@ func (q *Queries) ListMessages(ctx context.Context, arg ListMessagesParams) ([]L
 			&i.CreatedAt,
 			&i.SenderID,
 			&i.SenderUsername,
+			&i.Kind,
+			&i.FileID,
+			&i.FileName,
+			&i.FileContentType,
+			&i.FileSize,
+			&i.FileScanStatus,
+			&i.FileDurationMs,
+			&i.FileWaveform,
 		); err != nil {
 			return nil, err
 		}
@@ -133,7 +169,7 @@ func (q *Queries) ListMessages(ctx context.Context, arg ListMessagesParams) ([]L
 const markMessagesAsRead = `-- name: MarkMessagesAsRead :exec
 UPDATE messages
 SET is_read = TRUE
-WHERE chat_id = $1 AND sender_id != $2 AND is_read = FALSE
+WHERE chat_id = $1 AND sender_id IS DISTINCT FROM $2 AND is_read = FALSE
 `
 
 type MarkMessagesAsReadParams struct {
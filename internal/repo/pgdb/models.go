@@ -8,18 +8,111 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-type Chat struct {
-	ID        pgtype.UUID        `json:"id"`
-	Name      pgtype.Text        `json:"name"`
-	IsGroup   bool               `json:"is_group"`
+type Blob struct {
+	Sha256     string             `json:"sha256"`
+	ObjectKey  string             `json:"object_key"`
+	Size       int64              `json:"size"`
+	RefCount   int32              `json:"ref_count"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	ReleasedAt pgtype.Timestamptz `json:"released_at"`
+}
+
+type Block struct {
+	UserID    pgtype.UUID        `json:"user_id"`
+	BlockedID pgtype.UUID        `json:"blocked_id"`
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
 }
 
+type Chat struct {
+	ID            pgtype.UUID        `json:"id"`
+	Name          pgtype.Text        `json:"name"`
+	IsGroup       bool               `json:"is_group"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	MembersCanPin bool               `json:"members_can_pin"`
+}
+
+type ChatDraft struct {
+	ChatID    pgtype.UUID        `json:"chat_id"`
+	UserID    pgtype.UUID        `json:"user_id"`
+	Content   string             `json:"content"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+}
+
+type ChatFolder struct {
+	ID           pgtype.UUID        `json:"id"`
+	UserID       pgtype.UUID        `json:"user_id"`
+	Name         string             `json:"name"`
+	GroupsOnly   bool               `json:"groups_only"`
+	UnreadOnly   bool               `json:"unread_only"`
+	ExcludeMuted bool               `json:"exclude_muted"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+}
+
+type ChatFolderChat struct {
+	FolderID pgtype.UUID `json:"folder_id"`
+	ChatID   pgtype.UUID `json:"chat_id"`
+}
+
 type ChatMember struct {
-	ChatID   pgtype.UUID        `json:"chat_id"`
-	UserID   pgtype.UUID        `json:"user_id"`
-	Role     string             `json:"role"`
-	JoinedAt pgtype.Timestamptz `json:"joined_at"`
+	ChatID       pgtype.UUID        `json:"chat_id"`
+	UserID       pgtype.UUID        `json:"user_id"`
+	Role         string             `json:"role"`
+	JoinedAt     pgtype.Timestamptz `json:"joined_at"`
+	MutedUntil   pgtype.Timestamptz `json:"muted_until"`
+	Archived     bool               `json:"archived"`
+	PinOrder     pgtype.Int4        `json:"pin_order"`
+	MarkedUnread bool               `json:"marked_unread"`
+}
+
+type Contact struct {
+	UserID    pgtype.UUID        `json:"user_id"`
+	ContactID pgtype.UUID        `json:"contact_id"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type ContactRequest struct {
+	FromUserID pgtype.UUID        `json:"from_user_id"`
+	ToUserID   pgtype.UUID        `json:"to_user_id"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+}
+
+type EmailToken struct {
+	TokenHash string             `json:"token_hash"`
+	UserID    pgtype.UUID        `json:"user_id"`
+	Purpose   string             `json:"purpose"`
+	Email     string             `json:"email"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+type ExternalIdentity struct {
+	Provider  string             `json:"provider"`
+	Subject   string             `json:"subject"`
+	UserID    pgtype.UUID        `json:"user_id"`
+	Email     string             `json:"email"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type File struct {
+	ID           pgtype.UUID        `json:"id"`
+	OwnerID      pgtype.UUID        `json:"owner_id"`
+	ObjectKey    string             `json:"object_key"`
+	FileName     string             `json:"file_name"`
+	ContentType  string             `json:"content_type"`
+	Size         int64              `json:"size"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	Sha256       pgtype.Text        `json:"sha256"`
+	ScanStatus   string             `json:"scan_status"`
+	DurationMs   pgtype.Int4        `json:"duration_ms"`
+	Waveform     []byte             `json:"waveform"`
+	ScanAttempts int32              `json:"scan_attempts"`
+}
+
+type LoginChallenge struct {
+	ID        pgtype.UUID        `json:"id"`
+	UserID    pgtype.UUID        `json:"user_id"`
+	Attempts  int32              `json:"attempts"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
 }
 
 type Message struct {
@@ -29,14 +122,88 @@ type Message struct {
 	Content   string             `json:"content"`
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
 	IsRead    bool               `json:"is_read"`
+	FileID    pgtype.UUID        `json:"file_id"`
+	Kind      string             `json:"kind"`
+}
+
+type PinnedMessage struct {
+	ChatID    pgtype.UUID        `json:"chat_id"`
+	MessageID pgtype.UUID        `json:"message_id"`
+	PinnedBy  pgtype.UUID        `json:"pinned_by"`
+	PinnedAt  pgtype.Timestamptz `json:"pinned_at"`
+}
+
+type RecoveryCode struct {
+	UserID   pgtype.UUID        `json:"user_id"`
+	CodeHash string             `json:"code_hash"`
+	UsedAt   pgtype.Timestamptz `json:"used_at"`
+}
+
+type RefreshToken struct {
+	TokenHash string             `json:"token_hash"`
+	SessionID pgtype.UUID        `json:"session_id"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	UsedAt    pgtype.Timestamptz `json:"used_at"`
+}
+
+type Session struct {
+	ID         pgtype.UUID        `json:"id"`
+	UserID     pgtype.UUID        `json:"user_id"`
+	UserAgent  string             `json:"user_agent"`
+	IpAddress  string             `json:"ip_address"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+}
+
+type Upload struct {
+	ID            pgtype.UUID        `json:"id"`
+	UserID        pgtype.UUID        `json:"user_id"`
+	ObjectKey     string             `json:"object_key"`
+	MinioUploadID string             `json:"minio_upload_id"`
+	FileName      string             `json:"file_name"`
+	ContentType   string             `json:"content_type"`
+	TotalSize     int64              `json:"total_size"`
+	UploadOffset  int64              `json:"upload_offset"`
+	FileID        pgtype.UUID        `json:"file_id"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	ExpiresAt     pgtype.Timestamptz `json:"expires_at"`
+	HashState     []byte             `json:"hash_state"`
+}
+
+type UploadPart struct {
+	UploadID   pgtype.UUID `json:"upload_id"`
+	PartNumber int32       `json:"part_number"`
+	Etag       string      `json:"etag"`
+	Size       int64       `json:"size"`
 }
 
 type User struct {
-	ID           pgtype.UUID        `json:"id"`
-	Username     string             `json:"username"`
-	Email        string             `json:"email"`
-	PasswordHash string             `json:"password_hash"`
-	CreatedAt    pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt    pgtype.Timestamptz `json:"updated_at"`
-	AvatarUrl    pgtype.Text        `json:"avatar_url"`
+	ID                     pgtype.UUID        `json:"id"`
+	Username               string             `json:"username"`
+	Email                  string             `json:"email"`
+	PasswordHash           string             `json:"password_hash"`
+	CreatedAt              pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt              pgtype.Timestamptz `json:"updated_at"`
+	AvatarUrl              pgtype.Text        `json:"avatar_url"`
+	StorageUsed            int64              `json:"storage_used"`
+	AvatarFileID           pgtype.UUID        `json:"avatar_file_id"`
+	EmailVerified          bool               `json:"email_verified"`
+	DisplayName            pgtype.Text        `json:"display_name"`
+	Bio                    pgtype.Text        `json:"bio"`
+	StatusText             pgtype.Text        `json:"status_text"`
+	StatusExpiresAt        pgtype.Timestamptz `json:"status_expires_at"`
+	Discoverable           bool               `json:"discoverable"`
+	ContactsOnlyDms        bool               `json:"contacts_only_dms"`
+	OnlineVisibility       string             `json:"online_visibility"`
+	LastSeenVisibility     string             `json:"last_seen_visibility"`
+	ReadReceiptsVisibility string             `json:"read_receipts_visibility"`
+	LastSeenAt             pgtype.Timestamptz `json:"last_seen_at"`
+}
+
+type UserTotp struct {
+	UserID    pgtype.UUID        `json:"user_id"`
+	Secret    string             `json:"secret"`
+	EnabledAt pgtype.Timestamptz `json:"enabled_at"`
+	LastStep  int64              `json:"last_step"`
 }
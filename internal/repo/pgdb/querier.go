@@ -11,17 +11,172 @@ import (
 )
 
 type Querier interface {
+	// Whether sender may start a direct chat with the user.
+	AcceptsDirectChat(ctx context.Context, arg AcceptsDirectChatParams) (bool, error)
+	AcquireBlob(ctx context.Context, arg AcquireBlobParams) (Blob, error)
+	// Chats the user is not a member of are skipped.
+	AddChatFolderChats(ctx context.Context, arg AddChatFolderChatsParams) (int64, error)
 	AddChatMember(ctx context.Context, arg AddChatMemberParams) error
+	// Both directions, contacts are mutual.
+	AddContact(ctx context.Context, arg AddContactParams) error
+	AddUploadPart(ctx context.Context, arg AddUploadPartParams) error
+	AdvanceUploadOffset(ctx context.Context, arg AdvanceUploadOffsetParams) (int64, error)
+	// Counts the attempt, nothing is returned once they are used up.
+	AttemptLoginChallenge(ctx context.Context, arg AttemptLoginChallengeParams) (LoginChallenge, error)
+	BlockUser(ctx context.Context, arg BlockUserParams) (int64, error)
+	CanAccessFile(ctx context.Context, arg CanAccessFileParams) (bool, error)
+	// Admins always, other members where the chat allows it. Locks the chat,
+	// so concurrent pins can't go over the limit together.
+	CanPinMessages(ctx context.Context, arg CanPinMessagesParams) (bool, error)
+	ChargeStorage(ctx context.Context, arg ChargeStorageParams) (int64, error)
+	ClearAvatarFile(ctx context.Context, avatarFileID pgtype.UUID) error
+	ClearChatFolderChats(ctx context.Context, folderID pgtype.UUID) error
+	ClearMarkedUnread(ctx context.Context, arg ClearMarkedUnreadParams) (ChatMember, error)
+	CompleteUpload(ctx context.Context, arg CompleteUploadParams) error
+	// Deleting makes the token single-use even with concurrent requests.
+	ConsumeEmailToken(ctx context.Context, arg ConsumeEmailTokenParams) (EmailToken, error)
+	CountChatFolders(ctx context.Context, userID pgtype.UUID) (int64, error)
+	CountPinnedChats(ctx context.Context, userID pgtype.UUID) (int64, error)
+	CountPinnedMessages(ctx context.Context, chatID pgtype.UUID) (int64, error)
+	CountUnusedRecoveryCodes(ctx context.Context, userID pgtype.UUID) (int64, error)
 	CreateChat(ctx context.Context, arg CreateChatParams) (Chat, error)
+	CreateChatFolder(ctx context.Context, arg CreateChatFolderParams) (ChatFolder, error)
+	CreateContactRequest(ctx context.Context, arg CreateContactRequestParams) (int64, error)
+	CreateEmailToken(ctx context.Context, arg CreateEmailTokenParams) error
+	CreateExternalIdentity(ctx context.Context, arg CreateExternalIdentityParams) (ExternalIdentity, error)
+	CreateFile(ctx context.Context, arg CreateFileParams) (File, error)
+	CreateLoginChallenge(ctx context.Context, arg CreateLoginChallengeParams) (LoginChallenge, error)
 	CreateMessage(ctx context.Context, arg CreateMessageParams) (Message, error)
+	// The session and its first refresh token in a single statement, so a
+	// failure never leaves a session nobody can refresh.
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
+	CreateUpload(ctx context.Context, arg CreateUploadParams) (Upload, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	DeleteChatFolder(ctx context.Context, arg DeleteChatFolderParams) (int64, error)
+	DeleteCompletedUploads(ctx context.Context, createdAt pgtype.Timestamptz) (int64, error)
+	DeleteContact(ctx context.Context, arg DeleteContactParams) (int64, error)
+	DeleteContactRequest(ctx context.Context, arg DeleteContactRequestParams) (int64, error)
+	DeleteContactRequestsBetween(ctx context.Context, arg DeleteContactRequestsBetweenParams) error
+	DeleteDeadBlob(ctx context.Context, arg DeleteDeadBlobParams) (int64, error)
+	DeleteDraft(ctx context.Context, arg DeleteDraftParams) (int64, error)
+	DeleteExpiredEmailTokens(ctx context.Context, expiresAt pgtype.Timestamptz) (int64, error)
+	DeleteExpiredLoginChallenges(ctx context.Context, expiresAt pgtype.Timestamptz) (int64, error)
+	DeleteExpiredSessions(ctx context.Context) (int64, error)
+	DeleteLoginChallenge(ctx context.Context, id pgtype.UUID) error
+	DeleteOrphanFile(ctx context.Context, id pgtype.UUID) (File, error)
+	DeleteOtherSessions(ctx context.Context, arg DeleteOtherSessionsParams) ([]pgtype.UUID, error)
+	DeleteRecoveryCodes(ctx context.Context, userID pgtype.UUID) error
+	DeleteSession(ctx context.Context, id pgtype.UUID) (Session, error)
+	DeleteTOTP(ctx context.Context, userID pgtype.UUID) error
+	DeleteUpload(ctx context.Context, id pgtype.UUID) error
+	// Files of the user go with it, so the blobs they shared are released in the
+	// same statement. Their messages stay, with sender_id set to NULL.
+	DeleteUser(ctx context.Context, id pgtype.UUID) (User, error)
+	DeleteUserEmailTokens(ctx context.Context, arg DeleteUserEmailTokensParams) error
+	DeleteUserSession(ctx context.Context, arg DeleteUserSessionParams) (int64, error)
+	EnableTOTP(ctx context.Context, arg EnableTOTPParams) (int64, error)
+	GetBlob(ctx context.Context, sha256 string) (Blob, error)
+	GetChatFolder(ctx context.Context, arg GetChatFolderParams) (ChatFolder, error)
+	GetChatMember(ctx context.Context, arg GetChatMemberParams) (ChatMember, error)
 	GetChatMembers(ctx context.Context, chatID pgtype.UUID) ([]pgtype.UUID, error)
+	GetChatMessage(ctx context.Context, arg GetChatMessageParams) (Message, error)
+	GetDraft(ctx context.Context, arg GetDraftParams) (ChatDraft, error)
+	GetExternalIdentity(ctx context.Context, arg GetExternalIdentityParams) (ExternalIdentity, error)
+	GetFileByID(ctx context.Context, id pgtype.UUID) (File, error)
+	// Privacy settings of the user and how the viewer relates to them.
+	GetPresence(ctx context.Context, arg GetPresenceParams) (GetPresenceRow, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
+	GetScanVerdict(ctx context.Context, sha256 pgtype.Text) (string, error)
+	GetSession(ctx context.Context, id pgtype.UUID) (Session, error)
+	GetStorageUsage(ctx context.Context, id pgtype.UUID) (GetStorageUsageRow, error)
+	GetTOTP(ctx context.Context, userID pgtype.UUID) (UserTotp, error)
+	GetUpload(ctx context.Context, arg GetUploadParams) (Upload, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
 	GetUserByID(ctx context.Context, id pgtype.UUID) (User, error)
+	// Whether either user blocked the other.
+	IsBlockedBetween(ctx context.Context, arg IsBlockedBetweenParams) (bool, error)
 	IsChatMember(ctx context.Context, arg IsChatMemberParams) (bool, error)
+	IsContact(ctx context.Context, arg IsContactParams) (bool, error)
+	// Whether the chat is a direct chat, two members, and one of them blocked
+	// the other.
+	IsDirectChatBlocked(ctx context.Context, arg IsDirectChatBlockedParams) (bool, error)
+	// Users the user blocked or was blocked by.
+	ListBlockRelations(ctx context.Context, userID pgtype.UUID) ([]pgtype.UUID, error)
+	ListBlockedUsers(ctx context.Context, userID pgtype.UUID) ([]ListBlockedUsersRow, error)
+	ListChatFolders(ctx context.Context, userID pgtype.UUID) ([]ChatFolder, error)
+	ListChatMembersMuted(ctx context.Context, chatID pgtype.UUID) ([]ListChatMembersMutedRow, error)
+	ListContacts(ctx context.Context, userID pgtype.UUID) ([]ListContactsRow, error)
+	ListDeadBlobs(ctx context.Context, arg ListDeadBlobsParams) ([]Blob, error)
+	ListExpiredUploads(ctx context.Context, limit int32) ([]Upload, error)
+	ListFileRecipients(ctx context.Context, fileID pgtype.UUID) ([]pgtype.UUID, error)
+	ListIncomingContactRequests(ctx context.Context, toUserID pgtype.UUID) ([]ListIncomingContactRequestsRow, error)
 	ListMessages(ctx context.Context, arg ListMessagesParams) ([]ListMessagesRow, error)
+	ListOrphanFiles(ctx context.Context, arg ListOrphanFilesParams) ([]File, error)
+	ListOutgoingContactRequests(ctx context.Context, fromUserID pgtype.UUID) ([]ListOutgoingContactRequestsRow, error)
+	ListPendingFiles(ctx context.Context, limit int32) ([]File, error)
+	// The latest pin first.
+	ListPinnedMessages(ctx context.Context, chatID pgtype.UUID) ([]ListPinnedMessagesRow, error)
+	// Users who share a chat or a contact with the user, except those blocked
+	// either way, and whether they are contacts of the user.
+	ListPresenceWatchers(ctx context.Context, userID pgtype.UUID) ([]ListPresenceWatchersRow, error)
+	// Members of the chat who may learn that the reader read it: the reader,
+	// and the others read_receipts_visibility allows, never across a block.
+	ListReadReceiptRecipients(ctx context.Context, arg ListReadReceiptRecipientsParams) ([]pgtype.UUID, error)
+	ListReferencedObjectKeys(ctx context.Context, keys []string) ([]string, error)
+	ListUploadParts(ctx context.Context, uploadID pgtype.UUID) ([]UploadPart, error)
+	// The inbox or the archive of the user: pinned chats first in the user's
+	// order, then the latest activity first. With folder_id only the chats of
+	// that folder of the user.
+	ListUserChats(ctx context.Context, arg ListUserChatsParams) ([]ListUserChatsRow, error)
+	// The chats listed in every folder of the user.
+	ListUserFolderChats(ctx context.Context, userID pgtype.UUID) ([]ChatFolderChat, error)
+	ListUserSessions(ctx context.Context, userID pgtype.UUID) ([]Session, error)
+	// Until the transaction ends the GC can't delete the blob.
+	LockBlob(ctx context.Context, sha256 string) (Blob, error)
+	// Pin changes of the user wait for each other, so the pin limit holds.
+	LockUserChatMembers(ctx context.Context, userID pgtype.UUID) error
 	MarkMessagesAsRead(ctx context.Context, arg MarkMessagesAsReadParams) error
+	// New pins go on top.
+	NextPinOrder(ctx context.Context, userID pgtype.UUID) (int32, error)
+	PinMessage(ctx context.Context, arg PinMessageParams) (int64, error)
+	// Avatars get their URL once the scan found them clean.
+	PublishAvatarFile(ctx context.Context, arg PublishAvatarFileParams) error
+	// The file stays pending for a retry, until max_attempts make it failed.
+	RecordScanFailure(ctx context.Context, arg RecordScanFailureParams) (File, error)
+	RefundStorage(ctx context.Context, arg RefundStorageParams) error
+	ReleaseBlob(ctx context.Context, sha256 string) error
+	ReplaceRecoveryCodes(ctx context.Context, arg ReplaceRecoveryCodesParams) error
+	// Marks the old token used and issues the new one in a single statement,
+	// so two concurrent refreshes with the same token can't both succeed.
+	RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (pgtype.UUID, error)
+	// Prefix matches rank above fuzzy ones, contacts of the searcher above
+	// everyone else. Users who are not discoverable are only found by their
+	// contacts.
+	SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error)
+	// Only while the user still has the address the link was sent to.
+	SetEmailVerified(ctx context.Context, arg SetEmailVerifiedParams) (int64, error)
+	SetFileScanStatus(ctx context.Context, arg SetFileScanStatusParams) (File, error)
+	SetFileVoice(ctx context.Context, arg SetFileVoiceParams) (File, error)
+	SetPinOrder(ctx context.Context, arg SetPinOrderParams) (ChatMember, error)
+	// Starts over an unconfirmed enrollment, an enabled one is left alone.
+	SetTOTPSecret(ctx context.Context, arg SetTOTPSecretParams) (int64, error)
+	UnblockUser(ctx context.Context, arg UnblockUserParams) (int64, error)
+	UnpinMessage(ctx context.Context, arg UnpinMessageParams) (int64, error)
+	UnpinUserChats(ctx context.Context, userID pgtype.UUID) ([]ChatMember, error)
+	UpdateChatFolder(ctx context.Context, arg UpdateChatFolderParams) (ChatFolder, error)
+	UpdateChatMemberSettings(ctx context.Context, arg UpdateChatMemberSettingsParams) (ChatMember, error)
+	UpdateChatPinPermission(ctx context.Context, arg UpdateChatPinPermissionParams) (Chat, error)
+	UpdateLastSeen(ctx context.Context, id pgtype.UUID) error
+	UpdatePrivacySettings(ctx context.Context, arg UpdatePrivacySettingsParams) error
+	// The URL waits until the file is clean, the scanner publishes it then.
 	UpdateUserAvatar(ctx context.Context, arg UpdateUserAvatarParams) error
+	// The new address was just confirmed through the emailed link.
+	UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) error
+	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
+	UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error)
+	UpsertDraft(ctx context.Context, arg UpsertDraftParams) (ChatDraft, error)
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error)
+	UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -14,7 +14,7 @@ import (
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (username, email, password_hash)
 VALUES ($1, $2, $3)
-    RETURNING id, username, email, password_hash, created_at, updated_at, avatar_url
+    RETURNING id, username, email, password_hash, created_at, updated_at, avatar_url, storage_used, avatar_file_id, email_verified, display_name, bio, status_text, status_expires_at, discoverable, contacts_only_dms, online_visibility, last_seen_visibility, read_receipts_visibility, last_seen_at
 `
 
 type CreateUserParams struct {
@@ -34,12 +34,71 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.AvatarUrl,
+		&i.StorageUsed,
+		&i.AvatarFileID,
+		&i.EmailVerified,
+		&i.DisplayName,
+		&i.Bio,
+		&i.StatusText,
+		&i.StatusExpiresAt,
+		&i.Discoverable,
+		&i.ContactsOnlyDms,
+		&i.OnlineVisibility,
+		&i.LastSeenVisibility,
+		&i.ReadReceiptsVisibility,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
+
+const deleteUser = `-- name: DeleteUser :one
+WITH released AS (
+    UPDATE blobs b
+    SET ref_count   = b.ref_count - f.files,
+        released_at = CASE WHEN b.ref_count - f.files <= 0 THEN now() END
+    FROM (SELECT sha256, count(*) AS files
+          FROM files
+          WHERE owner_id = $1 AND sha256 IS NOT NULL
+          GROUP BY sha256) f
+    WHERE b.sha256 = f.sha256
+)
+DELETE FROM users
+WHERE id = $1
+    RETURNING id, username, email, password_hash, created_at, updated_at, avatar_url, storage_used, avatar_file_id, email_verified, display_name, bio, status_text, status_expires_at, discoverable, contacts_only_dms, online_visibility, last_seen_visibility, read_receipts_visibility, last_seen_at
+`
+
+// Files of the user go with it, so the blobs they shared are released in the
+// same statement. Their messages stay, with sender_id set to NULL.
+func (q *Queries) DeleteUser(ctx context.Context, id pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, deleteUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.AvatarUrl,
+		&i.StorageUsed,
+		&i.AvatarFileID,
+		&i.EmailVerified,
+		&i.DisplayName,
+		&i.Bio,
+		&i.StatusText,
+		&i.StatusExpiresAt,
+		&i.Discoverable,
+		&i.ContactsOnlyDms,
+		&i.OnlineVisibility,
+		&i.LastSeenVisibility,
+		&i.ReadReceiptsVisibility,
+		&i.LastSeenAt,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, username, email, password_hash, created_at, updated_at, avatar_url FROM users
+SELECT id, username, email, password_hash, created_at, updated_at, avatar_url, storage_used, avatar_file_id, email_verified, display_name, bio, status_text, status_expires_at, discoverable, contacts_only_dms, online_visibility, last_seen_visibility, read_receipts_visibility, last_seen_at FROM users
 WHERE email = $1 LIMIT 1
 `
 
@@ -54,12 +113,25 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.AvatarUrl,
+		&i.StorageUsed,
+		&i.AvatarFileID,
+		&i.EmailVerified,
+		&i.DisplayName,
+		&i.Bio,
+		&i.StatusText,
+		&i.StatusExpiresAt,
+		&i.Discoverable,
+		&i.ContactsOnlyDms,
+		&i.OnlineVisibility,
+		&i.LastSeenVisibility,
+		&i.ReadReceiptsVisibility,
+		&i.LastSeenAt,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, username, email, password_hash, created_at, updated_at, avatar_url FROM users
+SELECT id, username, email, password_hash, created_at, updated_at, avatar_url, storage_used, avatar_file_id, email_verified, display_name, bio, status_text, status_expires_at, discoverable, contacts_only_dms, online_visibility, last_seen_visibility, read_receipts_visibility, last_seen_at FROM users
 WHERE id = $1 LIMIT 1
 `
 
@@ -74,22 +146,228 @@ func (q *Queries) GetUserByID(ctx context.Context, id pgtype.UUID) (User, error)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.AvatarUrl,
+		&i.StorageUsed,
+		&i.AvatarFileID,
+		&i.EmailVerified,
+		&i.DisplayName,
+		&i.Bio,
+		&i.StatusText,
+		&i.StatusExpiresAt,
+		&i.Discoverable,
+		&i.ContactsOnlyDms,
+		&i.OnlineVisibility,
+		&i.LastSeenVisibility,
+		&i.ReadReceiptsVisibility,
+		&i.LastSeenAt,
 	)
 	return i, err
 }
 
+const searchUsers = `-- name: SearchUsers :many
+SELECT
+    u.id,
+    u.username,
+    u.display_name,
+    u.avatar_url,
+    (c.contact_id IS NOT NULL)::boolean AS is_contact
+FROM users u
+         LEFT JOIN contacts c ON c.user_id = $1 AND c.contact_id = u.id
+WHERE u.id <> $1
+  AND (u.discoverable OR c.contact_id IS NOT NULL)
+  AND (lower(u.username) LIKE $2::text
+    OR lower(u.display_name) LIKE $2::text
+    OR lower(u.username) % $3::text
+    OR lower(u.display_name) % $3::text)
+ORDER BY is_contact DESC,
+         (lower(u.username) LIKE $2::text
+             OR coalesce(lower(u.display_name), '') LIKE $2::text) DESC,
+         GREATEST(similarity(lower(u.username), $3::text),
+                  similarity(coalesce(lower(u.display_name), ''), $3::text)) DESC,
+         u.username
+    LIMIT $4 OFFSET $5
+`
+
+type SearchUsersParams struct {
+	SearcherID pgtype.UUID `json:"searcher_id"`
+	Prefix     string      `json:"prefix"`
+	Query      string      `json:"query"`
+	PageLimit  int32       `json:"page_limit"`
+	PageOffset int32       `json:"page_offset"`
+}
+
+type SearchUsersRow struct {
+	ID          pgtype.UUID `json:"id"`
+	Username    string      `json:"username"`
+	DisplayName pgtype.Text `json:"display_name"`
+	AvatarUrl   pgtype.Text `json:"avatar_url"`
+	IsContact   bool        `json:"is_contact"`
+}
+
+// Prefix matches rank above fuzzy ones, contacts of the searcher above
+// everyone else. Users who are not discoverable are only found by their
+// contacts.
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error) {
+	rows, err := q.db.Query(ctx, searchUsers,
+		arg.SearcherID,
+		arg.Prefix,
+		arg.Query,
+		arg.PageLimit,
+		arg.PageOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchUsersRow
+	for rows.Next() {
+		var i SearchUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.DisplayName,
+			&i.AvatarUrl,
+			&i.IsContact,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setEmailVerified = `-- name: SetEmailVerified :execrows
+UPDATE users
+SET email_verified = true
+WHERE id = $1 AND email = $2
+`
+
+type SetEmailVerifiedParams struct {
+	ID    pgtype.UUID `json:"id"`
+	Email string      `json:"email"`
+}
+
+// Only while the user still has the address the link was sent to.
+func (q *Queries) SetEmailVerified(ctx context.Context, arg SetEmailVerifiedParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setEmailVerified, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateUserAvatar = `-- name: UpdateUserAvatar :exec
 UPDATE users
-SET avatar_url = $2
+SET avatar_url     = CASE WHEN (SELECT scan_status FROM files WHERE id = $3) = 'clean' THEN $2 END,
+    avatar_file_id = $3
 WHERE id = $1
 `
 
 type UpdateUserAvatarParams struct {
-	ID        pgtype.UUID `json:"id"`
-	AvatarUrl pgtype.Text `json:"avatar_url"`
+	ID           pgtype.UUID `json:"id"`
+	AvatarUrl    pgtype.Text `json:"avatar_url"`
+	AvatarFileID pgtype.UUID `json:"avatar_file_id"`
 }
 
+// The URL waits until the file is clean, the scanner publishes it then.
 func (q *Queries) UpdateUserAvatar(ctx context.Context, arg UpdateUserAvatarParams) error {
-	_, err := q.db.Exec(ctx, updateUserAvatar, arg.ID, arg.AvatarUrl)
+	_, err := q.db.Exec(ctx, updateUserAvatar, arg.ID, arg.AvatarUrl, arg.AvatarFileID)
 	return err
 }
+
+const updateUserEmail = `-- name: UpdateUserEmail :exec
+UPDATE users
+SET email          = $2,
+    email_verified = true,
+    updated_at     = now()
+WHERE id = $1
+`
+
+type UpdateUserEmailParams struct {
+	ID    pgtype.UUID `json:"id"`
+	Email string      `json:"email"`
+}
+
+// The new address was just confirmed through the emailed link.
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) error {
+	_, err := q.db.Exec(ctx, updateUserEmail, arg.ID, arg.Email)
+	return err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET password_hash = $2,
+    updated_at    = now()
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID           pgtype.UUID `json:"id"`
+	PasswordHash string      `json:"password_hash"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.Exec(ctx, updateUserPassword, arg.ID, arg.PasswordHash)
+	return err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET display_name      = $2,
+    bio               = $3,
+    status_text       = $4,
+    status_expires_at = $5,
+    discoverable      = $6,
+    contacts_only_dms = $7,
+    updated_at        = now()
+WHERE id = $1
+    RETURNING id, username, email, password_hash, created_at, updated_at, avatar_url, storage_used, avatar_file_id, email_verified, display_name, bio, status_text, status_expires_at, discoverable, contacts_only_dms, online_visibility, last_seen_visibility, read_receipts_visibility, last_seen_at
+`
+
+type UpdateUserProfileParams struct {
+	ID              pgtype.UUID        `json:"id"`
+	DisplayName     pgtype.Text        `json:"display_name"`
+	Bio             pgtype.Text        `json:"bio"`
+	StatusText      pgtype.Text        `json:"status_text"`
+	StatusExpiresAt pgtype.Timestamptz `json:"status_expires_at"`
+	Discoverable    bool               `json:"discoverable"`
+	ContactsOnlyDms bool               `json:"contacts_only_dms"`
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserProfile,
+		arg.ID,
+		arg.DisplayName,
+		arg.Bio,
+		arg.StatusText,
+		arg.StatusExpiresAt,
+		arg.Discoverable,
+		arg.ContactsOnlyDms,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.AvatarUrl,
+		&i.StorageUsed,
+		&i.AvatarFileID,
+		&i.EmailVerified,
+		&i.DisplayName,
+		&i.Bio,
+		&i.StatusText,
+		&i.StatusExpiresAt,
+		&i.Discoverable,
+		&i.ContactsOnlyDms,
+		&i.OnlineVisibility,
+		&i.LastSeenVisibility,
+		&i.ReadReceiptsVisibility,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	purposeVerifyEmail   = "verify_email"
+	purposeResetPassword = "reset_password"
+	purposeChangeEmail   = "change_email"
+
+	defaultVerificationTTL  = 48 * time.Hour
+	defaultPasswordResetTTL = time.Hour
+)
+
+var (
+	ErrInvalidEmailToken    = errors.New("invalid or expired link")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+	ErrWrongPassword        = errors.New("wrong password")
+	ErrEmailTaken           = errors.New("email is already taken")
+)
+
+// SetMailer - without it no emails are sent. Links point to linkBaseURL.
+func (s *UserService) SetMailer(mailer Mailer, linkBaseURL string) {
+	s.mailer = mailer
+	s.linkBaseURL = linkBaseURL
+}
+
+// SendVerificationEmail - a link proving the user owns user.Email
+func (s *UserService) SendVerificationEmail(ctx context.Context, user *pgdb.User) error {
+	token, err := s.issueEmailToken(ctx, user, purposeVerifyEmail, s.verificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.sendEmail(ctx, Email{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("Hi %s,\n\nconfirm your email address by opening this link:\n\n%s\n\n"+
+			"The link expires in %s. If you didn't sign up, ignore this email.\n",
+			user.Username, s.link("/verify-email", token), s.verificationTTL),
+	})
+}
+
+// ResendVerificationEmail - for users who lost the first one
+func (s *UserService) ResendVerificationEmail(ctx context.Context, userID string) error {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+	return s.SendVerificationEmail(ctx, user)
+}
+
+// VerifyEmail - consumes the link from SendVerificationEmail
+func (s *UserService) VerifyEmail(ctx context.Context, token string) error {
+	emailToken, err := s.consumeEmailToken(ctx, token, purposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+
+	verified, err := s.repo.SetEmailVerified(ctx, pgdb.SetEmailVerifiedParams{
+		ID:    emailToken.UserID,
+		Email: emailToken.Email,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+	if verified == 0 {
+		return ErrInvalidEmailToken // the address changed since
+	}
+	return nil
+}
+
+// RequestPasswordReset - unknown addresses are not reported, so the
+// endpoint can't be used to find out who is registered
+func (s *UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	token, err := s.issueEmailToken(ctx, &user, purposeResetPassword, s.passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.sendEmail(ctx, Email{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nset a new password by opening this link:\n\n%s\n\n"+
+			"The link expires in %s. If you didn't ask for it, ignore this email.\n",
+			user.Username, s.link("/reset-password", token), s.passwordResetTTL),
+	})
+}
+
+// ResetPassword - sets the new password and logs the user out everywhere
+func (s *UserService) ResetPassword(ctx context.Context, token, password string) error {
+	// 1. Link
+	emailToken, err := s.consumeEmailToken(ctx, token, purposeResetPassword)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, emailToken.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.Email != emailToken.Email {
+		return ErrInvalidEmailToken // sent to an address the user no longer has
+	}
+
+	// 2. Password
+	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	err = s.repo.UpdateUserPassword(ctx, pgdb.UpdateUserPasswordParams{
+		ID:           user.ID,
+		PasswordHash: string(passHash),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	// 3. Other links, sessions and tokens
+	err = s.repo.DeleteUserEmailTokens(ctx, pgdb.DeleteUserEmailTokensParams{
+		UserID:  user.ID,
+		Purpose: purposeResetPassword,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete reset tokens: %w", err)
+	}
+
+	// the link reached the inbox, that proves the address as well
+	if _, err := s.repo.SetEmailVerified(ctx, pgdb.SetEmailVerifiedParams{ID: user.ID, Email: user.Email}); err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	return s.RevokeAllTokens(ctx, user.ID)
+}
+
+// ChangePassword - needs the current password, if any. The session it was changed
+// from stays, every other one ends.
+func (s *UserService) ChangePassword(ctx context.Context, userID, currentSessionID, current, password string) error {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := checkPassword(user, current); err != nil {
+		return err
+	}
+
+	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	err = s.repo.UpdateUserPassword(ctx, pgdb.UpdateUserPasswordParams{
+		ID:           user.ID,
+		PasswordHash: string(passHash),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	// reset links were asked for with the old password in mind
+	err = s.repo.DeleteUserEmailTokens(ctx, pgdb.DeleteUserEmailTokensParams{
+		UserID:  user.ID,
+		Purpose: purposeResetPassword,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete reset tokens: %w", err)
+	}
+
+	_, err = s.RevokeOtherSessions(ctx, userID, currentSessionID)
+	return err
+}
+
+// RequestEmailChange - the address changes once the link sent to it is
+// opened, the current address only gets a notice
+func (s *UserService) RequestEmailChange(ctx context.Context, userID, password, newEmail string) error {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := checkPassword(user, password); err != nil {
+		return err
+	}
+
+	// 1. Address
+	if newEmail == user.Email {
+		return ErrEmailTaken
+	}
+	if _, err := s.repo.GetUserByEmail(ctx, newEmail); err == nil {
+		return ErrEmailTaken
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// 2. Link to the new address
+	target := *user
+	target.Email = newEmail
+	token, err := s.issueEmailToken(ctx, &target, purposeChangeEmail, s.verificationTTL)
+	if err != nil {
+		return err
+	}
+
+	err = s.sendEmail(ctx, Email{
+		To:      newEmail,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf("Hi %s,\n\nconfirm %s as your new email address by opening this link:\n\n%s\n\n"+
+			"The link expires in %s. If you didn't ask for it, ignore this email.\n",
+			user.Username, newEmail, s.link("/confirm-email", token), s.verificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	// 3. Notice to the current one
+	return s.sendEmail(ctx, Email{
+		To:      user.Email,
+		Subject: "Your email is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nsomeone asked to change the email of your account to %s. "+
+			"If it wasn't you, change your password.\n", user.Username, newEmail),
+	})
+}
+
+// ConfirmEmailChange - consumes the link from RequestEmailChange
+func (s *UserService) ConfirmEmailChange(ctx context.Context, token string) error {
+	emailToken, err := s.consumeEmailToken(ctx, token, purposeChangeEmail)
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.UpdateUserEmail(ctx, pgdb.UpdateUserEmailParams{
+		ID:    emailToken.UserID,
+		Email: emailToken.Email,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrEmailTaken // registered after the link was sent
+		}
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+	return nil
+}
+
+// DeleteAccount - needs the password, if any. The user's files, sessions and
+// memberships go with the account, their messages stay in the chats
+// without a sender.
+func (s *UserService) DeleteAccount(ctx context.Context, userID, password string) error {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := checkPassword(user, password); err != nil {
+		return err
+	}
+
+	if _, err := s.repo.DeleteUser(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	// access tokens outlive the sessions, and open sockets get closed
+	return s.RevokeAllTokens(ctx, user.ID)
+}
+
+// checkPassword - accounts provisioned by SSO have no password to confirm
+// with, the provider's login stands in for it
+func checkPassword(user *pgdb.User, password string) error {
+	if user.PasswordHash == "" {
+		return nil
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+func (s *UserService) issueEmailToken(ctx context.Context, user *pgdb.User, purpose string, ttl time.Duration) (string, error) {
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.repo.CreateEmailToken(ctx, pgdb.CreateEmailTokenParams{
+		TokenHash: tokenHash,
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		ExpiresAt: pgtype.Timestamptz{Time: s.now().Add(ttl), Valid: true},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create email token: %w", err)
+	}
+	return token, nil
+}
+
+func (s *UserService) consumeEmailToken(ctx context.Context, token, purpose string) (*pgdb.EmailToken, error) {
+	emailToken, err := s.repo.ConsumeEmailToken(ctx, pgdb.ConsumeEmailTokenParams{
+		TokenHash: hashToken(token),
+		Purpose:   purpose,
+		Now:       pgtype.Timestamptz{Time: s.now(), Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidEmailToken
+		}
+		return nil, fmt.Errorf("failed to consume email token: %w", err)
+	}
+	return &emailToken, nil
+}
+
+func (s *UserService) sendEmail(ctx context.Context, email Email) error {
+	if s.mailer == nil {
+		slog.Warn("no mailer configured, email dropped", "subject", email.Subject)
+		return nil
+	}
+	if err := s.mailer.Send(ctx, email); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+func (s *UserService) link(path, token string) string {
+	return s.linkBaseURL + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// WaveformBars - number of amplitude samples a voice note is reduced to
+const WaveformBars = 64
+
+var ErrUnsupportedAudio = errors.New("unsupported audio, expected WAV or Ogg/Opus")
+
+// AudioInfo - what clients need to render a voice note before playback
+type AudioInfo struct {
+	ContentType string
+	Duration    time.Duration
+	Waveform    []byte // peak amplitude per bar, 0-255. Nil if the codec isn't decoded (Opus).
+}
+
+// AnalyzeAudio - detects the container by its magic bytes and reads its metadata.
+// The reader is left at an unspecified position.
+func AnalyzeAudio(r io.ReadSeeker) (*AudioInfo, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, ErrUnsupportedAudio
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind audio: %w", err)
+	}
+
+	switch string(magic[:]) {
+	case "RIFF":
+		return analyzeWAV(bufio.NewReader(r))
+	case "OggS":
+		return analyzeOgg(bufio.NewReader(r))
+	default:
+		return nil, ErrUnsupportedAudio
+	}
+}
+
+// WAV format tags
+const (
+	wavPCM        = 0x0001
+	wavFloat      = 0x0003
+	wavExtensible = 0xFFFE
+)
+
+// maxWAVChannels - 7.1 surround, more isn't a voice message
+const maxWAVChannels = 8
+
+// maxAudioDuration - longer recordings are rejected, so durations can't
+// overflow time.Duration or the duration_ms column
+const maxAudioDuration = time.Hour
+
+type wavFormat struct {
+	AudioFormat   uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+}
+
+// analyzeWAV - RIFF chunks until "data", which is decoded to build the waveform
+func analyzeWAV(r *bufio.Reader) (*AudioInfo, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || string(header[8:]) != "WAVE" {
+		return nil, fmt.Errorf("%w: not a WAVE file", ErrUnsupportedAudio)
+	}
+
+	var format *wavFormat
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, fmt.Errorf("%w: no data chunk", ErrUnsupportedAudio)
+		}
+		id := string(chunk[:4])
+		size := binary.LittleEndian.Uint32(chunk[4:])
+
+		switch id {
+		case "fmt ":
+			f, err := readWAVFormat(r, size)
+			if err != nil {
+				return nil, err
+			}
+			format = f
+		case "data":
+			if format == nil {
+				return nil, fmt.Errorf("%w: data before fmt chunk", ErrUnsupportedAudio)
+			}
+			return readWAVData(r, size, format)
+		default:
+			// chunks are padded to an even size
+			if _, err := r.Discard(int(size) + int(size&1)); err != nil {
+				return nil, fmt.Errorf("%w: truncated chunk %q", ErrUnsupportedAudio, id)
+			}
+		}
+	}
+}
+
+func readWAVFormat(r *bufio.Reader, size uint32) (*wavFormat, error) {
+	if size < 16 || size > 1024 {
+		return nil, fmt.Errorf("%w: bad fmt chunk", ErrUnsupportedAudio)
+	}
+	raw := make([]byte, size+size&1)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, fmt.Errorf("%w: truncated fmt chunk", ErrUnsupportedAudio)
+	}
+
+	format := &wavFormat{
+		AudioFormat:   binary.LittleEndian.Uint16(raw[0:]),
+		Channels:      binary.LittleEndian.Uint16(raw[2:]),
+		SampleRate:    binary.LittleEndian.Uint32(raw[4:]),
+		ByteRate:      binary.LittleEndian.Uint32(raw[8:]),
+		BlockAlign:    binary.LittleEndian.Uint16(raw[12:]),
+		BitsPerSample: binary.LittleEndian.Uint16(raw[14:]),
+	}
+	// the real format tag is the beginning of the sub-format GUID
+	if format.AudioFormat == wavExtensible && size >= 40 {
+		format.AudioFormat = binary.LittleEndian.Uint16(raw[24:])
+	}
+
+	bits := format.BitsPerSample
+	switch {
+	case format.AudioFormat == wavPCM && (bits == 8 || bits == 16 || bits == 24 || bits == 32):
+	case format.AudioFormat == wavFloat && bits == 32:
+	default:
+		return nil, fmt.Errorf("%w: wav format %#x with %d bits", ErrUnsupportedAudio, format.AudioFormat, bits)
+	}
+	// in int, uint16 wraps around for thousands of channels
+	channels := int(format.Channels)
+	if channels == 0 || channels > maxWAVChannels || format.SampleRate == 0 ||
+		format.BlockAlign == 0 || int(format.BlockAlign) != channels*int(bits)/8 {
+		return nil, fmt.Errorf("%w: inconsistent wav format", ErrUnsupportedAudio)
+	}
+	return format, nil
+}
+
+func readWAVData(r *bufio.Reader, size uint32, format *wavFormat) (*AudioInfo, error) {
+	blockAlign := int(format.BlockAlign)
+	frames := int(size) / blockAlign
+	if frames == 0 {
+		return nil, fmt.Errorf("%w: no samples", ErrUnsupportedAudio)
+	}
+	if int64(frames) > int64(maxAudioDuration/time.Second)*int64(format.SampleRate) {
+		return nil, fmt.Errorf("%w: longer than %v", ErrUnsupportedAudio, maxAudioDuration)
+	}
+
+	// peak of every bar, frames are spread evenly over the bars
+	var peaks [WaveformBars]float64
+	sampleSize := int(format.BitsPerSample / 8)
+	buf := make([]byte, blockAlign*4096)
+
+	for frame := 0; frame < frames; {
+		n := min(frames-frame, len(buf)/blockAlign)
+		if _, err := io.ReadFull(r, buf[:n*blockAlign]); err != nil {
+			return nil, fmt.Errorf("%w: truncated data chunk", ErrUnsupportedAudio)
+		}
+
+		for i := 0; i < n; i++ {
+			bar := (frame + i) * WaveformBars / frames
+			block := buf[i*blockAlign : (i+1)*blockAlign]
+
+			for ch := 0; ch < int(format.Channels); ch++ {
+				amplitude := wavSample(block[ch*sampleSize:(ch+1)*sampleSize], format.AudioFormat)
+				peaks[bar] = max(peaks[bar], amplitude)
+			}
+		}
+		frame += n
+	}
+
+	return &AudioInfo{
+		ContentType: "audio/wav",
+		Duration:    time.Duration(frames) * time.Second / time.Duration(format.SampleRate),
+		Waveform:    normalizeWaveform(peaks[:]),
+	}, nil
+}
+
+// wavSample - absolute amplitude in [0, 1]
+func wavSample(b []byte, audioFormat uint16) float64 {
+	var v float64
+	switch {
+	case audioFormat == wavFloat:
+		v = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case len(b) == 1: // 8 bit is unsigned
+		v = (float64(b[0]) - 128) / 128
+	case len(b) == 2:
+		v = float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case len(b) == 3:
+		v = float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / (1 << 23)
+	case len(b) == 4:
+		v = float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+	if math.IsNaN(v) {
+		return 0
+	}
+	return min(math.Abs(v), 1)
+}
+
+// normalizeWaveform - scales the bars so the loudest one is 255,
+// quiet recordings would look flat otherwise
+func normalizeWaveform(peaks []float64) []byte {
+	loudest := 0.0
+	for _, p := range peaks {
+		loudest = max(loudest, p)
+	}
+
+	waveform := make([]byte, len(peaks))
+	if loudest == 0 {
+		return waveform
+	}
+	for i, p := range peaks {
+		waveform[i] = byte(math.Round(p / loudest * 255))
+	}
+	return waveform
+}
+
+// Opus always runs at 48 kHz, granule positions count samples at this rate (RFC 7845)
+const opusSampleRate = 48000
+
+// analyzeOgg - duration of an Ogg/Opus stream from the granule position of its
+// last page. Decoding Opus is out of scope, so there is no waveform.
+func analyzeOgg(r *bufio.Reader) (*AudioInfo, error) {
+	var (
+		serial      uint32
+		preSkip     uint64
+		lastGranule int64
+		found       bool
+	)
+
+	for {
+		// page header: "OggS", version, type, granule, serial, sequence, crc, segments
+		var header [27]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) && found {
+				break
+			}
+			return nil, fmt.Errorf("%w: truncated ogg page", ErrUnsupportedAudio)
+		}
+		if string(header[:4]) != "OggS" {
+			return nil, fmt.Errorf("%w: bad ogg page", ErrUnsupportedAudio)
+		}
+		granule := int64(binary.LittleEndian.Uint64(header[6:]))
+		pageSerial := binary.LittleEndian.Uint32(header[14:])
+
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return nil, fmt.Errorf("%w: truncated ogg page", ErrUnsupportedAudio)
+		}
+		bodySize := 0
+		for _, s := range segments {
+			bodySize += int(s)
+		}
+
+		// the first page of the stream carries the identification header
+		if !found {
+			body := make([]byte, bodySize)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, fmt.Errorf("%w: truncated ogg page", ErrUnsupportedAudio)
+			}
+			if len(body) < 19 || string(body[:8]) != "OpusHead" {
+				return nil, fmt.Errorf("%w: ogg stream is not opus", ErrUnsupportedAudio)
+			}
+			serial = pageSerial
+			preSkip = uint64(binary.LittleEndian.Uint16(body[10:]))
+			found = true
+			continue
+		}
+
+		if _, err := r.Discard(bodySize); err != nil {
+			return nil, fmt.Errorf("%w: truncated ogg page", ErrUnsupportedAudio)
+		}
+		// -1 - no packet ends on this page
+		if pageSerial == serial && granule != -1 {
+			lastGranule = granule
+		}
+	}
+
+	samples := lastGranule - int64(preSkip)
+	if samples <= 0 {
+		return nil, fmt.Errorf("%w: no audio in ogg stream", ErrUnsupportedAudio)
+	}
+	if samples > int64(maxAudioDuration/time.Second)*opusSampleRate {
+		return nil, fmt.Errorf("%w: longer than %v", ErrUnsupportedAudio, maxAudioDuration)
+	}
+
+	return &AudioInfo{
+		ContentType: "audio/ogg",
+		Duration:    time.Duration(samples) * time.Second / opusSampleRate,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	ErrBlockSelf  = errors.New("cannot block yourself")
+	ErrNotBlocked = errors.New("user is not blocked")
+	ErrBlocked    = errors.New("one of the users blocked the other")
+)
+
+// BlockUser - also ends the contact and drops contact requests between the two
+func (s *ContactService) BlockUser(ctx context.Context, userID, targetID string) error {
+	userUUID, targetUUID, err := userPair(userID, targetID, ErrBlockSelf)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.repo.WithTx(tx)
+
+	// blocking twice is a no-op
+	if _, err := qtx.BlockUser(ctx, pgdb.BlockUserParams{UserID: userUUID, BlockedID: targetUUID}); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+
+	if _, err := qtx.DeleteContact(ctx, pgdb.DeleteContactParams{UserID: userUUID, ContactID: targetUUID}); err != nil {
+		return fmt.Errorf("failed to delete contact: %w", err)
+	}
+	err = qtx.DeleteContactRequestsBetween(ctx, pgdb.DeleteContactRequestsBetweenParams{UserID: userUUID, OtherID: targetUUID})
+	if err != nil {
+		return fmt.Errorf("failed to delete contact requests: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// UnblockUser - the contact is not restored
+func (s *ContactService) UnblockUser(ctx context.Context, userID, targetID string) error {
+	userUUID, targetUUID, err := userPair(userID, targetID, ErrBlockSelf)
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.repo.UnblockUser(ctx, pgdb.UnblockUserParams{UserID: userUUID, BlockedID: targetUUID})
+	if err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+	if removed == 0 {
+		return ErrNotBlocked
+	}
+	return nil
+}
+
+func (s *ContactService) ListBlocked(ctx context.Context, userID string) ([]pgdb.ListBlockedUsersRow, error) {
+	var userUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	blocked, err := s.repo.ListBlockedUsers(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blocked users: %w", err)
+	}
+	return blocked, nil
+}
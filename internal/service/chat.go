@@ -2,16 +2,24 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var ErrContactsOnly = errors.New("user only accepts direct chats from contacts")
+
 type ChatService struct {
 	repo *pgdb.Queries
 	pool *pgxpool.Pool
+
+	onSettingsChanged func(ctx context.Context, member *pgdb.ChatMember)
+	onDraftChanged    func(ctx context.Context, draft *pgdb.ChatDraft, sessionID string)
+	onPinChanged      func(ctx context.Context, msg *pgdb.Message)
 }
 
 func NewChatService(repo *pgdb.Queries, pool *pgxpool.Pool) *ChatService {
@@ -30,6 +38,10 @@ func (s *ChatService) CreateChat(ctx context.Context, name string, creatorID str
 
 	qtx := s.repo.WithTx(tx)
 
+	if err := s.checkDirectChat(ctx, qtx, creatorID, userIDs); err != nil {
+		return nil, err
+	}
+
 	isGroup := name != ""
 
 	chatParams := pgdb.CreateChatParams{
@@ -83,6 +95,57 @@ func (s *ChatService) CreateChat(ctx context.Context, name string, creatorID str
 	return &chat, nil
 }
 
+// checkDirectChat - a chat with one other member is a direct chat, whatever
+// its name. None between users who blocked each other, and users with
+// contacts_only_dms only take them from contacts.
+func (s *ChatService) checkDirectChat(ctx context.Context, qtx *pgdb.Queries, creatorID string, userIDs []string) error {
+	others := make(map[string]struct{}, len(userIDs))
+	for _, uid := range userIDs {
+		if uid != creatorID {
+			others[uid] = struct{}{}
+		}
+	}
+	if len(others) != 1 {
+		return nil
+	}
+
+	var creatorUUID, partnerUUID pgtype.UUID
+	if err := creatorUUID.Scan(creatorID); err != nil {
+		return fmt.Errorf("invalid creator UUID: %w", err)
+	}
+	for uid := range others {
+		if err := partnerUUID.Scan(uid); err != nil {
+			return fmt.Errorf("invalid member UUID %s: %w", uid, err)
+		}
+	}
+
+	blocked, err := qtx.IsBlockedBetween(ctx, pgdb.IsBlockedBetweenParams{
+		UserID:  creatorUUID,
+		OtherID: partnerUUID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check blocks: %w", err)
+	}
+	if blocked {
+		return ErrBlocked
+	}
+
+	accepts, err := qtx.AcceptsDirectChat(ctx, pgdb.AcceptsDirectChatParams{
+		SenderID: creatorUUID,
+		UserID:   partnerUUID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("failed to check direct chat: %w", err)
+	}
+	if !accepts {
+		return ErrContactsOnly
+	}
+	return nil
+}
+
 // GetMessages - return chat history with pagination
 func (s *ChatService) GetMessages(ctx context.Context, chatID string, userID string, limit, offset int) ([]pgdb.ListMessagesRow, error) {
 	var ChatUUID pgtype.UUID
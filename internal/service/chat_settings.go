@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const maxPinnedChats = 10
+
+var (
+	ErrChatNotFound        = errors.New("chat not found")
+	ErrTooManyPinned       = fmt.Errorf("at most %d chats can be pinned", maxPinnedChats)
+	ErrInvalidChatSettings = errors.New("invalid chat settings")
+)
+
+// ChatSettingsUpdate - nil fields stay as they are
+type ChatSettingsUpdate struct {
+	MutedUntil   *pgtype.Timestamptz // not Valid unmutes
+	Archived     *bool               // archiving unpins
+	Pinned       *bool
+	MarkedUnread *bool
+}
+
+// OnSettingsChanged - fn is told about every change of a member's settings,
+// so the user's devices can follow
+func (s *ChatService) OnSettingsChanged(fn func(ctx context.Context, member *pgdb.ChatMember)) {
+	s.onSettingsChanged = fn
+}
+
+// ListChats - the inbox of the user, or the archive, with a folderID only
+// the chats of that folder
+func (s *ChatService) ListChats(ctx context.Context, userID string, archived bool, folderID string) ([]pgdb.ListUserChatsRow, error) {
+	var userUUID, folderUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	if folderID != "" {
+		if err := folderUUID.Scan(folderID); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFolderNotFound, err)
+		}
+		_, err := s.repo.GetChatFolder(ctx, pgdb.GetChatFolderParams{ID: folderUUID, UserID: userUUID})
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, ErrFolderNotFound
+			}
+			return nil, fmt.Errorf("failed to get folder: %w", err)
+		}
+	}
+
+	chats, err := s.repo.ListUserChats(ctx, pgdb.ListUserChatsParams{
+		UserID:   userUUID,
+		Archived: archived,
+		FolderID: folderUUID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chats: %w", err)
+	}
+	return chats, nil
+}
+
+func (s *ChatService) GetSettings(ctx context.Context, userID, chatID string) (*pgdb.ChatMember, error) {
+	chatUUID, userUUID, err := memberKey(userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := s.repo.GetChatMember(ctx, pgdb.GetChatMemberParams{ChatID: chatUUID, UserID: userUUID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrChatNotFound
+		}
+		return nil, fmt.Errorf("failed to get chat member: %w", err)
+	}
+	return &member, nil
+}
+
+// UpdateSettings - changes how the chat shows up for the user
+func (s *ChatService) UpdateSettings(ctx context.Context, userID, chatID string, update ChatSettingsUpdate) (*pgdb.ChatMember, error) {
+	chatUUID, userUUID, err := memberKey(userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.repo.WithTx(tx)
+
+	// before the pinned chats are counted, a concurrent pin waits for us
+	if err := qtx.LockUserChatMembers(ctx, userUUID); err != nil {
+		return nil, fmt.Errorf("failed to lock chat members: %w", err)
+	}
+
+	member, err := qtx.GetChatMember(ctx, pgdb.GetChatMemberParams{ChatID: chatUUID, UserID: userUUID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrChatNotFound
+		}
+		return nil, fmt.Errorf("failed to get chat member: %w", err)
+	}
+
+	params := pgdb.UpdateChatMemberSettingsParams{
+		ChatID:       chatUUID,
+		UserID:       userUUID,
+		MutedUntil:   member.MutedUntil,
+		Archived:     member.Archived,
+		PinOrder:     member.PinOrder,
+		MarkedUnread: member.MarkedUnread,
+	}
+
+	if update.MutedUntil != nil {
+		if update.MutedUntil.Valid && !update.MutedUntil.Time.After(time.Now()) {
+			return nil, fmt.Errorf("%w: muted_until is in the past", ErrInvalidChatSettings)
+		}
+		params.MutedUntil = *update.MutedUntil
+	}
+	if update.MarkedUnread != nil {
+		params.MarkedUnread = *update.MarkedUnread
+	}
+	if update.Archived != nil {
+		params.Archived = *update.Archived
+		if params.Archived {
+			params.PinOrder = pgtype.Int4{}
+		}
+	}
+
+	if update.Pinned != nil {
+		switch {
+		case !*update.Pinned:
+			params.PinOrder = pgtype.Int4{}
+		case params.Archived:
+			return nil, fmt.Errorf("%w: archived chats can't be pinned", ErrInvalidChatSettings)
+		case !params.PinOrder.Valid:
+			pinned, err := qtx.CountPinnedChats(ctx, userUUID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to count pinned chats: %w", err)
+			}
+			if pinned >= maxPinnedChats {
+				return nil, ErrTooManyPinned
+			}
+
+			order, err := qtx.NextPinOrder(ctx, userUUID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get pin order: %w", err)
+			}
+			params.PinOrder = pgtype.Int4{Int32: order, Valid: true}
+		}
+	}
+
+	updated, err := qtx.UpdateChatMemberSettings(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update chat settings: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.settingsChanged(ctx, &updated)
+	return &updated, nil
+}
+
+// ReorderPinned - the chats become the pinned chats of the user, in this
+// order, the others are unpinned
+func (s *ChatService) ReorderPinned(ctx context.Context, userID string, chatIDs []string) ([]pgdb.ChatMember, error) {
+	var userUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	if len(chatIDs) > maxPinnedChats {
+		return nil, ErrTooManyPinned
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.repo.WithTx(tx)
+
+	if err := qtx.LockUserChatMembers(ctx, userUUID); err != nil {
+		return nil, fmt.Errorf("failed to lock chat members: %w", err)
+	}
+
+	unpinned, err := qtx.UnpinUserChats(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpin chats: %w", err)
+	}
+
+	members := make([]pgdb.ChatMember, 0, len(chatIDs))
+	for i, chatID := range chatIDs {
+		var chatUUID pgtype.UUID
+		if err := chatUUID.Scan(chatID); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrChatNotFound, err)
+		}
+
+		member, err := qtx.SetPinOrder(ctx, pgdb.SetPinOrderParams{
+			ChatID:   chatUUID,
+			UserID:   userUUID,
+			PinOrder: pgtype.Int4{Int32: int32(i), Valid: true},
+		})
+		if err != nil {
+			// not a member or archived
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, fmt.Errorf("%w: %s", ErrChatNotFound, chatID)
+			}
+			return nil, fmt.Errorf("failed to pin chat: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	repinned := make(map[pgtype.UUID]struct{}, len(members))
+	for i := range members {
+		repinned[members[i].ChatID] = struct{}{}
+		s.settingsChanged(ctx, &members[i])
+	}
+	// chats that lost their pin change on the other devices too
+	for i := range unpinned {
+		if _, ok := repinned[unpinned[i].ChatID]; !ok {
+			s.settingsChanged(ctx, &unpinned[i])
+		}
+	}
+	return members, nil
+}
+
+func (s *ChatService) settingsChanged(ctx context.Context, member *pgdb.ChatMember) {
+	if s.onSettingsChanged != nil {
+		s.onSettingsChanged(ctx, member)
+	}
+}
+
+// memberKey - an unparsable chat is one the user is not a member of
+func memberKey(userID, chatID string) (pgtype.UUID, pgtype.UUID, error) {
+	var chatUUID, userUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return chatUUID, userUUID, fmt.Errorf("invalid user ID: %w", err)
+	}
+	if err := chatUUID.Scan(chatID); err != nil {
+		return chatUUID, userUUID, fmt.Errorf("%w: %w", ErrChatNotFound, err)
+	}
+	return chatUUID, userUUID, nil
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const clamAVChunkSize = 64 << 10
+
+// ClamAVScanner - streams content to clamd over TCP with the INSTREAM command
+// (https://docs.clamav.net/manual/Usage/Scanning.html#clamd)
+type ClamAVScanner struct {
+	address string
+	timeout time.Duration
+}
+
+func NewClamAVScanner(address string, timeout time.Duration) *ClamAVScanner {
+	return &ClamAVScanner{
+		address: address,
+		timeout: timeout,
+	}
+}
+
+func (c *ClamAVScanner) Scan(ctx context.Context, content io.Reader) (*ScanResult, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	// cancellation interrupts blocked reads and writes
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	// clamd may close the stream early (e.g. size limit), its reply explains why
+	if err := c.send(conn, content); err != nil {
+		if reply, replyErr := readClamAVReply(conn); replyErr == nil {
+			return parseClamAVReply(reply)
+		}
+		return nil, err
+	}
+
+	reply, err := readClamAVReply(conn)
+	if err != nil {
+		return nil, err
+	}
+	return parseClamAVReply(reply)
+}
+
+// send - command, then chunks prefixed by their length, then a zero length chunk
+func (c *ClamAVScanner) send(conn net.Conn, content io.Reader) error {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("failed to send command: %w", err)
+	}
+
+	buf := make([]byte, 4+clamAVChunkSize)
+	for {
+		n, err := io.ReadFull(content, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return fmt.Errorf("failed to send chunk: %w", err)
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read content: %w", err)
+		}
+	}
+
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("failed to end stream: %w", err)
+	}
+	return nil
+}
+
+func readClamAVReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+// parseClamAVReply - "stream: OK", "stream: <signature> FOUND" or "<reason> ERROR"
+func parseClamAVReply(reply string) (*ScanResult, error) {
+	switch {
+	case strings.HasSuffix(reply, " FOUND"):
+		signature := strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return &ScanResult{Infected: true, Signature: signature}, nil
+	case strings.HasSuffix(reply, " OK"):
+		return &ScanResult{}, nil
+	case strings.HasSuffix(reply, " ERROR"):
+		return nil, fmt.Errorf("clamd: %s", strings.TrimSuffix(reply, " ERROR"))
+	default:
+		return nil, fmt.Errorf("unexpected clamd reply: %q", reply)
+	}
+}
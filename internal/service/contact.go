@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrContactSelf            = errors.New("cannot add yourself to contacts")
+	ErrAlreadyContacts        = errors.New("already in contacts")
+	ErrContactNotFound        = errors.New("contact not found")
+	ErrContactRequestNotFound = errors.New("contact request not found")
+)
+
+type ContactService struct {
+	repo *pgdb.Queries
+	pool *pgxpool.Pool
+}
+
+func NewContactService(repo *pgdb.Queries, pool *pgxpool.Pool) *ContactService {
+	return &ContactService{
+		repo: repo,
+		pool: pool,
+	}
+}
+
+// ContactRequests - pending requests to and from the user
+type ContactRequests struct {
+	Incoming []pgdb.ListIncomingContactRequestsRow
+	Outgoing []pgdb.ListOutgoingContactRequestsRow
+}
+
+// SendRequest - asks targetID to become a contact. A request while targetID
+// has one pending to the user accepts theirs, accepted reports that.
+func (s *ContactService) SendRequest(ctx context.Context, userID, targetID string) (accepted bool, err error) {
+	userUUID, targetUUID, err := userPair(userID, targetID, ErrContactSelf)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.repo.WithTx(tx)
+
+	// 1. Nothing to ask
+	blocked, err := qtx.IsBlockedBetween(ctx, pgdb.IsBlockedBetweenParams{UserID: userUUID, OtherID: targetUUID})
+	if err != nil {
+		return false, fmt.Errorf("failed to check blocks: %w", err)
+	}
+	if blocked {
+		return false, ErrBlocked
+	}
+
+	isContact, err := qtx.IsContact(ctx, pgdb.IsContactParams{UserID: userUUID, ContactID: targetUUID})
+	if err != nil {
+		return false, fmt.Errorf("failed to check contacts: %w", err)
+	}
+	if isContact {
+		return false, ErrAlreadyContacts
+	}
+
+	// 2. They asked first
+	removed, err := qtx.DeleteContactRequest(ctx, pgdb.DeleteContactRequestParams{FromUserID: targetUUID, ToUserID: userUUID})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete contact request: %w", err)
+	}
+	if removed > 0 {
+		if err := qtx.AddContact(ctx, pgdb.AddContactParams{UserID: userUUID, ContactID: targetUUID}); err != nil {
+			return false, fmt.Errorf("failed to add contact: %w", err)
+		}
+	} else {
+		// a repeated request is a no-op
+		_, err := qtx.CreateContactRequest(ctx, pgdb.CreateContactRequestParams{FromUserID: userUUID, ToUserID: targetUUID})
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+				return false, ErrUserNotFound
+			}
+			return false, fmt.Errorf("failed to create contact request: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return removed > 0, nil
+}
+
+// AcceptRequest - makes fromID and the user contacts
+func (s *ContactService) AcceptRequest(ctx context.Context, userID, fromID string) error {
+	userUUID, fromUUID, err := userPair(userID, fromID, ErrContactSelf)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.repo.WithTx(tx)
+
+	removed, err := qtx.DeleteContactRequest(ctx, pgdb.DeleteContactRequestParams{FromUserID: fromUUID, ToUserID: userUUID})
+	if err != nil {
+		return fmt.Errorf("failed to delete contact request: %w", err)
+	}
+	if removed == 0 {
+		return ErrContactRequestNotFound
+	}
+
+	if err := qtx.AddContact(ctx, pgdb.AddContactParams{UserID: userUUID, ContactID: fromUUID}); err != nil {
+		return fmt.Errorf("failed to add contact: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// DeclineRequest - drops the request of fromID, they are not told
+func (s *ContactService) DeclineRequest(ctx context.Context, userID, fromID string) error {
+	userUUID, fromUUID, err := userPair(userID, fromID, ErrContactSelf)
+	if err != nil {
+		return err
+	}
+	return s.deleteRequest(ctx, fromUUID, userUUID)
+}
+
+// CancelRequest - takes back the request the user sent to toID
+func (s *ContactService) CancelRequest(ctx context.Context, userID, toID string) error {
+	userUUID, toUUID, err := userPair(userID, toID, ErrContactSelf)
+	if err != nil {
+		return err
+	}
+	return s.deleteRequest(ctx, userUUID, toUUID)
+}
+
+func (s *ContactService) deleteRequest(ctx context.Context, from, to pgtype.UUID) error {
+	removed, err := s.repo.DeleteContactRequest(ctx, pgdb.DeleteContactRequestParams{FromUserID: from, ToUserID: to})
+	if err != nil {
+		return fmt.Errorf("failed to delete contact request: %w", err)
+	}
+	if removed == 0 {
+		return ErrContactRequestNotFound
+	}
+	return nil
+}
+
+// RemoveContact - for both sides
+func (s *ContactService) RemoveContact(ctx context.Context, userID, contactID string) error {
+	userUUID, contactUUID, err := userPair(userID, contactID, ErrContactSelf)
+	if err != nil {
+		return err
+	}
+
+	removed, err := s.repo.DeleteContact(ctx, pgdb.DeleteContactParams{UserID: userUUID, ContactID: contactUUID})
+	if err != nil {
+		return fmt.Errorf("failed to delete contact: %w", err)
+	}
+	if removed == 0 {
+		return ErrContactNotFound
+	}
+	return nil
+}
+
+func (s *ContactService) ListContacts(ctx context.Context, userID string) ([]pgdb.ListContactsRow, error) {
+	var userUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	contacts, err := s.repo.ListContacts(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list contacts: %w", err)
+	}
+	return contacts, nil
+}
+
+func (s *ContactService) ListRequests(ctx context.Context, userID string) (*ContactRequests, error) {
+	var userUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	incoming, err := s.repo.ListIncomingContactRequests(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list incoming contact requests: %w", err)
+	}
+	outgoing, err := s.repo.ListOutgoingContactRequests(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outgoing contact requests: %w", err)
+	}
+	return &ContactRequests{Incoming: incoming, Outgoing: outgoing}, nil
+}
+
+// userPair - the user and the other side, an unparsable other side is an
+// unknown user, the user themselves is self
+func userPair(userID, otherID string, self error) (pgtype.UUID, pgtype.UUID, error) {
+	var userUUID, otherUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return userUUID, otherUUID, fmt.Errorf("invalid user ID: %w", err)
+	}
+	if err := otherUUID.Scan(otherID); err != nil {
+		return userUUID, otherUUID, fmt.Errorf("%w: %w", ErrUserNotFound, err)
+	}
+	if userUUID == otherUUID {
+		return userUUID, otherUUID, self
+	}
+	return userUUID, otherUUID, nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// half of the default websocket frame, so a draft always fits in an event
+const maxDraftSize = 32 << 10
+
+var ErrDraftTooLong = fmt.Errorf("draft is longer than %d bytes", maxDraftSize)
+
+// OnDraftChanged - fn is told about every saved or cleared draft along with
+// the session it came from, so the other devices of the user can follow
+func (s *ChatService) OnDraftChanged(fn func(ctx context.Context, draft *pgdb.ChatDraft, sessionID string)) {
+	s.onDraftChanged = fn
+}
+
+// GetDraft - a chat without a draft has an empty one
+func (s *ChatService) GetDraft(ctx context.Context, userID, chatID string) (*pgdb.ChatDraft, error) {
+	chatUUID, userUUID, err := memberKey(userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkMember(ctx, chatUUID, userUUID); err != nil {
+		return nil, err
+	}
+
+	draft, err := s.repo.GetDraft(ctx, pgdb.GetDraftParams{ChatID: chatUUID, UserID: userUUID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &pgdb.ChatDraft{ChatID: chatUUID, UserID: userUUID}, nil
+		}
+		return nil, fmt.Errorf("failed to get draft: %w", err)
+	}
+	return &draft, nil
+}
+
+// SaveDraft - blank content clears the draft
+func (s *ChatService) SaveDraft(ctx context.Context, userID, sessionID, chatID, content string) (*pgdb.ChatDraft, error) {
+	chatUUID, userUUID, err := memberKey(userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxDraftSize {
+		return nil, ErrDraftTooLong
+	}
+	if err := s.checkMember(ctx, chatUUID, userUUID); err != nil {
+		return nil, err
+	}
+
+	var draft pgdb.ChatDraft
+	if strings.TrimSpace(content) == "" {
+		if _, err := s.repo.DeleteDraft(ctx, pgdb.DeleteDraftParams{ChatID: chatUUID, UserID: userUUID}); err != nil {
+			return nil, fmt.Errorf("failed to delete draft: %w", err)
+		}
+		draft = pgdb.ChatDraft{ChatID: chatUUID, UserID: userUUID}
+	} else {
+		draft, err = s.repo.UpsertDraft(ctx, pgdb.UpsertDraftParams{
+			ChatID:  chatUUID,
+			UserID:  userUUID,
+			Content: content,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to save draft: %w", err)
+		}
+	}
+
+	if s.onDraftChanged != nil {
+		s.onDraftChanged(ctx, &draft, sessionID)
+	}
+	return &draft, nil
+}
+
+func (s *ChatService) checkMember(ctx context.Context, chatUUID, userUUID pgtype.UUID) error {
+	isMember, err := s.repo.IsChatMember(ctx, pgdb.IsChatMemberParams{ChatID: chatUUID, UserID: userUUID})
+	if err != nil {
+		return fmt.Errorf("failed to check membership: %w", err)
+	}
+	if !isMember {
+		return ErrChatNotFound
+	}
+	return nil
+}
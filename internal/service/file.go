@@ -2,52 +2,382 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net/url"
 	"path/filepath"
+	"time"
 
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/minio/minio-go/v7"
 )
 
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// FileService - MinIO storage. Objects are content-addressed: files with the
+// same SHA-256 share one object (blob), which is reference counted.
 type FileService struct {
 	client     *minio.Client
 	bucketName string
 	endpoint   string
+	repo       *pgdb.Queries
+	pool       *pgxpool.Pool
+	quota      int64
+	scans      ScanQueue
+}
+
+// ScanQueue - takes files that must be scanned before they are served
+type ScanQueue interface {
+	Enqueue(file *pgdb.File)
 }
 
-func NewFileService(client *minio.Client, bucketName, endpoint string) *FileService {
+func NewFileService(
+	client *minio.Client,
+	bucketName, endpoint string,
+	repo *pgdb.Queries,
+	pool *pgxpool.Pool,
+	quota int64) *FileService {
+
 	return &FileService{
 		client:     client,
 		bucketName: bucketName,
 		endpoint:   endpoint,
+		repo:       repo,
+		pool:       pool,
+		quota:      quota,
 	}
 }
 
-func (s *FileService) UploadFile(
+// SetScanQueue - from now on new files stay pending until scanned
+func (s *FileService) SetScanQueue(queue ScanQueue) {
+	s.scans = queue
+}
+
+// NewFile - file record to be created on top of a blob
+type NewFile struct {
+	OwnerID     pgtype.UUID
+	Sha256      string
+	ObjectKey   string
+	FileName    string
+	ContentType string
+	Size        int64
+}
+
+type StorageUsage struct {
+	UsedBytes  int64
+	QuotaBytes int64
+	FilesCount int64
+}
+
+// StoreFile - hashes the content and uploads it, unless identical content is already stored
+func (s *FileService) StoreFile(
 	ctx context.Context,
-	file io.Reader,
+	ownerID string,
+	file io.ReadSeeker,
 	fileSize int64,
 	originalName string,
-	contentType string) (string, error) {
+	contentType string) (*pgdb.File, error) {
+
+	var ownerUUID pgtype.UUID
+	if err := ownerUUID.Scan(ownerID); err != nil {
+		return nil, fmt.Errorf("invalid owner ID: %w", err)
+	}
+
+	// 1. Cheap quota check before transferring anything
+	if err := s.CheckQuota(ctx, ownerUUID, fileSize); err != nil {
+		return nil, err
+	}
+
+	// 2. Hash the content
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, fmt.Errorf("failed to hash file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind file: %w", err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	// 3. Known content stays locked until the file references it
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { tx.Rollback(ctx) }()
+
+	objectKey, exists, err := s.lockBlob(ctx, s.repo.WithTx(tx), sum)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. Upload in MinIO, if it's new content. Unic name: UUID + ext.
+	// Nothing is locked, so the transaction isn't held during the upload.
+	if !exists {
+		tx.Rollback(ctx)
+		objectKey = uuid.New().String() + filepath.Ext(originalName)
+
+		_, err := s.client.PutObject(
+			ctx, s.bucketName, objectKey,
+			file, fileSize, minio.PutObjectOptions{ContentType: contentType},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload file to minio: %w", err)
+		}
+
+		next, err := s.pool.Begin(ctx)
+		if err != nil {
+			s.RemoveObject(ctx, objectKey)
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		tx = next
+	}
+
+	// 5. Record the file
+	saved, err := s.SaveFile(ctx, s.repo.WithTx(tx), NewFile{
+		OwnerID:     ownerUUID,
+		Sha256:      sum,
+		ObjectKey:   objectKey,
+		FileName:    originalName,
+		ContentType: contentType,
+		Size:        fileSize,
+	})
+	if err == nil {
+		err = tx.Commit(ctx)
+	}
+	if err != nil {
+		if !exists {
+			s.RemoveObject(ctx, objectKey)
+		}
+		return nil, err
+	}
+
+	// the same content was stored concurrently, ours is a duplicate
+	if !exists && saved.ObjectKey != objectKey {
+		s.RemoveObject(ctx, objectKey)
+	}
+
+	s.QueueScan(saved)
+	return saved, nil
+}
+
+// lockBlob - object key of already stored content with this hash. The blob
+// stays locked until q's transaction ends, so the GC can't delete its object
+// before the new file references it.
+func (s *FileService) lockBlob(ctx context.Context, q *pgdb.Queries, sum string) (string, bool, error) {
+	blob, err := q.LockBlob(ctx, sum)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to lock blob: %w", err)
+	}
+	return blob.ObjectKey, true, nil
+}
+
+// SaveFile - charges the owner's quota, references the blob and creates the
+// file record. Runs on q, so callers can make it part of their transaction.
+// The returned file may point to another object, if the blob already existed.
+func (s *FileService) SaveFile(ctx context.Context, q *pgdb.Queries, f NewFile) (*pgdb.File, error) {
+	charged, err := q.ChargeStorage(ctx, pgdb.ChargeStorageParams{
+		Size:  f.Size,
+		ID:    f.OwnerID,
+		Quota: s.quota,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to charge storage: %w", err)
+	}
+	if charged == 0 {
+		return nil, ErrQuotaExceeded
+	}
+
+	blob, err := q.AcquireBlob(ctx, pgdb.AcquireBlobParams{
+		Sha256:    f.Sha256,
+		ObjectKey: f.ObjectKey,
+		Size:      f.Size,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire blob: %w", err)
+	}
+
+	scanStatus, err := s.initialScanStatus(ctx, q, f.Sha256)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := q.CreateFile(ctx, pgdb.CreateFileParams{
+		OwnerID:     f.OwnerID,
+		ObjectKey:   blob.ObjectKey,
+		FileName:    f.FileName,
+		ContentType: f.ContentType,
+		Size:        f.Size,
+		Sha256:      pgtype.Text{String: f.Sha256, Valid: true},
+		ScanStatus:  scanStatus,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	return &file, nil
+}
+
+// initialScanStatus - known content keeps its verdict, new content waits for the scanner
+func (s *FileService) initialScanStatus(ctx context.Context, q *pgdb.Queries, sum string) (string, error) {
+	if s.scans == nil {
+		return ScanClean, nil
+	}
+
+	status, err := q.GetScanVerdict(ctx, pgtype.Text{String: sum, Valid: true})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ScanPending, nil
+		}
+		return "", fmt.Errorf("failed to get scan verdict: %w", err)
+	}
+	return status, nil
+}
+
+// QueueScan - hands a committed file to the scanner, if it waits for one
+func (s *FileService) QueueScan(file *pgdb.File) {
+	if s.scans != nil && file.ScanStatus == ScanPending {
+		s.scans.Enqueue(file)
+	}
+}
+
+// CheckQuota - returns ErrQuotaExceeded if size more bytes would not fit
+func (s *FileService) CheckQuota(ctx context.Context, ownerID pgtype.UUID, size int64) error {
+	usage, err := s.repo.GetStorageUsage(ctx, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to get storage usage: %w", err)
+	}
+	if usage.StorageUsed+size > s.quota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+func (s *FileService) GetUsage(ctx context.Context, userID string) (*StorageUsage, error) {
+	var userUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	usage, err := s.repo.GetStorageUsage(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage usage: %w", err)
+	}
+
+	return &StorageUsage{
+		UsedBytes:  usage.StorageUsed,
+		QuotaBytes: s.quota,
+		FilesCount: usage.FilesCount,
+	}, nil
+}
+
+// PublicURL - direct link to an object of the public bucket
+// local - http://localhost:9000/images/filename.jpg
+// prod - https://cdn.myapp.com/...
+func (s *FileService) PublicURL(objectKey string) string {
+	return fmt.Sprintf("http://%s/%s/%s", s.endpoint, s.bucketName, objectKey)
+}
+
+// GetObject - streams the object content
+func (s *FileService) GetObject(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucketName, objectKey, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	return object, nil
+}
+
+// ObjectExists - reports whether the object is stored with the given size
+func (s *FileService) ObjectExists(ctx context.Context, objectKey string, size int64) (bool, error) {
+	info, err := s.client.StatObject(ctx, s.bucketName, objectKey, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to stat object: %w", err)
+	}
+	return info.Size == size, nil
+}
+
+func (s *FileService) RemoveObject(ctx context.Context, objectKey string) error {
+	if err := s.client.RemoveObject(ctx, s.bucketName, objectKey, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to remove object: %w", err)
+	}
+	return nil
+}
+
+// NewMultipartUpload - starts a MinIO multipart upload and returns its id
+func (s *FileService) NewMultipartUpload(ctx context.Context, objectKey, contentType string) (string, error) {
+	uploadID, err := s.core().NewMultipartUpload(
+		ctx, s.bucketName, objectKey, minio.PutObjectOptions{ContentType: contentType},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+	return uploadID, nil
+}
 
-	// 1. Generate unic file_name (UUID + ext)
-	ext := filepath.Ext(originalName)
-	newFileName := uuid.New().String() + ext
+// UploadPart - streams one part of a multipart upload, returns its ETag
+func (s *FileService) UploadPart(
+	ctx context.Context,
+	objectKey, uploadID string,
+	partNumber int,
+	data io.Reader,
+	size int64) (string, error) {
 
-	// 2. Upload in MinIO
-	_, err := s.client.PutObject(
-		ctx, s.bucketName, newFileName,
-		file, fileSize, minio.PutObjectOptions{ContentType: contentType},
+	part, err := s.core().PutObjectPart(
+		ctx, s.bucketName, objectKey, uploadID, partNumber,
+		data, size, minio.PutObjectPartOptions{},
 	)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file to minio: %w", err)
+		return "", fmt.Errorf("failed to upload part %d: %w", partNumber, err)
 	}
+	return part.ETag, nil
+}
 
-	// 3. Making url
-	// local - http://localhost:9000/images/filename.jpg
-	// prod - https://cdn.myapp.com/...
-	url := fmt.Sprintf("http://%s/%s/%s", s.endpoint, s.bucketName, newFileName)
+func (s *FileService) CompleteMultipartUpload(ctx context.Context, objectKey, uploadID string, parts []minio.CompletePart) error {
+	_, err := s.core().CompleteMultipartUpload(
+		ctx, s.bucketName, objectKey, uploadID, parts, minio.PutObjectOptions{},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (s *FileService) AbortMultipartUpload(ctx context.Context, objectKey, uploadID string) error {
+	if err := s.core().AbortMultipartUpload(ctx, s.bucketName, objectKey, uploadID); err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	return nil
+}
+
+// PresignedURL - short-lived download link, served with the original file name
+func (s *FileService) PresignedURL(ctx context.Context, objectKey, fileName string, expires time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+
+	u, err := s.client.PresignedGetObject(ctx, s.bucketName, objectKey, expires, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign url: %w", err)
+	}
+	return u.String(), nil
+}
+
+// ListObjects - every object of the bucket
+func (s *FileService) ListObjects(ctx context.Context) <-chan minio.ObjectInfo {
+	return s.client.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{Recursive: true})
+}
 
-	return url, nil
+func (s *FileService) core() minio.Core {
+	return minio.Core{Client: s.client}
 }
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	maxChatFolders    = 20
+	maxFolderChats    = 200
+	maxFolderNameSize = 64
+)
+
+var (
+	ErrFolderNotFound = errors.New("folder not found")
+	ErrTooManyFolders = fmt.Errorf("at most %d folders can be created", maxChatFolders)
+	ErrInvalidFolder  = errors.New("invalid folder")
+)
+
+// ChatFolder - a folder with the chats listed in it. With no chats listed the
+// folder starts from every chat, the rules narrow it down either way.
+type ChatFolder struct {
+	pgdb.ChatFolder
+	ChatIDs []pgtype.UUID
+}
+
+// FolderInput - nil fields stay as they are, a new folder needs a name.
+// ChatIDs replaces the chats listed in the folder.
+type FolderInput struct {
+	Name         *string
+	ChatIDs      *[]string
+	GroupsOnly   *bool
+	UnreadOnly   *bool
+	ExcludeMuted *bool
+}
+
+func (s *ChatService) ListFolders(ctx context.Context, userID string) ([]ChatFolder, error) {
+	var userUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	folders, err := s.repo.ListChatFolders(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folders: %w", err)
+	}
+
+	chats, err := s.repo.ListUserFolderChats(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folder chats: %w", err)
+	}
+
+	result := make([]ChatFolder, 0, len(folders))
+	for _, f := range folders {
+		folder := ChatFolder{ChatFolder: f, ChatIDs: []pgtype.UUID{}}
+		for _, c := range chats {
+			if c.FolderID == f.ID {
+				folder.ChatIDs = append(folder.ChatIDs, c.ChatID)
+			}
+		}
+		result = append(result, folder)
+	}
+	return result, nil
+}
+
+func (s *ChatService) CreateFolder(ctx context.Context, userID string, input FolderInput) (*ChatFolder, error) {
+	var userUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	if input.Name == nil {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidFolder)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.repo.WithTx(tx)
+
+	count, err := qtx.CountChatFolders(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count folders: %w", err)
+	}
+	if count >= maxChatFolders {
+		return nil, ErrTooManyFolders
+	}
+
+	folder, err := s.saveFolder(ctx, qtx, &pgdb.ChatFolder{UserID: userUUID}, nil, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return folder, nil
+}
+
+func (s *ChatService) UpdateFolder(ctx context.Context, userID, folderID string, input FolderInput) (*ChatFolder, error) {
+	userUUID, folderUUID, err := folderKey(userID, folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.repo.WithTx(tx)
+
+	current, err := qtx.GetChatFolder(ctx, pgdb.GetChatFolderParams{ID: folderUUID, UserID: userUUID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrFolderNotFound
+		}
+		return nil, fmt.Errorf("failed to get folder: %w", err)
+	}
+
+	chats, err := qtx.ListUserFolderChats(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folder chats: %w", err)
+	}
+
+	var chatIDs []pgtype.UUID
+	for _, c := range chats {
+		if c.FolderID == folderUUID {
+			chatIDs = append(chatIDs, c.ChatID)
+		}
+	}
+
+	folder, err := s.saveFolder(ctx, qtx, &current, chatIDs, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return folder, nil
+}
+
+func (s *ChatService) DeleteFolder(ctx context.Context, userID, folderID string) error {
+	userUUID, folderUUID, err := folderKey(userID, folderID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := s.repo.DeleteChatFolder(ctx, pgdb.DeleteChatFolderParams{ID: folderUUID, UserID: userUUID})
+	if err != nil {
+		return fmt.Errorf("failed to delete folder: %w", err)
+	}
+	if deleted == 0 {
+		return ErrFolderNotFound
+	}
+	return nil
+}
+
+// saveFolder - applies the input over the folder and its chats, a folder
+// without an ID is created
+func (s *ChatService) saveFolder(ctx context.Context, qtx *pgdb.Queries, folder *pgdb.ChatFolder, chatIDs []pgtype.UUID, input FolderInput) (*ChatFolder, error) {
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" || utf8.RuneCountInString(name) > maxFolderNameSize {
+			return nil, fmt.Errorf("%w: name must be 1-%d characters", ErrInvalidFolder, maxFolderNameSize)
+		}
+		folder.Name = name
+	}
+	if input.GroupsOnly != nil {
+		folder.GroupsOnly = *input.GroupsOnly
+	}
+	if input.UnreadOnly != nil {
+		folder.UnreadOnly = *input.UnreadOnly
+	}
+	if input.ExcludeMuted != nil {
+		folder.ExcludeMuted = *input.ExcludeMuted
+	}
+	if input.ChatIDs != nil {
+		chatIDs = make([]pgtype.UUID, 0, len(*input.ChatIDs))
+		for _, id := range *input.ChatIDs {
+			var chatUUID pgtype.UUID
+			if err := chatUUID.Scan(id); err != nil {
+				return nil, fmt.Errorf("%w: invalid chat id %q", ErrInvalidFolder, id)
+			}
+			if !slices.Contains(chatIDs, chatUUID) {
+				chatIDs = append(chatIDs, chatUUID)
+			}
+		}
+		if len(chatIDs) > maxFolderChats {
+			return nil, fmt.Errorf("%w: at most %d chats per folder", ErrInvalidFolder, maxFolderChats)
+		}
+	}
+
+	// a folder of every chat is the inbox itself
+	if len(chatIDs) == 0 && !folder.GroupsOnly && !folder.UnreadOnly && !folder.ExcludeMuted {
+		return nil, fmt.Errorf("%w: a folder needs chats or a filter", ErrInvalidFolder)
+	}
+
+	var saved pgdb.ChatFolder
+	var err error
+	if folder.ID.Valid {
+		saved, err = qtx.UpdateChatFolder(ctx, pgdb.UpdateChatFolderParams{
+			ID:           folder.ID,
+			UserID:       folder.UserID,
+			Name:         folder.Name,
+			GroupsOnly:   folder.GroupsOnly,
+			UnreadOnly:   folder.UnreadOnly,
+			ExcludeMuted: folder.ExcludeMuted,
+		})
+	} else {
+		saved, err = qtx.CreateChatFolder(ctx, pgdb.CreateChatFolderParams{
+			UserID:       folder.UserID,
+			Name:         folder.Name,
+			GroupsOnly:   folder.GroupsOnly,
+			UnreadOnly:   folder.UnreadOnly,
+			ExcludeMuted: folder.ExcludeMuted,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save folder: %w", err)
+	}
+
+	if input.ChatIDs != nil {
+		if err := qtx.ClearChatFolderChats(ctx, saved.ID); err != nil {
+			return nil, fmt.Errorf("failed to clear folder chats: %w", err)
+		}
+
+		added, err := qtx.AddChatFolderChats(ctx, pgdb.AddChatFolderChatsParams{
+			FolderID: saved.ID,
+			UserID:   saved.UserID,
+			ChatIds:  chatIDs,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add folder chats: %w", err)
+		}
+		if int(added) != len(chatIDs) {
+			return nil, fmt.Errorf("%w: not a member of every chat", ErrInvalidFolder)
+		}
+	}
+
+	if chatIDs == nil {
+		chatIDs = []pgtype.UUID{}
+	}
+	return &ChatFolder{ChatFolder: saved, ChatIDs: chatIDs}, nil
+}
+
+func folderKey(userID, folderID string) (pgtype.UUID, pgtype.UUID, error) {
+	var userUUID, folderUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return userUUID, folderUUID, fmt.Errorf("invalid user ID: %w", err)
+	}
+	if err := folderUUID.Scan(folderID); err != nil {
+		return userUUID, folderUUID, fmt.Errorf("%w: %w", ErrFolderNotFound, err)
+	}
+	return userUUID, folderUUID, nil
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const gcBatchSize = 500
+
+// Totals since start, exposed by expvar
+var (
+	gcReclaimedBytes = expvar.NewInt("gc_reclaimed_bytes")
+	gcDeletedObjects = expvar.NewInt("gc_deleted_objects")
+	gcDeletedFiles   = expvar.NewInt("gc_deleted_files")
+)
+
+// GCReport - outcome of one collection pass. In dry-run mode it describes
+// what would have been deleted.
+type GCReport struct {
+	Files          int
+	Objects        int
+	ReclaimedBytes int64
+	DryRun         bool
+}
+
+// GarbageCollector - reconciles MinIO with the database. It removes
+//  1. files nobody references (no message, no avatar) after the grace period,
+//  2. blobs whose last file is gone, with their objects,
+//  3. objects in the bucket the database knows nothing about.
+type GarbageCollector struct {
+	repo  *pgdb.Queries
+	pool  *pgxpool.Pool
+	files *FileService
+
+	interval    time.Duration
+	gracePeriod time.Duration
+	dryRun      bool
+}
+
+func NewGarbageCollector(
+	repo *pgdb.Queries,
+	pool *pgxpool.Pool,
+	files *FileService,
+	cfg config.GC) *GarbageCollector {
+
+	return &GarbageCollector{
+		repo:        repo,
+		pool:        pool,
+		files:       files,
+		interval:    cfg.Interval,
+		gracePeriod: cfg.GracePeriod,
+		dryRun:      cfg.DryRun,
+	}
+}
+
+// Run - collects every interval, blocks forever
+func (gc *GarbageCollector) Run() {
+	ticker := time.NewTicker(gc.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := gc.Collect(context.Background()); err != nil {
+			slog.Error("garbage collection failed", slog.String("error", err.Error()))
+		}
+	}
+}
+
+// Collect - one full pass
+func (gc *GarbageCollector) Collect(ctx context.Context) (*GCReport, error) {
+	report := &GCReport{DryRun: gc.dryRun}
+	cutoff := time.Now().Add(-gc.gracePeriod)
+
+	// Completed upload sessions only point at their file, they are not a reference
+	if !gc.dryRun {
+		_, err := gc.repo.DeleteCompletedUploads(ctx, pgtype.Timestamptz{Time: cutoff, Valid: true})
+		if err != nil {
+			return report, fmt.Errorf("failed to delete completed uploads: %w", err)
+		}
+	}
+
+	if err := gc.collectFiles(ctx, cutoff, report); err != nil {
+		return report, err
+	}
+	if err := gc.collectBlobs(ctx, cutoff, report); err != nil {
+		return report, err
+	}
+	if err := gc.collectStrayObjects(ctx, cutoff, report); err != nil {
+		return report, err
+	}
+
+	if !gc.dryRun {
+		gcReclaimedBytes.Add(report.ReclaimedBytes)
+		gcDeletedObjects.Add(int64(report.Objects))
+		gcDeletedFiles.Add(int64(report.Files))
+	}
+
+	slog.Info("garbage collection finished",
+		slog.Bool("dry_run", report.DryRun),
+		slog.Int("files", report.Files),
+		slog.Int("objects", report.Objects),
+		slog.Int64("reclaimed_bytes", report.ReclaimedBytes),
+	)
+	return report, nil
+}
+
+// collectFiles - drops unreferenced file records, releasing their blobs
+func (gc *GarbageCollector) collectFiles(ctx context.Context, cutoff time.Time, report *GCReport) error {
+	orphans, err := gc.repo.ListOrphanFiles(ctx, pgdb.ListOrphanFilesParams{
+		CreatedBefore: pgtype.Timestamptz{Time: cutoff, Valid: true},
+		MaxFiles:      gcBatchSize,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list orphan files: %w", err)
+	}
+
+	for _, orphan := range orphans {
+		if gc.dryRun {
+			slog.Info("would delete file", slog.String("file_id", orphan.ID.String()), slog.Int64("size", orphan.Size))
+			report.Files++
+			continue
+		}
+
+		deleted, err := gc.deleteFile(ctx, orphan.ID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue // referenced in the meantime
+			}
+			return err
+		}
+		report.Files++
+
+		// files from before deduplication own their object
+		if !deleted.Sha256.Valid {
+			if err := gc.files.RemoveObject(ctx, deleted.ObjectKey); err != nil {
+				slog.Warn("failed to remove object", slog.String("key", deleted.ObjectKey), slog.String("error", err.Error()))
+				continue
+			}
+			report.Objects++
+			report.ReclaimedBytes += deleted.Size
+		}
+	}
+	return nil
+}
+
+func (gc *GarbageCollector) deleteFile(ctx context.Context, fileID pgtype.UUID) (*pgdb.File, error) {
+	tx, err := gc.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := gc.repo.WithTx(tx)
+
+	file, err := qtx.DeleteOrphanFile(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.Sha256.Valid {
+		if err := qtx.ReleaseBlob(ctx, file.Sha256.String); err != nil {
+			return nil, fmt.Errorf("failed to release blob: %w", err)
+		}
+	}
+
+	err = qtx.RefundStorage(ctx, pgdb.RefundStorageParams{
+		Size: file.Size,
+		ID:   file.OwnerID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to refund storage: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &file, nil
+}
+
+// collectBlobs - removes objects of blobs released longer than the grace period ago
+func (gc *GarbageCollector) collectBlobs(ctx context.Context, cutoff time.Time, report *GCReport) error {
+	releasedBefore := pgtype.Timestamptz{Time: cutoff, Valid: true}
+
+	blobs, err := gc.repo.ListDeadBlobs(ctx, pgdb.ListDeadBlobsParams{
+		ReleasedBefore: releasedBefore,
+		MaxBlobs:       gcBatchSize,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list dead blobs: %w", err)
+	}
+
+	for _, blob := range blobs {
+		if gc.dryRun {
+			slog.Info("would delete object", slog.String("key", blob.ObjectKey), slog.Int64("size", blob.Size))
+			report.Objects++
+			report.ReclaimedBytes += blob.Size
+			continue
+		}
+
+		// the row goes first - if it was acquired again, the object stays
+		deleted, err := gc.repo.DeleteDeadBlob(ctx, pgdb.DeleteDeadBlobParams{
+			Sha256:         blob.Sha256,
+			ReleasedBefore: releasedBefore,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete blob: %w", err)
+		}
+		if deleted == 0 {
+			continue
+		}
+
+		if err := gc.files.RemoveObject(ctx, blob.ObjectKey); err != nil {
+			// the object is now a stray one, the next pass picks it up
+			slog.Warn("failed to remove object", slog.String("key", blob.ObjectKey), slog.String("error", err.Error()))
+			continue
+		}
+		report.Objects++
+		report.ReclaimedBytes += blob.Size
+	}
+	return nil
+}
+
+// collectStrayObjects - objects left by failed uploads or crashes
+func (gc *GarbageCollector) collectStrayObjects(ctx context.Context, cutoff time.Time, report *GCReport) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sizes := make(map[string]int64, gcBatchSize)
+	for object := range gc.files.ListObjects(ctx) {
+		if object.Err != nil {
+			return fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		if object.LastModified.After(cutoff) {
+			continue
+		}
+
+		sizes[object.Key] = object.Size
+		if len(sizes) == gcBatchSize {
+			if err := gc.removeStray(ctx, sizes, report); err != nil {
+				return err
+			}
+			clear(sizes)
+		}
+	}
+	return gc.removeStray(ctx, sizes, report)
+}
+
+func (gc *GarbageCollector) removeStray(ctx context.Context, sizes map[string]int64, report *GCReport) error {
+	if len(sizes) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(sizes))
+	for key := range sizes {
+		keys = append(keys, key)
+	}
+
+	referenced, err := gc.repo.ListReferencedObjectKeys(ctx, keys)
+	if err != nil {
+		return fmt.Errorf("failed to check object references: %w", err)
+	}
+	for _, key := range referenced {
+		delete(sizes, key)
+	}
+
+	for key, size := range sizes {
+		if gc.dryRun {
+			slog.Info("would delete stray object", slog.String("key", key), slog.Int64("size", size))
+		} else if err := gc.files.RemoveObject(ctx, key); err != nil {
+			slog.Warn("failed to remove object", slog.String("key", key), slog.String("error", err.Error()))
+			continue
+		}
+		report.Objects++
+		report.ReclaimedBytes += size
+	}
+	return nil
+}
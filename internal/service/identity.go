@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// usernameLimit - users.username is VARCHAR(50), room is left for a suffix
+const usernameLimit = 40
+
+var ErrIdentityConflict = errors.New("an account with this email already exists, log in with the password")
+
+// ExternalIdentity - a user as an identity provider knows them
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string // wish, taken names get a suffix
+}
+
+// LoginExternal - logs in the user the identity is linked to. An unknown
+// identity is linked to the account with the same email if the provider
+// verified it, otherwise a new user is created.
+func (s *UserService) LoginExternal(ctx context.Context, identity ExternalIdentity, device Device) (*LoginResult, error) {
+	user, err := s.externalUser(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	return s.startLogin(ctx, user, device)
+}
+
+func (s *UserService) externalUser(ctx context.Context, identity ExternalIdentity) (*pgdb.User, error) {
+	// 1. Linked before
+	linked, err := s.repo.GetExternalIdentity(ctx, pgdb.GetExternalIdentityParams{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+	})
+	if err == nil {
+		user, err := s.repo.GetUserByID(ctx, linked.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get external identity: %w", err)
+	}
+
+	// 2. Existing account, linked only when both sides proved the email,
+	// an unverified one could be anyone's, including whoever registered
+	// it first to wait for the owner's SSO login
+	user, err := s.repo.GetUserByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		if !identity.EmailVerified || !user.EmailVerified {
+			return nil, ErrIdentityConflict
+		}
+	case errors.Is(err, pgx.ErrNoRows):
+		user, err = s.provisionUser(ctx, identity)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	_, err = s.repo.CreateExternalIdentity(ctx, pgdb.CreateExternalIdentityParams{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		UserID:   user.ID,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to link external identity: %w", err)
+	}
+	return &user, nil
+}
+
+// provisionUser - without a password, the provider vouches for the user
+func (s *UserService) provisionUser(ctx context.Context, identity ExternalIdentity) (pgdb.User, error) {
+	base := usernameFrom(identity.Username)
+	username := base
+
+	for range 5 {
+		user, err := s.repo.CreateUser(ctx, pgdb.CreateUserParams{
+			Username:     username,
+			Email:        identity.Email,
+			PasswordHash: "", // never matches a bcrypt comparison
+		})
+		if err == nil {
+			if identity.EmailVerified {
+				if _, err := s.repo.SetEmailVerified(ctx, pgdb.SetEmailVerifiedParams{ID: user.ID, Email: user.Email}); err != nil {
+					return pgdb.User{}, fmt.Errorf("failed to verify email: %w", err)
+				}
+				user.EmailVerified = true
+			}
+			return user, nil
+		}
+
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != "23505" || pgErr.ConstraintName != "users_username_key" {
+			return pgdb.User{}, fmt.Errorf("failed to create user: %w", err)
+		}
+
+		suffix := make([]byte, 2)
+		if _, err := rand.Read(suffix); err != nil {
+			return pgdb.User{}, fmt.Errorf("failed to generate username: %w", err)
+		}
+		username = base + "-" + hex.EncodeToString(suffix)
+	}
+	return pgdb.User{}, fmt.Errorf("failed to find a free username for %q", base)
+}
+
+// usernameFrom - letters, digits, dots, dashes and underscores of the wish
+func usernameFrom(wish string) string {
+	username := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '.', r == '-', r == '_':
+			return r
+		case unicode.IsSpace(r):
+			return '_'
+		default:
+			return -1
+		}
+	}, strings.TrimSpace(wish))
+
+	if runes := []rune(username); len(runes) > usernameLimit {
+		username = string(runes[:usernameLimit])
+	}
+	if username == "" {
+		username = "user"
+	}
+	return username
+}
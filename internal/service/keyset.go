@@ -0,0 +1,211 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySet - keys access tokens are signed and verified with. Either a single
+// HMAC secret, or asymmetric keys identified by the "kid" header, of which
+// one signs and all of them verify.
+type KeySet struct {
+	secret []byte
+
+	signingKID string
+	signer     crypto.Signer
+	keys       map[string]verifyKey
+}
+
+type verifyKey struct {
+	method jwt.SigningMethod
+	public crypto.PublicKey
+}
+
+// JWK - public key in the format of RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA
+	E   string `json:"e,omitempty"`   // RSA
+	Crv string `json:"crv,omitempty"` // OKP, EC
+	X   string `json:"x,omitempty"`   // OKP, EC
+	Y   string `json:"y,omitempty"`   // EC
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewHMACKeySet - HS256 with a shared secret, nothing is published in the JWKS
+func NewHMACKeySet(secret string) *KeySet {
+	return &KeySet{secret: []byte(secret)}
+}
+
+// LoadKeySet - every *.pem in cfg.KeysDir is a key named by its file name.
+// Public keys only verify, they are what is left of retired keys.
+func LoadKeySet(cfg config.Auth) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(cfg.KeysDir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no keys found in %s", cfg.KeysDir)
+	}
+
+	ks := &KeySet{keys: make(map[string]verifyKey)}
+	signers := make(map[string]crypto.Signer)
+
+	// 1. Every key verifies
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", kid, err)
+		}
+		key, err := parseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", kid, err)
+		}
+
+		var public crypto.PublicKey = key
+		if signer, ok := key.(crypto.Signer); ok {
+			signers[kid] = signer
+			public = signer.Public()
+		}
+
+		method, err := signingMethod(public)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", kid, err)
+		}
+		ks.keys[kid] = verifyKey{method: method, public: public}
+	}
+
+	// 2. The one new tokens are signed with
+	kid := cfg.SigningKey
+	if kid == "" {
+		if len(signers) != 1 {
+			return nil, errors.New("signing_key must be set when there is more than one private key")
+		}
+		for k := range signers {
+			kid = k
+		}
+	}
+	signer, ok := signers[kid]
+	if !ok {
+		return nil, fmt.Errorf("no private key for signing key %q", kid)
+	}
+	ks.signingKID = kid
+	ks.signer = signer
+
+	return ks, nil
+}
+
+// Sign - the kid header tells verifiers which key to use
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if k.signer == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+	}
+
+	token := jwt.NewWithClaims(k.keys[k.signingKID].method, claims)
+	token.Header["kid"] = k.signingKID
+	return token.SignedString(k.signer)
+}
+
+// Parse - verifies the signature and expiry. The algorithm has to be the one
+// of the key, so a public key can't be passed off as an HMAC secret.
+func (k *KeySet) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if k.signer == nil {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return k.secret, nil
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return key.public, nil
+	})
+}
+
+// JWKS - public halves of every key, sorted by kid
+func (k *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(k.keys))}
+
+	for kid, key := range k.keys {
+		jwk := JWK{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].Kid < jwks.Keys[j].Kid })
+	return jwks
+}
+
+// parseKey - PKCS#8 or PKCS#1 private keys, PKIX public keys
+func parseKey(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+func signingMethod(public crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+}
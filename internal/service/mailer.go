@@ -0,0 +1,170 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+)
+
+// Email - plain text, everything we send is a short notice with a link
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer - SMTPMailer in production, FileMailer or MemoryOutbox otherwise
+type Mailer interface {
+	Send(ctx context.Context, email Email) error
+}
+
+// SMTPMailer - STARTTLS is used whenever the server offers it
+type SMTPMailer struct {
+	address string
+	auth    smtp.Auth
+	from    *mail.Address
+}
+
+func NewSMTPMailer(cfg config.Mail) (*SMTPMailer, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+
+	m := &SMTPMailer{address: cfg.SMTPAddress, from: from}
+	if cfg.Username != "" {
+		host, _, err := net.SplitHostPort(cfg.SMTPAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid smtp address: %w", err)
+		}
+		m.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, email Email) error {
+	msg, err := buildMessage(m.from, email)
+	if err != nil {
+		return err
+	}
+	// net/smtp has no context support, the dial timeout of the OS applies
+	if err := smtp.SendMail(m.address, m.auth, m.from.Address, []string{email.To}, msg); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// FileMailer - writes every email as an .eml file, for local development
+type FileMailer struct {
+	dir  string
+	from *mail.Address
+}
+
+func NewFileMailer(cfg config.Mail) (*FileMailer, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+	if err := os.MkdirAll(cfg.OutboxDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox: %w", err)
+	}
+	return &FileMailer{dir: cfg.OutboxDir, from: from}, nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+func (m *FileMailer) Send(ctx context.Context, email Email) error {
+	msg, err := buildMessage(m.from, email)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), unsafeFileChars.ReplaceAllString(email.To, "_"))
+	if err := os.WriteFile(filepath.Join(m.dir, name), msg, 0o644); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return nil
+}
+
+// MemoryOutbox - keeps sent emails, for tests
+type MemoryOutbox struct {
+	mu     sync.Mutex
+	emails []Email
+}
+
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{}
+}
+
+func (o *MemoryOutbox) Send(ctx context.Context, email Email) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.emails = append(o.emails, email)
+	return nil
+}
+
+// Last - the most recent email to the address
+func (o *MemoryOutbox) Last(to string) (Email, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := len(o.emails) - 1; i >= 0; i-- {
+		if o.emails[i].To == to {
+			return o.emails[i], true
+		}
+	}
+	return Email{}, false
+}
+
+// Count - emails sent to the address so far
+func (o *MemoryOutbox) Count(to string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := 0
+	for _, email := range o.emails {
+		if email.To == to {
+			n++
+		}
+	}
+	return n
+}
+
+// buildMessage - RFC 5322 message with a quoted-printable UTF-8 body
+func buildMessage(from *mail.Address, email Email) ([]byte, error) {
+	to, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := w.Write([]byte(email.Body)); err != nil {
+		return nil, fmt.Errorf("failed to encode email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode email: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,506 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	oidcStateTTL = 10 * time.Minute
+	// an unknown kid refetches the provider's keys, at most this often
+	jwksRefreshInterval = time.Minute
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown identity provider")
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+	ErrInvalidIDToken   = errors.New("invalid id token")
+	ErrCodeRejected     = errors.New("authorization code rejected")
+)
+
+// OIDCService - login through external identity providers
+type OIDCService struct {
+	rdb       *redis.Client
+	users     *UserService
+	providers map[string]*OIDCProvider
+}
+
+func NewOIDCService(rdb *redis.Client, users *UserService, providers []config.OIDCProvider) (*OIDCService, error) {
+	s := &OIDCService{
+		rdb:       rdb,
+		users:     users,
+		providers: make(map[string]*OIDCProvider, len(providers)),
+	}
+
+	for _, cfg := range providers {
+		if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+			return nil, fmt.Errorf("oidc provider %q: name, issuer, client_id and redirect_url are required", cfg.Name)
+		}
+		if _, ok := s.providers[cfg.Name]; ok {
+			return nil, fmt.Errorf("oidc provider %q is configured twice", cfg.Name)
+		}
+		s.providers[cfg.Name] = NewOIDCProvider(cfg, &http.Client{Timeout: 10 * time.Second})
+	}
+	return s, nil
+}
+
+// oidcState - what the callback needs to finish the login it started
+type oidcState struct {
+	Provider string `json:"provider"`
+	Verifier string `json:"verifier"` // PKCE
+	Nonce    string `json:"nonce"`
+}
+
+// AuthURL - where to send the browser to log in at the provider
+func (s *OIDCService) AuthURL(ctx context.Context, provider string) (string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(oidcState{Provider: provider, Verifier: verifier, Nonce: nonce})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode login state: %w", err)
+	}
+	if err := s.rdb.Set(ctx, oidcStateKey(state), payload, oidcStateTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to store login state: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.scopes(), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Login - the callback of the provider. The identity is linked to a user,
+// who is created if needed, then logged in like with a password.
+func (s *OIDCService) Login(ctx context.Context, provider, code, state string, device Device) (*LoginResult, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	// 1. State, single-use
+	payload, err := s.rdb.GetDel(ctx, oidcStateKey(state)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, fmt.Errorf("failed to get login state: %w", err)
+	}
+	var stored oidcState
+	if err := json.Unmarshal(payload, &stored); err != nil {
+		return nil, fmt.Errorf("failed to decode login state: %w", err)
+	}
+	if stored.Provider != provider {
+		return nil, ErrInvalidOIDCState
+	}
+
+	// 2. Code for tokens
+	rawIDToken, err := p.Exchange(ctx, code, stored.Verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Who logged in
+	claims, err := p.VerifyIDToken(ctx, rawIDToken, stored.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.users.LoginExternal(ctx, ExternalIdentity{
+		Provider:      provider,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Username:      claims.username(),
+	}, device)
+}
+
+// Providers - names of the configured providers
+func (s *OIDCService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func oidcStateKey(state string) string {
+	return "oidc_state:" + state
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// OIDCProvider - one identity provider. The discovery document and the keys
+// are fetched on first use and cached, so a provider being down doesn't stop
+// the server from starting.
+type OIDCProvider struct {
+	cfg    config.OIDCProvider
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDTokenClaims - the claims of an ID token we use
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Name              string `json:"name"`
+}
+
+func (c *IDTokenClaims) username() string {
+	if c.PreferredUsername != "" {
+		return c.PreferredUsername
+	}
+	if c.Name != "" {
+		return c.Name
+	}
+	local, _, _ := strings.Cut(c.Email, "@")
+	return local
+}
+
+func NewOIDCProvider(cfg config.OIDCProvider, client *http.Client) *OIDCProvider {
+	return &OIDCProvider{cfg: cfg, client: client}
+}
+
+func (p *OIDCProvider) scopes() []string {
+	if len(p.cfg.Scopes) == 0 {
+		return []string{"openid", "email", "profile"}
+	}
+	return p.cfg.Scopes
+}
+
+// Exchange - trades the authorization code for the ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// client_secret_basic, both parts form-encoded first (RFC 6749 2.3.1)
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var resp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(req, &resp)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange code: %w", err)
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("%w: token endpoint returned %d %s %s",
+			ErrCodeRejected, status, resp.Error, resp.ErrorDescription)
+	}
+	if resp.IDToken == "" {
+		return "", fmt.Errorf("%w: no id_token in the token response", ErrInvalidIDToken)
+	}
+	return resp.IDToken, nil
+}
+
+// VerifyIDToken - signature by a key of the provider, issuer, audience,
+// expiry and the nonce of the login
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDTokenClaims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims IDTokenClaims
+	_, err = jwt.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: issued to %q", ErrInvalidIDToken, claims.AuthorizedParty)
+	}
+	if claims.Subject == "" || claims.Email == "" {
+		return nil, fmt.Errorf("%w: sub and email are required", ErrInvalidIDToken)
+	}
+	return &claims, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	issuer := strings.TrimSuffix(p.cfg.Issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery request: %w", err)
+	}
+
+	var discovery oidcDiscovery
+	status, err := p.doJSON(req, &discovery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", p.cfg.Name, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to discover %s: status %d", p.cfg.Name, status)
+	}
+	// OpenID Connect Discovery 4.3
+	if discovery.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery of %s returned issuer %q", p.cfg.Name, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery of %s is missing endpoints", p.cfg.Name)
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// key - the verification key for kid, refetching the keys once when the
+// provider rotated them
+func (p *OIDCProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, ErrUnknownKey
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	// a provider with a single key may leave kid out
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// fetchKeys - called with mu held, discovery is done by then
+func (p *OIDCProvider) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.discovery.JWKSURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jwks request: %w", err)
+	}
+
+	var jwks JWKS
+	status, err := p.doJSON(req, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch keys of %s: %w", p.cfg.Name, err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch keys of %s: status %d", p.cfg.Name, status)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue // key types we don't verify with
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (p *OIDCProvider) doJSON(req *http.Request, v any) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("invalid json: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// PublicKey - RSA, EC (P-256, P-384, P-521) and Ed25519 keys
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch j.Kty {
+	case "RSA":
+		n, err := decode(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := decode(j.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid e: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid e")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		var point ecdh.Curve
+		switch j.Crv {
+		case "P-256":
+			curve, point = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, point = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, point = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := decode(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		y, err := decode(j.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %w", err)
+		}
+		// ecdh checks the point is on the curve
+		if _, err := point.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("invalid point: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := decode(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid x")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const maxPinnedMessages = 20
+
+// Kinds of the system messages left by pins, the content is the ID of the
+// pinned message
+const (
+	MessagePinned   = "pinned"
+	MessageUnpinned = "unpinned"
+)
+
+var (
+	ErrMessageNotFound = errors.New("message not found")
+	ErrPinForbidden    = errors.New("only admins can pin messages in this chat")
+	ErrTooManyPins     = fmt.Errorf("at most %d messages can be pinned", maxPinnedMessages)
+	ErrAlreadyPinned   = errors.New("message is already pinned")
+	ErrNotPinned       = errors.New("message is not pinned")
+	ErrNotChatAdmin    = errors.New("only admins can change the chat")
+)
+
+// OnPinChanged - fn gets the system message of every pin and unpin
+func (s *ChatService) OnPinChanged(fn func(ctx context.Context, msg *pgdb.Message)) {
+	s.onPinChanged = fn
+}
+
+func (s *ChatService) ListPinned(ctx context.Context, userID, chatID string) ([]pgdb.ListPinnedMessagesRow, error) {
+	chatUUID, userUUID, err := memberKey(userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkMember(ctx, chatUUID, userUUID); err != nil {
+		return nil, err
+	}
+
+	pinned, err := s.repo.ListPinnedMessages(ctx, chatUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pinned messages: %w", err)
+	}
+	return pinned, nil
+}
+
+// PinMessage - returns the system message telling the chat about it
+func (s *ChatService) PinMessage(ctx context.Context, userID, chatID, messageID string) (*pgdb.Message, error) {
+	return s.setPinned(ctx, userID, chatID, messageID, true)
+}
+
+func (s *ChatService) UnpinMessage(ctx context.Context, userID, chatID, messageID string) (*pgdb.Message, error) {
+	return s.setPinned(ctx, userID, chatID, messageID, false)
+}
+
+func (s *ChatService) setPinned(ctx context.Context, userID, chatID, messageID string, pin bool) (*pgdb.Message, error) {
+	chatUUID, userUUID, err := memberKey(userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	var messageUUID pgtype.UUID
+	if err := messageUUID.Scan(messageID); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMessageNotFound, err)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.repo.WithTx(tx)
+
+	canPin, err := qtx.CanPinMessages(ctx, pgdb.CanPinMessagesParams{ChatID: chatUUID, UserID: userUUID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrChatNotFound
+		}
+		return nil, fmt.Errorf("failed to check pin permission: %w", err)
+	}
+	if !canPin {
+		return nil, ErrPinForbidden
+	}
+
+	kind := MessageUnpinned
+	if pin {
+		kind = MessagePinned
+		if err := pinMessage(ctx, qtx, chatUUID, messageUUID, userUUID); err != nil {
+			return nil, err
+		}
+	} else {
+		unpinned, err := qtx.UnpinMessage(ctx, pgdb.UnpinMessageParams{ChatID: chatUUID, MessageID: messageUUID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpin message: %w", err)
+		}
+		if unpinned == 0 {
+			return nil, ErrNotPinned
+		}
+	}
+
+	msg, err := qtx.CreateMessage(ctx, pgdb.CreateMessageParams{
+		ChatID:   chatUUID,
+		SenderID: userUUID,
+		Content:  messageUUID.String(),
+		Kind:     kind,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save system message: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if s.onPinChanged != nil {
+		s.onPinChanged(ctx, &msg)
+	}
+	return &msg, nil
+}
+
+func pinMessage(ctx context.Context, qtx *pgdb.Queries, chatUUID, messageUUID, userUUID pgtype.UUID) error {
+	msg, err := qtx.GetChatMessage(ctx, pgdb.GetChatMessageParams{ID: messageUUID, ChatID: chatUUID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrMessageNotFound
+		}
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+	// pinning the notice of a pin makes no sense
+	if msg.Kind == MessagePinned || msg.Kind == MessageUnpinned {
+		return ErrMessageNotFound
+	}
+
+	count, err := qtx.CountPinnedMessages(ctx, chatUUID)
+	if err != nil {
+		return fmt.Errorf("failed to count pinned messages: %w", err)
+	}
+	if count >= maxPinnedMessages {
+		return ErrTooManyPins
+	}
+
+	pinned, err := qtx.PinMessage(ctx, pgdb.PinMessageParams{
+		ChatID:    chatUUID,
+		MessageID: messageUUID,
+		PinnedBy:  userUUID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to pin message: %w", err)
+	}
+	if pinned == 0 {
+		return ErrAlreadyPinned
+	}
+	return nil
+}
+
+// SetMembersCanPin - whether members other than admins may pin messages
+func (s *ChatService) SetMembersCanPin(ctx context.Context, userID, chatID string, allowed bool) (*pgdb.Chat, error) {
+	member, err := s.GetSettings(ctx, userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role != "admin" {
+		return nil, ErrNotChatAdmin
+	}
+
+	chat, err := s.repo.UpdateChatPinPermission(ctx, pgdb.UpdateChatPinPermissionParams{
+		ID:            member.ChatID,
+		MembersCanPin: allowed,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update chat: %w", err)
+	}
+	return &chat, nil
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Who a privacy setting lets see something
+const (
+	VisibilityEveryone = "everyone"
+	VisibilityContacts = "contacts"
+	VisibilityNobody   = "nobody"
+)
+
+var ErrInvalidPrivacy = errors.New("invalid privacy settings")
+
+type PrivacySettings struct {
+	Online       string
+	LastSeen     string
+	ReadReceipts string
+}
+
+// PrivacyUpdate - nil fields stay as they are
+type PrivacyUpdate struct {
+	Online       *string
+	LastSeen     *string
+	ReadReceipts *string
+}
+
+// Presence - what a viewer may know about a user, the online state itself
+// lives in Redis
+type Presence struct {
+	ShowOnline bool
+	LastSeen   *time.Time // nil when hidden or never seen
+}
+
+func (s *UserService) GetPrivacy(ctx context.Context, userID string) (*PrivacySettings, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return newPrivacySettings(user), nil
+}
+
+func (s *UserService) UpdatePrivacy(ctx context.Context, userID string, update PrivacyUpdate) (*PrivacySettings, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	settings := newPrivacySettings(user)
+
+	for _, field := range []struct {
+		name  string
+		value *string
+		dst   *string
+	}{
+		{"online", update.Online, &settings.Online},
+		{"last_seen", update.LastSeen, &settings.LastSeen},
+		{"read_receipts", update.ReadReceipts, &settings.ReadReceipts},
+	} {
+		if field.value == nil {
+			continue
+		}
+		switch *field.value {
+		case VisibilityEveryone, VisibilityContacts, VisibilityNobody:
+			*field.dst = *field.value
+		default:
+			return nil, fmt.Errorf("%w: %s must be everyone, contacts or nobody", ErrInvalidPrivacy, field.name)
+		}
+	}
+
+	err = s.repo.UpdatePrivacySettings(ctx, pgdb.UpdatePrivacySettingsParams{
+		ID:                     user.ID,
+		OnlineVisibility:       settings.Online,
+		LastSeenVisibility:     settings.LastSeen,
+		ReadReceiptsVisibility: settings.ReadReceipts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update privacy settings: %w", err)
+	}
+	return settings, nil
+}
+
+// Presence - what viewerID may know about the presence of userID. Users
+// blocked either way see nothing of each other.
+func (s *UserService) Presence(ctx context.Context, viewerID, userID string) (*Presence, error) {
+	var viewerUUID, userUUID pgtype.UUID
+	if err := viewerUUID.Scan(viewerID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUserNotFound, err)
+	}
+
+	row, err := s.repo.GetPresence(ctx, pgdb.GetPresenceParams{ViewerID: viewerUUID, UserID: userUUID})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get presence: %w", err)
+	}
+
+	self := viewerUUID == userUUID
+	if row.IsBlocked && !self {
+		return &Presence{}, nil
+	}
+
+	presence := &Presence{
+		ShowOnline: self || Visible(row.OnlineVisibility, row.IsContact),
+	}
+	if row.LastSeenAt.Valid && (self || Visible(row.LastSeenVisibility, row.IsContact)) {
+		lastSeen := row.LastSeenAt.Time
+		presence.LastSeen = &lastSeen
+	}
+	return presence, nil
+}
+
+// Visible - whether a setting lets someone see, isContact tells whether they
+// are a contact of the owner
+func Visible(visibility string, isContact bool) bool {
+	switch visibility {
+	case VisibilityEveryone:
+		return true
+	case VisibilityContacts:
+		return isContact
+	default:
+		return false
+	}
+}
+
+func newPrivacySettings(user *pgdb.User) *PrivacySettings {
+	return &PrivacySettings{
+		Online:       user.OnlineVisibility,
+		LastSeen:     user.LastSeenVisibility,
+		ReadReceipts: user.ReadReceiptsVisibility,
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// lengths in characters, the columns are VARCHAR of the same size
+const (
+	maxDisplayNameLength = 64
+	maxBioLength         = 500
+	maxStatusLength      = 100
+)
+
+var ErrInvalidProfile = errors.New("invalid profile")
+
+// ProfileUpdate - nil fields stay as they are, empty strings clear them
+type ProfileUpdate struct {
+	DisplayName     *string
+	Bio             *string
+	StatusText      *string
+	StatusExpiresAt *time.Time // only together with StatusText, nil keeps the status forever
+	Discoverable    *bool      // found by strangers in the user search
+	ContactsOnlyDms *bool      // only contacts may start direct chats
+}
+
+// UpdateProfile - changes what other users see of the user
+func (s *UserService) UpdateProfile(ctx context.Context, userID string, update ProfileUpdate) (*pgdb.User, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	params := pgdb.UpdateUserProfileParams{
+		ID:              user.ID,
+		DisplayName:     user.DisplayName,
+		Bio:             user.Bio,
+		StatusText:      user.StatusText,
+		StatusExpiresAt: user.StatusExpiresAt,
+		Discoverable:    user.Discoverable,
+		ContactsOnlyDms: user.ContactsOnlyDms,
+	}
+
+	if update.DisplayName != nil {
+		if params.DisplayName, err = profileText("display_name", *update.DisplayName, maxDisplayNameLength); err != nil {
+			return nil, err
+		}
+	}
+	if update.Bio != nil {
+		if params.Bio, err = profileText("bio", *update.Bio, maxBioLength); err != nil {
+			return nil, err
+		}
+	}
+
+	if update.Discoverable != nil {
+		params.Discoverable = *update.Discoverable
+	}
+	if update.ContactsOnlyDms != nil {
+		params.ContactsOnlyDms = *update.ContactsOnlyDms
+	}
+
+	if update.StatusText != nil {
+		if params.StatusText, err = profileText("status_text", *update.StatusText, maxStatusLength); err != nil {
+			return nil, err
+		}
+		params.StatusExpiresAt = pgtype.Timestamptz{}
+		if update.StatusExpiresAt != nil && params.StatusText.Valid {
+			if !update.StatusExpiresAt.After(s.now()) {
+				return nil, fmt.Errorf("%w: status_expires_at is in the past", ErrInvalidProfile)
+			}
+			params.StatusExpiresAt = pgtype.Timestamptz{Time: *update.StatusExpiresAt, Valid: true}
+		}
+	} else if update.StatusExpiresAt != nil {
+		return nil, fmt.Errorf("%w: status_expires_at needs status_text", ErrInvalidProfile)
+	}
+
+	updated, err := s.repo.UpdateUserProfile(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update profile: %w", err)
+	}
+	return &updated, nil
+}
+
+// ActiveStatus - the custom status, unless it expired
+func (s *UserService) ActiveStatus(user *pgdb.User) (string, *time.Time) {
+	if !user.StatusText.Valid {
+		return "", nil
+	}
+	if !user.StatusExpiresAt.Valid {
+		return user.StatusText.String, nil
+	}
+	if !user.StatusExpiresAt.Time.After(s.now()) {
+		return "", nil
+	}
+	expiresAt := user.StatusExpiresAt.Time
+	return user.StatusText.String, &expiresAt
+}
+
+func profileText(field, value string, maxLength int) (pgtype.Text, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return pgtype.Text{}, nil
+	}
+	if !utf8.ValidString(value) {
+		return pgtype.Text{}, fmt.Errorf("%w: %s is not valid UTF-8", ErrInvalidProfile, field)
+	}
+	if utf8.RuneCountInString(value) > maxLength {
+		return pgtype.Text{}, fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidProfile, field, maxLength)
+	}
+	return pgtype.Text{String: value, Valid: true}, nil
+}
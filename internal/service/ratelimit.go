@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrAccountLocked = errors.New("too many failed login attempts")
+
+// Rate - at most Limit requests per Window
+type Rate struct {
+	Limit  int
+	Window time.Duration
+}
+
+// ParseRate - "requests/window", e.g. "10/1m"
+func ParseRate(s string) (Rate, error) {
+	limit, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("invalid rate %q, expected requests/window", s)
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q: bad request count", s)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q: bad window", s)
+	}
+	return Rate{Limit: n, Window: d}, nil
+}
+
+// slidingWindow - KEYS[1] holds the times of the requests let through within
+// the window. Returns 0 when the request is let through, otherwise how many
+// milliseconds until the oldest one leaves the window.
+var slidingWindow = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return 0
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return tonumber(oldest[2]) + window - now
+`)
+
+// RateLimiter - sliding window counters in Redis, shared by every instance
+type RateLimiter struct {
+	rdb *redis.Client
+	now func() time.Time
+}
+
+func NewRateLimiter(rdb *redis.Client) *RateLimiter {
+	return &RateLimiter{rdb: rdb, now: time.Now}
+}
+
+// Allow - whether one more request under key fits the rate, otherwise how
+// long to wait before retrying
+func (l *RateLimiter) Allow(ctx context.Context, key string, rate Rate) (bool, time.Duration, error) {
+	wait, err := slidingWindow.Run(ctx, l.rdb, []string{"ratelimit:" + key},
+		l.now().UnixMilli(), rate.Window.Milliseconds(), rate.Limit, uuid.NewString(),
+	).Int64()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if wait > 0 {
+		return false, time.Duration(wait) * time.Millisecond, nil
+	}
+	return true, 0, nil
+}
+
+// LockoutError - the account takes no logins for RetryAfter
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrAccountLocked, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockoutError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// LoginGuard - progressive lockout of accounts. After threshold failed
+// logins in a row the account is locked for base, every further failure
+// doubles it up to max. A successful login starts over.
+type LoginGuard struct {
+	rdb       *redis.Client
+	threshold int64
+	base      time.Duration
+	max       time.Duration
+}
+
+func NewLoginGuard(rdb *redis.Client, threshold int, base, max time.Duration) *LoginGuard {
+	return &LoginGuard{rdb: rdb, threshold: int64(threshold), base: base, max: max}
+}
+
+// Check - how long the account stays locked, zero when it isn't
+func (g *LoginGuard) Check(ctx context.Context, account string) (time.Duration, error) {
+	ttl, err := g.rdb.PTTL(ctx, g.key(account, "lock")).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check lockout: %w", err)
+	}
+	if ttl < 0 { // no key, or no expiry
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Fail - counts a failed login, returns the lockout it led to if any
+func (g *LoginGuard) Fail(ctx context.Context, account string) (time.Duration, error) {
+	failuresKey := g.key(account, "failures")
+
+	pipe := g.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, failuresKey)
+	// a streak is forgotten once the longest lockout could have passed
+	pipe.Expire(ctx, failuresKey, 2*g.max)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to count login failure: %w", err)
+	}
+
+	failures := incr.Val()
+	if failures < g.threshold {
+		return 0, nil
+	}
+
+	lock := g.base
+	for i := g.threshold; i < failures && lock < g.max; i++ {
+		lock *= 2
+	}
+	lock = min(lock, g.max)
+	if err := g.rdb.Set(ctx, g.key(account, "lock"), failures, lock).Err(); err != nil {
+		return 0, fmt.Errorf("failed to lock account: %w", err)
+	}
+	return lock, nil
+}
+
+// Succeed - the streak of failures ends
+func (g *LoginGuard) Succeed(ctx context.Context, account string) error {
+	if err := g.rdb.Del(ctx, g.key(account, "failures")).Err(); err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	return nil
+}
+
+// key - accounts are known by the email, the same way for unknown ones,
+// so lockouts don't tell which emails are registered
+func (g *LoginGuard) key(account, suffix string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(account)) + ":" + suffix
+}
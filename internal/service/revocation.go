@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// Every revocation is also published here, so open sockets can be closed
+const revocationChannel = "auth:revocations"
+
+// legacyAccessTTL - tokens from before sessions existed were issued for a
+// day, the middleware accepts them until they expire
+const legacyAccessTTL = 24 * time.Hour
+
+// AccessClaims - what an access token says about its holder
+type AccessClaims struct {
+	UserID    string
+	SessionID string // empty for tokens from before sessions existed
+	TokenID   string // jti
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// Revocation - TokenID revokes one token, SessionID every token of a session.
+// With neither, every token of the user issued before Before is revoked.
+type Revocation struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id,omitempty"`
+	TokenID   string `json:"token_id,omitempty"`
+	Before    int64  `json:"before,omitempty"` // unix ms
+}
+
+// Matches - whether the revocation covers a token with these claims
+func (r Revocation) Matches(c AccessClaims) bool {
+	switch {
+	case c.UserID != r.UserID:
+		return false
+	case r.TokenID != "":
+		return c.TokenID == r.TokenID
+	case r.SessionID != "":
+		return c.SessionID == r.SessionID
+	default:
+		return c.IssuedAt.UnixMilli() < r.Before
+	}
+}
+
+// RevocationService - denylists in Redis. Access tokens are short-lived, so
+// an entry only has to outlive the tokens it revokes.
+//
+//	token:<jti>:revoked                - single token, until it expires
+//	session:<id>:revoked               - tokens of a logged out session
+//	user:<id>:tokens_valid_after (ms)  - tokens issued earlier, e.g. after a password change
+type RevocationService struct {
+	rdb         *redis.Client
+	accessTTL   time.Duration
+	maxTokenTTL time.Duration // of any token the middleware still accepts
+}
+
+func NewRevocationService(rdb *redis.Client, cfg config.Auth) *RevocationService {
+	return &RevocationService{
+		rdb:         rdb,
+		accessTTL:   cfg.AccessTTL,
+		maxTokenTTL: max(cfg.AccessTTL, legacyAccessTTL),
+	}
+}
+
+func (s *RevocationService) RevokeToken(ctx context.Context, claims AccessClaims) error {
+	ttl := time.Until(claims.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := s.rdb.Set(ctx, "token:"+claims.TokenID+":revoked", 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return s.publish(ctx, Revocation{UserID: claims.UserID, TokenID: claims.TokenID})
+}
+
+func (s *RevocationService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if err := s.rdb.Set(ctx, "session:"+sessionID+":revoked", 1, s.accessTTL).Err(); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return s.publish(ctx, Revocation{UserID: userID, SessionID: sessionID})
+}
+
+// RevokeUser - every token issued until now stops working, day-long tokens
+// without a session included
+func (s *RevocationService) RevokeUser(ctx context.Context, userID string) error {
+	now := time.Now().UnixMilli()
+	if err := s.rdb.Set(ctx, "user:"+userID+":tokens_valid_after", now, s.maxTokenTTL).Err(); err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+	return s.publish(ctx, Revocation{UserID: userID, Before: now})
+}
+
+// IsRevoked - one round trip for all three lists
+func (s *RevocationService) IsRevoked(ctx context.Context, claims AccessClaims) (bool, error) {
+	values, err := s.rdb.MGet(ctx,
+		"user:"+claims.UserID+":tokens_valid_after",
+		"token:"+claims.TokenID+":revoked",
+		"session:"+claims.SessionID+":revoked",
+	).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check revocation: %w", err)
+	}
+
+	if validAfter, ok := values[0].(string); ok {
+		ms, _ := strconv.ParseInt(validAfter, 10, 64)
+		if claims.IssuedAt.UnixMilli() < ms {
+			return true, nil
+		}
+	}
+	if claims.TokenID != "" && values[1] != nil {
+		return true, nil
+	}
+	if claims.SessionID != "" && values[2] != nil {
+		return true, nil
+	}
+	return false, nil
+}
+
+// Subscribe - revocations from every instance, until ctx is done
+func (s *RevocationService) Subscribe(ctx context.Context) <-chan Revocation {
+	out := make(chan Revocation)
+	pubsub := s.rdb.Subscribe(ctx, revocationChannel)
+
+	go func() {
+		<-ctx.Done()
+		pubsub.Close()
+	}()
+
+	go func() {
+		defer close(out)
+
+		for msg := range pubsub.Channel() {
+			var rev Revocation
+			if err := json.Unmarshal([]byte(msg.Payload), &rev); err != nil {
+				slog.Warn("invalid revocation message", "error", err)
+				continue
+			}
+			select {
+			case out <- rev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (s *RevocationService) publish(ctx context.Context, rev Revocation) error {
+	payload, err := json.Marshal(rev)
+	if err != nil {
+		return fmt.Errorf("failed to encode revocation: %w", err)
+	}
+	if err := s.rdb.Publish(ctx, revocationChannel, payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish revocation: %w", err)
+	}
+	return nil
+}
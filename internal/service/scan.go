@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Scan statuses of a file. Only clean files are served.
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+	ScanFailed   = "failed" // the scanner kept failing on it
+)
+
+const (
+	scanBatchSize   = 100
+	maxScanAttempts = 5
+)
+
+// Scanner - checks file content for malware
+type Scanner interface {
+	Scan(ctx context.Context, content io.Reader) (*ScanResult, error)
+}
+
+type ScanResult struct {
+	Infected  bool
+	Signature string // name of the detected malware
+}
+
+// ScanService - gives pending files their verdict. Files come from Enqueue
+// right after upload; the ones left pending by failures or restarts are
+// picked up every interval.
+type ScanService struct {
+	repo    *pgdb.Queries
+	files   *FileService
+	scanner Scanner
+
+	timeout  time.Duration
+	interval time.Duration
+
+	queue     chan *pgdb.File
+	onScanned func(ctx context.Context, file *pgdb.File)
+}
+
+func NewScanService(
+	repo *pgdb.Queries,
+	files *FileService,
+	scanner Scanner,
+	cfg config.Scanner) *ScanService {
+
+	return &ScanService{
+		repo:     repo,
+		files:    files,
+		scanner:  scanner,
+		timeout:  cfg.Timeout,
+		interval: cfg.Interval,
+		queue:    make(chan *pgdb.File, scanBatchSize),
+	}
+}
+
+// OnScanned - fn is called once a file got its verdict, must be set before Run
+func (s *ScanService) OnScanned(fn func(ctx context.Context, file *pgdb.File)) {
+	s.onScanned = fn
+}
+
+// Enqueue - schedules a scan without blocking. If the queue is full,
+// the file waits for the next periodic pass.
+func (s *ScanService) Enqueue(file *pgdb.File) {
+	select {
+	case s.queue <- file:
+	default:
+		slog.Warn("scan queue is full", slog.String("file_id", file.ID.String()))
+	}
+}
+
+// Run - scans files as they come, blocks forever
+func (s *ScanService) Run() {
+	ctx := context.Background()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.scanPending(ctx)
+	for {
+		select {
+		case file := <-s.queue:
+			if err := s.ScanFile(ctx, file); err != nil {
+				slog.Error("failed to scan file", slog.String("file_id", file.ID.String()), slog.String("error", err.Error()))
+			}
+		case <-ticker.C:
+			s.scanPending(ctx)
+		}
+	}
+}
+
+func (s *ScanService) scanPending(ctx context.Context) {
+	files, err := s.repo.ListPendingFiles(ctx, scanBatchSize)
+	if err != nil {
+		slog.Error("failed to list pending files", slog.String("error", err.Error()))
+		return
+	}
+
+	for _, file := range files {
+		if err := s.ScanFile(ctx, &file); err != nil {
+			slog.Error("failed to scan file", slog.String("file_id", file.ID.String()), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// ScanFile - scans a pending file and stores the verdict. On error the file
+// stays pending and is retried later, maxScanAttempts times at most.
+func (s *ScanService) ScanFile(ctx context.Context, file *pgdb.File) error {
+	// 1. Identical content may have been judged already
+	status, err := s.repo.GetScanVerdict(ctx, file.Sha256)
+	if errors.Is(err, pgx.ErrNoRows) {
+		status, err = s.scan(ctx, file)
+		if err != nil {
+			return s.scanFailed(ctx, file, err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// 2. Store the verdict, unless somebody did it first
+	scanned, err := s.repo.SetFileScanStatus(ctx, pgdb.SetFileScanStatusParams{
+		ID:         file.ID,
+		ScanStatus: status,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to set scan status: %w", err)
+	}
+
+	// 3. Infected avatars are removed right away, clean ones get published.
+	// Attachments just stop being served.
+	switch status {
+	case ScanInfected:
+		if err := s.repo.ClearAvatarFile(ctx, scanned.ID); err != nil {
+			return fmt.Errorf("failed to clear avatar: %w", err)
+		}
+	case ScanClean:
+		err := s.repo.PublishAvatarFile(ctx, pgdb.PublishAvatarFileParams{
+			AvatarFileID: scanned.ID,
+			AvatarUrl:    pgtype.Text{String: s.files.PublicURL(scanned.ObjectKey), Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to publish avatar: %w", err)
+		}
+	}
+
+	if s.onScanned != nil {
+		s.onScanned(ctx, &scanned)
+	}
+	return nil
+}
+
+// scanFailed - counts the failed attempt, the last one makes the file failed
+// so it no longer takes up the pending batch. Returns scanErr.
+func (s *ScanService) scanFailed(ctx context.Context, file *pgdb.File, scanErr error) error {
+	failed, err := s.repo.RecordScanFailure(ctx, pgdb.RecordScanFailureParams{
+		MaxAttempts: maxScanAttempts,
+		ID:          file.ID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return scanErr
+		}
+		return fmt.Errorf("failed to record scan failure: %w (scan: %w)", err, scanErr)
+	}
+	if failed.ScanStatus != ScanFailed {
+		return scanErr
+	}
+
+	slog.Warn("file given up on after failed scans",
+		slog.String("file_id", failed.ID.String()),
+		slog.Int("attempts", int(failed.ScanAttempts)),
+	)
+	if err := s.repo.ClearAvatarFile(ctx, failed.ID); err != nil {
+		return fmt.Errorf("failed to clear avatar: %w", err)
+	}
+	if s.onScanned != nil {
+		s.onScanned(ctx, &failed)
+	}
+	return scanErr
+}
+
+func (s *ScanService) scan(ctx context.Context, file *pgdb.File) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	object, err := s.files.GetObject(ctx, file.ObjectKey)
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	result, err := s.scanner.Scan(ctx, object)
+	if err != nil {
+		return "", fmt.Errorf("failed to scan: %w", err)
+	}
+
+	if result.Infected {
+		slog.Warn("infected file quarantined",
+			slog.String("file_id", file.ID.String()),
+			slog.String("owner_id", file.OwnerID.String()),
+			slog.String("signature", result.Signature),
+		)
+		return ScanInfected, nil
+	}
+	return ScanClean, nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	maxSearchQueryLength = 64
+	maxSearchResults     = 50
+	maxSearchOffset      = 1000 // nobody pages deeper, and it keeps int32 from wrapping
+)
+
+var ErrInvalidSearch = errors.New("invalid search query")
+
+// likeEscaper - the query is matched literally, LIKE escapes with a backslash
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchUsers - other users whose username or display name starts with or
+// resembles the query, the user's contacts first. Users who are not
+// discoverable are only found by people who have them as a contact.
+func (s *UserService) SearchUsers(ctx context.Context, userID, query string, limit, offset int) ([]pgdb.SearchUsersRow, error) {
+	var userUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("invalid uuid format: %w", err)
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil, fmt.Errorf("%w: q is required", ErrInvalidSearch)
+	}
+	if !utf8.ValidString(query) || utf8.RuneCountInString(query) > maxSearchQueryLength {
+		return nil, fmt.Errorf("%w: q is longer than %d characters", ErrInvalidSearch, maxSearchQueryLength)
+	}
+
+	limit = min(max(limit, 1), maxSearchResults)
+	offset = min(max(offset, 0), maxSearchOffset)
+
+	users, err := s.repo.SearchUsers(ctx, pgdb.SearchUsersParams{
+		SearcherID: userUUID,
+		Prefix:     likeEscaper.Replace(query) + "%",
+		Query:      query,
+		PageLimit:  int32(limit),
+		PageOffset: int32(offset),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	return users, nil
+}
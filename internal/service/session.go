@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	defaultAccessTTL  = 15 * time.Minute
+	defaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused, session revoked")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+// Device - where a session was started from, shown in the session list
+type Device struct {
+	UserAgent string
+	IPAddress string
+}
+
+// TokenPair - short-lived access token and the refresh token to renew it.
+// Every refresh rotates the refresh token, the old one becomes invalid.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time // of the access token
+	SessionID    string
+}
+
+func (s *UserService) startSession(ctx context.Context, user *pgdb.User, device Device) (*TokenPair, error) {
+	refreshToken, refreshHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.repo.CreateSession(ctx, pgdb.CreateSessionParams{
+		UserID:    user.ID,
+		UserAgent: truncate(device.UserAgent, 512),
+		IpAddress: truncate(device.IPAddress, 64),
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(s.refreshTTL), Valid: true},
+		TokenHash: refreshHash,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return s.issueTokens(user, session.ID, refreshToken)
+}
+
+// Refresh - exchanges a refresh token for a new pair. Presenting an already
+// used token means it was copied, so the whole session is revoked.
+func (s *UserService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	oldHash := hashToken(refreshToken)
+
+	newToken, newHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Rotate
+	sessionID, err := s.repo.RotateRefreshToken(ctx, pgdb.RotateRefreshTokenParams{
+		OldHash:   oldHash,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(s.refreshTTL), Valid: true},
+		NewHash:   newHash,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, s.rejectRefresh(ctx, oldHash)
+		}
+		return nil, fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	// 2. New access token
+	session, err := s.repo.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	user, err := s.repo.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return s.issueTokens(&user, session.ID, newToken)
+}
+
+// rejectRefresh - explains why the rotation found nothing
+func (s *UserService) rejectRefresh(ctx context.Context, tokenHash string) error {
+	token, err := s.repo.GetRefreshToken(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidRefreshToken
+		}
+		return fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if !token.UsedAt.Valid {
+		return ErrInvalidRefreshToken // the session expired
+	}
+
+	slog.Warn("refresh token reuse detected, revoking session", "session_id", token.SessionID.String())
+	if err := s.endSession(ctx, token.SessionID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// Logout - ends the session of the refresh token. Unknown tokens are ignored.
+func (s *UserService) Logout(ctx context.Context, refreshToken string) error {
+	token, err := s.repo.GetRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return s.endSession(ctx, token.SessionID)
+}
+
+// endSession - deletes the session and revokes access tokens issued for it
+func (s *UserService) endSession(ctx context.Context, sessionID pgtype.UUID) error {
+	session, err := s.repo.DeleteSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return s.revokeSession(ctx, session.UserID.String(), session.ID.String())
+}
+
+func (s *UserService) ListSessions(ctx context.Context, userID string) ([]pgdb.Session, error) {
+	var userUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	sessions, err := s.repo.ListUserSessions(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession - logs one of the user's devices out
+func (s *UserService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	var userUUID, sessionUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return fmt.Errorf("invalid user ID: %w", err)
+	}
+	if err := sessionUUID.Scan(sessionID); err != nil {
+		return ErrSessionNotFound
+	}
+
+	deleted, err := s.repo.DeleteUserSession(ctx, pgdb.DeleteUserSessionParams{
+		ID:     sessionUUID,
+		UserID: userUUID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	if deleted == 0 {
+		return ErrSessionNotFound
+	}
+	return s.revokeSession(ctx, userID, sessionID)
+}
+
+// RevokeOtherSessions - logs out every device except the current one
+func (s *UserService) RevokeOtherSessions(ctx context.Context, userID, currentSessionID string) (int64, error) {
+	var userUUID, keepUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return 0, fmt.Errorf("invalid user ID: %w", err)
+	}
+	// tokens from before sessions existed have none, then every session goes
+	keepUUID.Scan(currentSessionID)
+
+	deleted, err := s.repo.DeleteOtherSessions(ctx, pgdb.DeleteOtherSessionsParams{
+		UserID: userUUID,
+		KeepID: keepUUID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+
+	for _, sessionID := range deleted {
+		if err := s.revokeSession(ctx, userID, sessionID.String()); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(deleted)), nil
+}
+
+// SetRevocations - without it logged out sessions keep their access tokens until expiry
+func (s *UserService) SetRevocations(revocations *RevocationService) {
+	s.revocations = revocations
+}
+
+// IsRevoked - whether the access token was revoked before its expiry
+func (s *UserService) IsRevoked(ctx context.Context, claims AccessClaims) (bool, error) {
+	if s.revocations == nil {
+		return false, nil
+	}
+	return s.revocations.IsRevoked(ctx, claims)
+}
+
+// RevokeAllTokens - logs the user out everywhere, e.g. after a password change
+func (s *UserService) RevokeAllTokens(ctx context.Context, userID pgtype.UUID) error {
+	if _, err := s.repo.DeleteOtherSessions(ctx, pgdb.DeleteOtherSessionsParams{UserID: userID}); err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	if s.revocations == nil {
+		return nil
+	}
+	return s.revocations.RevokeUser(ctx, userID.String())
+}
+
+func (s *UserService) revokeSession(ctx context.Context, userID, sessionID string) error {
+	if s.revocations == nil {
+		return nil
+	}
+	return s.revocations.RevokeSession(ctx, userID, sessionID)
+}
+
+// RunSessionCleanup - deletes expired sessions, login challenges and email
+// links every interval, blocks forever
+func (s *UserService) RunSessionCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+		now := pgtype.Timestamptz{Time: s.now(), Valid: true}
+
+		logCleanup("sessions", func() (int64, error) { return s.repo.DeleteExpiredSessions(ctx) })
+		logCleanup("login challenges", func() (int64, error) { return s.repo.DeleteExpiredLoginChallenges(ctx, now) })
+		logCleanup("email tokens", func() (int64, error) { return s.repo.DeleteExpiredEmailTokens(ctx, now) })
+	}
+}
+
+func logCleanup(what string, deleteExpired func() (int64, error)) {
+	deleted, err := deleteExpired()
+	if err != nil {
+		slog.Error("failed to delete expired "+what, "error", err)
+		return
+	}
+	if deleted > 0 {
+		slog.Info("expired "+what+" deleted", "count", deleted)
+	}
+}
+
+func (s *UserService) issueTokens(user *pgdb.User, sessionID pgtype.UUID, refreshToken string) (*TokenPair, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.accessTTL)
+
+	// iat has millisecond precision, a token issued right after a revocation must stay valid
+	accessToken, err := s.keys.Sign(jwt.MapClaims{
+		"user_id":  user.ID.String(),
+		"username": user.Username,
+		"sid":      sessionID.String(),
+		"jti":      uuid.New().String(),
+		"iat":      float64(now.UnixMilli()) / 1000,
+		"exp":      expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+		SessionID:    sessionID.String(),
+	}, nil
+}
+
+// newOpaqueToken - random token for refresh tokens and links, and the hash it is stored under
+func newOpaqueToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TicketTTL - enough to open the socket right after asking for a ticket
+const TicketTTL = 30 * time.Second
+
+var ErrInvalidTicket = errors.New("invalid or expired ticket")
+
+// TicketService - single-use tickets for the WebSocket upgrade. Browsers
+// can't set headers there, and a JWT in the URL ends up in access logs.
+type TicketService struct {
+	rdb         *redis.Client
+	revocations *RevocationService
+}
+
+func NewTicketService(rdb *redis.Client, revocations *RevocationService) *TicketService {
+	return &TicketService{
+		rdb:         rdb,
+		revocations: revocations,
+	}
+}
+
+// Issue - the ticket stands for the access token it was issued with
+func (s *TicketService) Issue(ctx context.Context, claims AccessClaims) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ticket: %w", err)
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(b)
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode ticket: %w", err)
+	}
+	if err := s.rdb.Set(ctx, ticketKey(ticket), payload, TicketTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to store ticket: %w", err)
+	}
+	return ticket, nil
+}
+
+// Redeem - GETDEL, so a ticket works once even with concurrent attempts
+func (s *TicketService) Redeem(ctx context.Context, ticket string) (*AccessClaims, error) {
+	payload, err := s.rdb.GetDel(ctx, ticketKey(ticket)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidTicket
+		}
+		return nil, fmt.Errorf("failed to redeem ticket: %w", err)
+	}
+
+	var claims AccessClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("failed to decode ticket: %w", err)
+	}
+
+	// the token may have been revoked after the ticket was issued
+	if s.revocations != nil {
+		revoked, err := s.revocations.IsRevoked(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrInvalidTicket
+		}
+	}
+	return &claims, nil
+}
+
+func ticketKey(ticket string) string {
+	return "ws_ticket:" + ticket
+}
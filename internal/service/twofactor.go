@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	totpIssuer           = "go-messenger"
+	recoveryCodeCount    = 10
+	loginChallengeTTL    = 5 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	ErrInvalidCode         = errors.New("invalid code")
+	ErrInvalidChallenge    = errors.New("invalid or expired login challenge")
+)
+
+// LoginResult - tokens, or a challenge when the user has 2FA on
+type LoginResult struct {
+	Tokens    *TokenPair
+	Challenge *LoginChallenge
+}
+
+// LoginChallenge - completed with CompleteLogin and a TOTP or recovery code
+type LoginChallenge struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// TOTPSetup - what the authenticator app has to be given
+type TOTPSetup struct {
+	Secret string
+	URI    string
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool
+	RecoveryCodesLeft int64
+}
+
+// SetClock - TOTP codes and challenges depend on the time, tests move it
+func (s *UserService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// SetupTOTP - starts enrollment, 2FA is on only after ConfirmTOTP
+func (s *UserService) SetupTOTP(ctx context.Context, userID string) (*TOTPSetup, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.repo.SetTOTPSecret(ctx, pgdb.SetTOTPSecretParams{
+		UserID: user.ID,
+		Secret: secret,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store totp secret: %w", err)
+	}
+	if stored == 0 {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	return &TOTPSetup{
+		Secret: secret,
+		URI:    TOTPURI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP - the first valid code turns 2FA on. Returns the recovery
+// codes, they are never shown again.
+func (s *UserService) ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	userUUID, err := parseUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Pending enrollment
+	totp, err := s.repo.GetTOTP(ctx, userUUID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTwoFactorNotEnabled
+		}
+		return nil, fmt.Errorf("failed to get totp: %w", err)
+	}
+	if totp.EnabledAt.Valid {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	// 2. Code from the app
+	now := s.now()
+	step, ok := matchTOTP(totp.Secret, code, now)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	// 3. Recovery codes first, so 2FA is never on without them
+	codes, err := s.replaceRecoveryCodes(ctx, userUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled, err := s.repo.EnableTOTP(ctx, pgdb.EnableTOTPParams{
+		UserID:    userUUID,
+		EnabledAt: pgtype.Timestamptz{Time: now, Valid: true},
+		LastStep:  step,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable totp: %w", err)
+	}
+	if enabled == 0 {
+		return nil, ErrTwoFactorEnabled
+	}
+	return codes, nil
+}
+
+// DisableTOTP - needs a current TOTP or recovery code
+func (s *UserService) DisableTOTP(ctx context.Context, userID, code string) error {
+	userUUID, err := parseUserID(userID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifySecondFactor(ctx, userUUID, code); err != nil {
+		return err
+	}
+
+	if err := s.repo.DeleteTOTP(ctx, userUUID); err != nil {
+		return fmt.Errorf("failed to delete totp: %w", err)
+	}
+	if err := s.repo.DeleteRecoveryCodes(ctx, userUUID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes - the old codes stop working
+func (s *UserService) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	userUUID, err := parseUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.verifySecondFactor(ctx, userUUID, code); err != nil {
+		return nil, err
+	}
+	return s.replaceRecoveryCodes(ctx, userUUID)
+}
+
+func (s *UserService) TwoFactorStatus(ctx context.Context, userID string) (*TwoFactorStatus, error) {
+	userUUID, err := parseUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled, err := s.twoFactorEnabled(ctx, userUUID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return &TwoFactorStatus{}, nil
+	}
+
+	left, err := s.repo.CountUnusedRecoveryCodes(ctx, userUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return &TwoFactorStatus{Enabled: true, RecoveryCodesLeft: left}, nil
+}
+
+// CompleteLogin - second step of the login, a challenge takes a few attempts at most
+func (s *UserService) CompleteLogin(ctx context.Context, challengeID, code string, device Device) (*TokenPair, error) {
+	var challengeUUID pgtype.UUID
+	if err := challengeUUID.Scan(challengeID); err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	// 1. Count the attempt
+	challenge, err := s.repo.AttemptLoginChallenge(ctx, pgdb.AttemptLoginChallengeParams{
+		ID:          challengeUUID,
+		MaxAttempts: maxChallengeAttempts,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, fmt.Errorf("failed to get login challenge: %w", err)
+	}
+	if !s.now().Before(challenge.ExpiresAt.Time) {
+		return nil, ErrInvalidChallenge
+	}
+
+	// 2. Second factor
+	if err := s.verifySecondFactor(ctx, challenge.UserID, code); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.DeleteLoginChallenge(ctx, challenge.ID); err != nil {
+		return nil, fmt.Errorf("failed to delete login challenge: %w", err)
+	}
+
+	// 3. Session
+	user, err := s.repo.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return s.startSession(ctx, &user, device)
+}
+
+// startLogin - the password was right, decides whether a second factor is needed
+func (s *UserService) startLogin(ctx context.Context, user *pgdb.User, device Device) (*LoginResult, error) {
+	enabled, err := s.twoFactorEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !enabled {
+		tokens, err := s.startSession(ctx, user, device)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{Tokens: tokens}, nil
+	}
+
+	challenge, err := s.repo.CreateLoginChallenge(ctx, pgdb.CreateLoginChallengeParams{
+		UserID:    user.ID,
+		ExpiresAt: pgtype.Timestamptz{Time: s.now().Add(loginChallengeTTL), Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create login challenge: %w", err)
+	}
+	return &LoginResult{Challenge: &LoginChallenge{
+		ID:        challenge.ID.String(),
+		ExpiresAt: challenge.ExpiresAt.Time,
+	}}, nil
+}
+
+func (s *UserService) twoFactorEnabled(ctx context.Context, userID pgtype.UUID) (bool, error) {
+	totp, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get totp: %w", err)
+	}
+	return totp.EnabledAt.Valid, nil
+}
+
+// verifySecondFactor - six digits are a TOTP code, anything else a recovery code.
+// Both work once: a TOTP step can't be used again, a recovery code is marked used.
+func (s *UserService) verifySecondFactor(ctx context.Context, userID pgtype.UUID, code string) error {
+	totp, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTwoFactorNotEnabled
+		}
+		return fmt.Errorf("failed to get totp: %w", err)
+	}
+	if !totp.EnabledAt.Valid {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		step, ok := matchTOTP(totp.Secret, code, s.now())
+		if !ok {
+			return ErrInvalidCode
+		}
+
+		used, err := s.repo.UseTOTPStep(ctx, pgdb.UseTOTPStepParams{
+			UserID:   userID,
+			LastStep: step,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to use totp code: %w", err)
+		}
+		if used == 0 {
+			return ErrInvalidCode // replayed
+		}
+		return nil
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, pgdb.UseRecoveryCodeParams{
+		UserID:   userID,
+		CodeHash: hashRecoveryCode(code),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if used == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+func (s *UserService) replaceRecoveryCodes(ctx context.Context, userID pgtype.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	err := s.repo.ReplaceRecoveryCodes(ctx, pgdb.ReplaceRecoveryCodesParams{
+		UserID:     userID,
+		CodeHashes: hashes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode - case and dashes don't matter when typing a code
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(code, "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func parseUserID(userID string) (pgtype.UUID, error) {
+	var userUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return userUUID, fmt.Errorf("invalid user ID: %w", err)
+	}
+	return userUUID, nil
+}
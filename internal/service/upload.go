@@ -0,0 +1,504 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/minio/minio-go/v7"
+)
+
+var (
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadExpired        = errors.New("upload expired")
+	ErrUploadTooLarge       = errors.New("upload exceeds maximum size")
+	ErrUploadEmpty          = errors.New("upload length must be positive")
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrChunkNotAligned      = errors.New("chunk size must be a multiple of the part size")
+	ErrFileNotFound         = errors.New("file not found")
+	ErrFilePending          = errors.New("file is being scanned")
+	ErrFileInfected         = errors.New("file is quarantined")
+	ErrFileScanFailed       = errors.New("file could not be scanned")
+)
+
+const downloadURLTTL = 15 * time.Minute
+
+// UploadService - resumable uploads on top of MinIO multipart uploads.
+// Progress is persisted part by part, so a broken connection only loses
+// the part that was in flight.
+type UploadService struct {
+	repo     *pgdb.Queries
+	pool     *pgxpool.Pool
+	files    *FileService
+	maxSize  int64
+	partSize int64
+	ttl      time.Duration
+}
+
+func NewUploadService(repo *pgdb.Queries, pool *pgxpool.Pool, files *FileService, cfg config.Uploads) *UploadService {
+	return &UploadService{
+		repo:     repo,
+		pool:     pool,
+		files:    files,
+		maxSize:  cfg.MaxSize,
+		partSize: cfg.PartSize,
+		ttl:      cfg.TTL,
+	}
+}
+
+func (s *UploadService) MaxSize() int64 {
+	return s.maxSize
+}
+
+func (s *UploadService) PartSize() int64 {
+	return s.partSize
+}
+
+// CreateUpload - opens an upload session of a known total size
+func (s *UploadService) CreateUpload(
+	ctx context.Context,
+	userID string,
+	fileName string,
+	contentType string,
+	size int64) (*pgdb.Upload, error) {
+
+	if size <= 0 {
+		return nil, ErrUploadEmpty
+	}
+	if size > s.maxSize {
+		return nil, ErrUploadTooLarge
+	}
+
+	var userUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	if err := s.files.CheckQuota(ctx, userUUID, size); err != nil {
+		return nil, err
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	objectKey := uuid.New().String() + filepath.Ext(fileName)
+
+	minioUploadID, err := s.files.NewMultipartUpload(ctx, objectKey, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	upload, err := s.repo.CreateUpload(ctx, pgdb.CreateUploadParams{
+		UserID:        userUUID,
+		ObjectKey:     objectKey,
+		MinioUploadID: minioUploadID,
+		FileName:      fileName,
+		ContentType:   contentType,
+		TotalSize:     size,
+		ExpiresAt:     pgtype.Timestamptz{Time: time.Now().Add(s.ttl), Valid: true},
+	})
+	if err != nil {
+		s.files.AbortMultipartUpload(ctx, objectKey, minioUploadID)
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	return &upload, nil
+}
+
+// GetUpload - returns the session if it belongs to the user and is still alive
+func (s *UploadService) GetUpload(ctx context.Context, userID, uploadID string) (*pgdb.Upload, error) {
+	var uploadUUID, userUUID pgtype.UUID
+	if err := uploadUUID.Scan(uploadID); err != nil {
+		return nil, ErrUploadNotFound
+	}
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	upload, err := s.repo.GetUpload(ctx, pgdb.GetUploadParams{
+		ID:     uploadUUID,
+		UserID: userUUID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to get upload: %w", err)
+	}
+
+	if !upload.FileID.Valid && upload.ExpiresAt.Time.Before(time.Now()) {
+		return nil, ErrUploadExpired
+	}
+	return &upload, nil
+}
+
+// WriteChunk - appends data starting at offset. Only whole parts are stored,
+// the returned upload carries the offset the client must resume from.
+func (s *UploadService) WriteChunk(
+	ctx context.Context,
+	userID, uploadID string,
+	offset int64,
+	data io.Reader) (*pgdb.Upload, error) {
+
+	upload, err := s.GetUpload(ctx, userID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.UploadOffset != offset {
+		return upload, ErrUploadOffsetMismatch
+	}
+
+	hash, err := restoreHash(upload.HashState)
+	if err != nil {
+		return upload, err
+	}
+
+	buf := make([]byte, s.partSize)
+	for upload.UploadOffset < upload.TotalSize {
+		// 1. Read exactly one part (the last one may be shorter)
+		size := min(s.partSize, upload.TotalSize-upload.UploadOffset)
+
+		n, readErr := io.ReadFull(data, buf[:size])
+		if int64(n) < size {
+			if errors.Is(readErr, io.ErrUnexpectedEOF) && upload.UploadOffset == offset {
+				return upload, ErrChunkNotAligned
+			}
+			// client disconnected or sent a partial part - keep what was stored
+			break
+		}
+
+		// 2. Store the part
+		partNumber := int32(upload.UploadOffset/s.partSize) + 1
+
+		etag, err := s.files.UploadPart(
+			ctx, upload.ObjectKey, upload.MinioUploadID,
+			int(partNumber), bytes.NewReader(buf[:size]), size,
+		)
+		if err != nil {
+			return upload, err
+		}
+
+		hash.Write(buf[:size])
+		hashState, err := hash.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return upload, fmt.Errorf("failed to save hash state: %w", err)
+		}
+
+		// 3. Move the offset and record the part together, unless a concurrent
+		// request already did. Completion checks the recorded ETags, so a part
+		// overwritten by a losing request can't sneak into the file.
+		if err := s.commitPart(ctx, upload, partNumber, etag, size, hashState); err != nil {
+			return upload, err
+		}
+		upload.UploadOffset += size
+		upload.HashState = hashState
+	}
+
+	if upload.UploadOffset == upload.TotalSize && !upload.FileID.Valid {
+		if err := s.finalize(ctx, upload); err != nil {
+			return upload, err
+		}
+	}
+	return upload, nil
+}
+
+func (s *UploadService) commitPart(
+	ctx context.Context,
+	upload *pgdb.Upload,
+	partNumber int32,
+	etag string,
+	size int64,
+	hashState []byte) error {
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := s.repo.WithTx(tx)
+
+	updated, err := qtx.AdvanceUploadOffset(ctx, pgdb.AdvanceUploadOffsetParams{
+		NewOffset:      upload.UploadOffset + size,
+		HashState:      hashState,
+		ID:             upload.ID,
+		ExpectedOffset: upload.UploadOffset,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to advance upload offset: %w", err)
+	}
+	if updated == 0 {
+		return ErrUploadOffsetMismatch
+	}
+
+	err = qtx.AddUploadPart(ctx, pgdb.AddUploadPartParams{
+		UploadID:   upload.ID,
+		PartNumber: partNumber,
+		Etag:       etag,
+		Size:       size,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save upload part: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// finalize - registers the file. Parts are glued together only if the content
+// is new, otherwise the upload is dropped in favour of the stored copy.
+func (s *UploadService) finalize(ctx context.Context, upload *pgdb.Upload) error {
+	hash, err := restoreHash(upload.HashState)
+	if err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	// 1. Known content - no need to keep the parts. It stays locked until
+	// the file references it.
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { tx.Rollback(ctx) }()
+
+	objectKey, exists, err := s.files.lockBlob(ctx, s.repo.WithTx(tx), sum)
+	if err != nil {
+		return err
+	}
+	if exists {
+		s.dropParts(ctx, upload)
+	} else {
+		// nothing is locked, the transaction isn't held while parts are glued
+		tx.Rollback(ctx)
+		if err := s.completeMultipart(ctx, upload); err != nil {
+			return err
+		}
+		objectKey = upload.ObjectKey
+
+		next, err := s.pool.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		tx = next
+	}
+
+	// 2. Record the file
+	qtx := s.repo.WithTx(tx)
+
+	file, err := s.files.SaveFile(ctx, qtx, NewFile{
+		OwnerID:     upload.UserID,
+		Sha256:      sum,
+		ObjectKey:   objectKey,
+		FileName:    upload.FileName,
+		ContentType: upload.ContentType,
+		Size:        upload.TotalSize,
+	})
+	if err != nil {
+		if errors.Is(err, ErrQuotaExceeded) {
+			s.discard(ctx, upload, !exists)
+		}
+		return err
+	}
+
+	err = qtx.CompleteUpload(ctx, pgdb.CompleteUploadParams{
+		ID:     upload.ID,
+		FileID: file.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete upload: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	// the same content was finished concurrently, ours is a duplicate
+	if !exists && file.ObjectKey != upload.ObjectKey {
+		s.files.RemoveObject(ctx, upload.ObjectKey)
+	}
+
+	s.files.QueueScan(file)
+	upload.FileID = file.ID
+	return nil
+}
+
+// completeMultipart - glues the parts into the object. A retry after a failed
+// commit finds the object already glued, MinIO has forgotten the upload by then.
+func (s *UploadService) completeMultipart(ctx context.Context, upload *pgdb.Upload) error {
+	completed, err := s.files.ObjectExists(ctx, upload.ObjectKey, upload.TotalSize)
+	if err != nil {
+		return err
+	}
+	if completed {
+		return nil
+	}
+
+	parts, err := s.repo.ListUploadParts(ctx, upload.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list upload parts: %w", err)
+	}
+
+	completeParts := make([]minio.CompletePart, 0, len(parts))
+	for _, p := range parts {
+		completeParts = append(completeParts, minio.CompletePart{
+			PartNumber: int(p.PartNumber),
+			ETag:       p.Etag,
+		})
+	}
+
+	return s.files.CompleteMultipartUpload(ctx, upload.ObjectKey, upload.MinioUploadID, completeParts)
+}
+
+// dropParts - gets rid of the data of a duplicate upload, whether it is
+// still in parts or an earlier attempt already glued them
+func (s *UploadService) dropParts(ctx context.Context, upload *pgdb.Upload) {
+	completed, err := s.files.ObjectExists(ctx, upload.ObjectKey, upload.TotalSize)
+	if err != nil {
+		slog.Warn("failed to check duplicate upload", "upload_id", upload.ID.String(), "error", err)
+	}
+	if completed {
+		err = s.files.RemoveObject(ctx, upload.ObjectKey)
+	} else {
+		err = s.files.AbortMultipartUpload(ctx, upload.ObjectKey, upload.MinioUploadID)
+	}
+	if err != nil {
+		slog.Warn("failed to drop duplicate upload", "upload_id", upload.ID.String(), "error", err)
+	}
+}
+
+// discard - drops a session whose data can't be kept
+func (s *UploadService) discard(ctx context.Context, upload *pgdb.Upload, completed bool) {
+	if completed {
+		s.files.RemoveObject(ctx, upload.ObjectKey)
+	}
+	if err := s.repo.DeleteUpload(ctx, upload.ID); err != nil {
+		slog.Error("failed to delete upload", "upload_id", upload.ID.String(), "error", err)
+	}
+}
+
+// restoreHash - SHA-256 state is persisted between chunks, so the whole file
+// never has to be read again
+func restoreHash(state []byte) (hash.Hash, error) {
+	h := sha256.New()
+	if state == nil {
+		return h, nil
+	}
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, fmt.Errorf("failed to restore hash state: %w", err)
+	}
+	return h, nil
+}
+
+// AbortUpload - drops an unfinished session together with stored parts
+func (s *UploadService) AbortUpload(ctx context.Context, userID, uploadID string) error {
+	upload, err := s.GetUpload(ctx, userID, uploadID)
+	if err != nil {
+		return err
+	}
+
+	if !upload.FileID.Valid {
+		if err := s.files.AbortMultipartUpload(ctx, upload.ObjectKey, upload.MinioUploadID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repo.DeleteUpload(ctx, upload.ID); err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	return nil
+}
+
+// CleanupExpired - aborts sessions that were never finished in time
+func (s *UploadService) CleanupExpired(ctx context.Context) (int, error) {
+	uploads, err := s.repo.ListExpiredUploads(ctx, 100)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expired uploads: %w", err)
+	}
+
+	removed := 0
+	for _, upload := range uploads {
+		if err := s.files.AbortMultipartUpload(ctx, upload.ObjectKey, upload.MinioUploadID); err != nil {
+			slog.Warn("failed to abort expired upload", "upload_id", upload.ID.String(), "error", err)
+		}
+		if err := s.repo.DeleteUpload(ctx, upload.ID); err != nil {
+			return removed, fmt.Errorf("failed to delete upload: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RunCleanup - periodically removes expired uploads, blocks forever
+func (s *UploadService) RunCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		removed, err := s.CleanupExpired(context.Background())
+		if err != nil {
+			slog.Error("failed to cleanup uploads", "error", err)
+			continue
+		}
+		if removed > 0 {
+			slog.Info("expired uploads removed", "count", removed)
+		}
+	}
+}
+
+// GetFile - file metadata, if the user owns it or it was shared in one of their chats
+func (s *UploadService) GetFile(ctx context.Context, userID, fileID string) (*pgdb.File, error) {
+	var fileUUID, userUUID pgtype.UUID
+	if err := fileUUID.Scan(fileID); err != nil {
+		return nil, ErrFileNotFound
+	}
+	if err := userUUID.Scan(userID); err != nil {
+		return nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	canAccess, err := s.repo.CanAccessFile(ctx, pgdb.CanAccessFileParams{
+		FileID: fileUUID,
+		UserID: userUUID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check file access: %w", err)
+	}
+	if !canAccess {
+		return nil, ErrFileNotFound
+	}
+
+	file, err := s.repo.GetFileByID(ctx, fileUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+	return &file, nil
+}
+
+// DownloadURL - only files that passed the scan are served
+func (s *UploadService) DownloadURL(ctx context.Context, file *pgdb.File) (string, error) {
+	switch file.ScanStatus {
+	case ScanPending:
+		return "", ErrFilePending
+	case ScanInfected:
+		return "", ErrFileInfected
+	case ScanFailed:
+		return "", ErrFileScanFailed
+	}
+	return s.files.PresignedURL(ctx, file.ObjectKey, file.FileName, downloadURLTTL)
+}
@@ -4,28 +4,66 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
+	"github.com/Adopten123/go-messenger/internal/config"
 	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
 type UserService struct {
 	repo        *pgdb.Queries
-	tokenSecret string
+	keys        *KeySet
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	revocations *RevocationService
+	loginGuard  *LoginGuard
+	now         func() time.Time
+
+	mailer           Mailer
+	linkBaseURL      string
+	verificationTTL  time.Duration
+	passwordResetTTL time.Duration
 }
 
 func NewUserService(repo *pgdb.Queries, tokenSecret string) *UserService {
 	return &UserService{
-		repo:        repo,
-		tokenSecret: tokenSecret,
+		repo:       repo,
+		keys:       NewHMACKeySet(tokenSecret),
+		accessTTL:  defaultAccessTTL,
+		refreshTTL: defaultRefreshTTL,
+		now:        time.Now,
+
+		verificationTTL:  defaultVerificationTTL,
+		passwordResetTTL: defaultPasswordResetTTL,
 	}
 }
 
+// SetTokenTTL - overrides the default token lifetimes
+func (s *UserService) SetTokenTTL(cfg config.Auth) {
+	s.accessTTL = cfg.AccessTTL
+	s.refreshTTL = cfg.RefreshTTL
+	s.verificationTTL = cfg.VerificationTTL
+	s.passwordResetTTL = cfg.PasswordResetTTL
+}
+
+// SetKeySet - replaces the token secret, e.g. with asymmetric keys
+func (s *UserService) SetKeySet(keys *KeySet) {
+	s.keys = keys
+}
+
+// Keys - what access tokens are signed and verified with
+func (s *UserService) Keys() *KeySet {
+	return s.keys
+}
+
 func (s *UserService) CreateUser(ctx context.Context, email, username, password string) (*pgdb.User, error) {
 	// Main registration method
 	passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -50,51 +88,105 @@ func (s *UserService) CreateUser(ctx context.Context, email, username, password
 
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
+
+	// the user can ask for another one, registration doesn't fail on it
+	if err := s.SendVerificationEmail(ctx, &user); err != nil {
+		slog.Error("failed to send verification email", "error", err)
+	}
 	return &user, nil
 }
 
-func (s *UserService) Login(ctx context.Context, email, password string) (string, error) {
+// Login - checks credentials and starts a new session for the device,
+// with 2FA on the session starts after CompleteLogin
+func (s *UserService) Login(ctx context.Context, email, password string, device Device) (*LoginResult, error) {
+	if err := s.checkLockout(ctx, email); err != nil {
+		return nil, err
+	}
+
 	user, err := s.repo.GetUserByEmail(ctx, email)
 	if err != nil {
-		return "", fmt.Errorf("invalid credentials: %w", err)
+		if lockErr := s.loginFailed(ctx, email); lockErr != nil {
+			return nil, lockErr
+		}
+		return nil, fmt.Errorf("invalid credentials: %w", err)
 	}
 
 	// Comparing passwords
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 	if err != nil {
-		return "", fmt.Errorf("invalid credentials")
+		if lockErr := s.loginFailed(ctx, email); lockErr != nil {
+			return nil, lockErr
+		}
+		return nil, fmt.Errorf("invalid credentials")
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID.String(),
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
+	if s.loginGuard != nil {
+		if err := s.loginGuard.Succeed(ctx, email); err != nil {
+			slog.Error("failed to reset login failures", "error", err)
+		}
+	}
+	return s.startLogin(ctx, &user, device)
+}
+
+// SetLoginGuard - without it failed logins are not limited per account
+func (s *UserService) SetLoginGuard(guard *LoginGuard) {
+	s.loginGuard = guard
+}
+
+// checkLockout - a Redis outage doesn't stop logins, it is only logged
+func (s *UserService) checkLockout(ctx context.Context, email string) error {
+	if s.loginGuard == nil {
+		return nil
+	}
+	locked, err := s.loginGuard.Check(ctx, email)
+	if err != nil {
+		slog.Error("failed to check lockout", "error", err)
+		return nil
+	}
+	if locked > 0 {
+		return &LockoutError{RetryAfter: locked}
+	}
+	return nil
+}
 
-	// Add secret key to token
-	tokenString, err := token.SignedString([]byte(s.tokenSecret))
+// loginFailed - returns a LockoutError when this failure locked the account
+func (s *UserService) loginFailed(ctx context.Context, email string) error {
+	if s.loginGuard == nil {
+		return nil
+	}
+	locked, err := s.loginGuard.Fail(ctx, email)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign token: %w", err)
+		slog.Error("failed to count login failure", "error", err)
+		return nil
 	}
-	return tokenString, nil
+	if locked > 0 {
+		return &LockoutError{RetryAfter: locked}
+	}
+	return nil
 }
 
-func (s *UserService) UpdateAvatar(ctx context.Context, userID pgtype.UUID, avatarURL string) error {
+// UpdateAvatar - the previous avatar file becomes unreferenced and is collected by the GC
+func (s *UserService) UpdateAvatar(ctx context.Context, userID pgtype.UUID, avatarURL string, fileID pgtype.UUID) error {
 	return s.repo.UpdateUserAvatar(ctx, pgdb.UpdateUserAvatarParams{
-		ID:        userID,
-		AvatarUrl: pgtype.Text{String: avatarURL, Valid: true},
+		ID:           userID,
+		AvatarUrl:    pgtype.Text{String: avatarURL, Valid: true},
+		AvatarFileID: fileID,
 	})
 }
 
+// GetUser - ErrUserNotFound for unknown and malformed IDs alike
 func (s *UserService) GetUser(ctx context.Context, id string) (*pgdb.User, error) {
 	var userUUID pgtype.UUID
 	if err := userUUID.Scan(id); err != nil {
-		return nil, fmt.Errorf("invalid uuid format: %w", err)
+		return nil, fmt.Errorf("%w: invalid uuid format: %w", ErrUserNotFound, err)
 	}
 
 	user, err := s.repo.GetUserByID(ctx, userUUID)
 	if err != nil {
-		return nil, fmt.Errorf("user not found: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	return &user, nil
@@ -106,4 +198,4 @@ func (s *UserService) GetUserByEmail(ctx context.Context, email string) (pgdb.Us
 		return pgdb.User{}, fmt.Errorf("user not found: %w", err)
 	}
 	return user, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// VoiceService - voice notes are regular files with duration and waveform attached
+type VoiceService struct {
+	repo  *pgdb.Queries
+	files *FileService
+}
+
+func NewVoiceService(repo *pgdb.Queries, files *FileService) *VoiceService {
+	return &VoiceService{
+		repo:  repo,
+		files: files,
+	}
+}
+
+// StoreVoice - analyzes the recording, stores it and records its metadata.
+// The content type comes from the detected container, not from the client.
+func (s *VoiceService) StoreVoice(
+	ctx context.Context,
+	ownerID string,
+	file io.ReadSeeker,
+	fileSize int64,
+	originalName string) (*pgdb.File, error) {
+
+	// 1. Check it's audio we understand before storing anything
+	info, err := AnalyzeAudio(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind file: %w", err)
+	}
+
+	// 2. Store
+	stored, err := s.files.StoreFile(ctx, ownerID, file, fileSize, originalName, info.ContentType)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Attach metadata, the duration is bounded by maxAudioDuration
+	voice, err := s.repo.SetFileVoice(ctx, pgdb.SetFileVoiceParams{
+		ID:         stored.ID,
+		DurationMs: pgtype.Int4{Int32: int32(info.Duration.Milliseconds()), Valid: true},
+		Waveform:   info.Waveform,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save voice metadata: %w", err)
+	}
+	return &voice, nil
+}
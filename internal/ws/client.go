@@ -3,7 +3,10 @@ package ws
 import (
 	"context"
 	"log/slog"
+	"time"
 
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/service"
 	"nhooyr.io/websocket"
 	"nhooyr.io/websocket/wsjson"
 )
@@ -13,29 +16,87 @@ type EventType string
 const (
 	EventNewMessage EventType = "new_message"
 	EventMarkRead   EventType = "mark_read"
-	EventTyping EventType = "typing"
+	EventTyping     EventType = "typing"
+
+	// sent to the owner and everyone the file was shared with, once it's scanned
+	EventFileAvailable   EventType = "file_available"
+	EventFileQuarantined EventType = "file_quarantined"
+
+	// sent back when an event of the client is over a limit
+	EventError EventType = "error"
+
+	// sent to those sharing a chat or a contact with a user who went online
+	// or offline, as far as the user's privacy settings allow
+	EventPresence EventType = "presence"
+
+	// sent to the other devices of a user who changed the settings of a chat
+	EventChatSettings EventType = "chat_settings"
+
+	// sent to the other devices of a user who saved or cleared a draft, or
+	// sent a message that cleared it
+	EventDraftUpdated EventType = "draft_updated"
+
+	// sent to the chat members when a message is pinned or unpinned, shaped
+	// like the system message it leaves in the history
+	EventPinned   EventType = "pinned"
+	EventUnpinned EventType = "unpinned"
+)
+
+// Kinds of messages
+const (
+	MessageText  = "text"
+	MessageVoice = "voice" // file_id must be a file from POST /files/voice
 )
 
 type IncomingMessage struct {
 	Type    EventType `json:"type"`
 	ChatID  string    `json:"chat_id"`
+	Kind    string    `json:"kind,omitempty"` // text by default
 	Content string    `json:"content,omitempty"`
+	FileID  string    `json:"file_id,omitempty"`
+}
+
+type Attachment struct {
+	ID          string `json:"id"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	ScanStatus  string `json:"scan_status"`
+	DurationMs  int32  `json:"duration_ms,omitempty"`
+	Waveform    []byte `json:"waveform,omitempty"` // base64, peak amplitude per bar 0-255
 }
 
 type OutgoingMessage struct {
-	Type      EventType `json:"type"`
-	ID        string    `json:"id,omitempty"`
-	ChatID    string    `json:"chat_id"`
-	Content   string    `json:"content,omitempty"`
-	SenderID  string    `json:"sender_id,omitempty"`
-	CreatedAt string    `json:"created_at,omitempty"`
-	IsRead    bool      `json:"is_read,omitempty"`
+	Type       EventType   `json:"type"`
+	ID         string      `json:"id,omitempty"`
+	ChatID     string      `json:"chat_id"`
+	Kind       string      `json:"kind,omitempty"`
+	Content    string      `json:"content,omitempty"`
+	SenderID   string      `json:"sender_id,omitempty"`
+	CreatedAt  string      `json:"created_at,omitempty"`
+	IsRead     bool        `json:"is_read,omitempty"`
+	Attachment *Attachment `json:"attachment,omitempty"`
+
+	Error        string `json:"error,omitempty"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+
+	UserID   string `json:"user_id,omitempty"`
+	Online   *bool  `json:"online,omitempty"`
+	LastSeen string `json:"last_seen,omitempty"`
+
+	// new_message to a member who muted the chat, delivered without a notification
+	Muted    bool                          `json:"muted,omitempty"`
+	Settings *handler.ChatSettingsResponse `json:"settings,omitempty"`
+	Draft    *handler.DraftResponse        `json:"draft,omitempty"`
 }
 
 type Client struct {
 	UserID string
+	Claims service.AccessClaims // of the token the socket was opened with
 	Conn   *websocket.Conn
 	Hub    *Hub
+	Limits Limits
+	Flood  *FloodControl // shared by the user's connections
 }
 
 // ReadPump - listens for messages from client
@@ -46,6 +107,13 @@ func (c *Client) ReadPump(ctx context.Context) {
 		c.Conn.Close(websocket.StatusNormalClosure, "")
 	}()
 
+	// larger frames close the connection with StatusMessageTooBig
+	c.Conn.SetReadLimit(c.Limits.MaxFrameSize)
+	flood := c.Flood
+	if flood == nil {
+		flood = NewFloodControl(c.Limits, time.Now())
+	}
+
 	for {
 		var msg IncomingMessage
 
@@ -55,9 +123,43 @@ func (c *Client) ReadPump(ctx context.Context) {
 			break
 		}
 
+		// throttled here, so a flood never reaches the Hub and the database
+		verdict, retryAfter := flood.Admit(msg, time.Now())
+		switch verdict {
+		case Drop:
+			continue
+		case Reject:
+			c.sendError(ctx, msg, "rate limit exceeded", retryAfter)
+			continue
+		case Disconnect:
+			slog.Warn("closing flooding connection", "user_id", c.UserID)
+			c.Conn.Close(websocket.StatusPolicyViolation, "rate limit exceeded")
+			return
+		}
+
 		c.Hub.broadcast <- &HubMessage{
 			Client: c,
 			Msg:    msg,
 		} // Sending message to Hub
 	}
 }
+
+// write - sends an event to this connection, given up after 5 seconds
+func (c *Client) write(msg OutgoingMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	wsjson.Write(ctx, c.Conn, msg)
+}
+
+func (c *Client) sendError(ctx context.Context, msg IncomingMessage, reason string, retryAfter time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	wsjson.Write(ctx, c.Conn, OutgoingMessage{
+		Type:         EventError,
+		ChatID:       msg.ChatID,
+		Error:        reason,
+		RetryAfterMs: retryAfter.Milliseconds(),
+	})
+}
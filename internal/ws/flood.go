@@ -0,0 +1,186 @@
+package ws
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/service"
+)
+
+// maxTrackedChats - per-chat state beyond it is pruned of idle chats
+const maxTrackedChats = 256
+
+// Limits - what one user may send, over all of their connections
+type Limits struct {
+	MaxFrameSize   int64
+	MaxConnections int          // open at once, one per device
+	Message        service.Rate // new_message of the user
+	ChatMessage    service.Rate // new_message of the user to one chat
+	MarkRead       service.Rate
+	TypingInterval time.Duration // typing of a chat is forwarded once per interval
+	MaxViolations  int           // rejected events per minute before the connection is closed
+}
+
+var DefaultLimits = Limits{
+	MaxFrameSize:   64 << 10,
+	MaxConnections: 10,
+	Message:        service.Rate{Limit: 20, Window: 10 * time.Second},
+	ChatMessage:    service.Rate{Limit: 10, Window: 10 * time.Second},
+	MarkRead:       service.Rate{Limit: 30, Window: 10 * time.Second},
+	TypingInterval: 3 * time.Second,
+	MaxViolations:  10,
+}
+
+func NewLimits(cfg config.WebSocket) (Limits, error) {
+	limits := Limits{
+		MaxFrameSize:   cfg.MaxFrameSize,
+		MaxConnections: cfg.MaxConnections,
+		TypingInterval: cfg.TypingInterval,
+		MaxViolations:  cfg.MaxViolations,
+	}
+
+	if limits.MaxFrameSize <= 0 || limits.MaxConnections <= 0 || limits.MaxViolations <= 0 {
+		return Limits{}, fmt.Errorf("max_frame_size, max_connections and max_violations must be positive")
+	}
+
+	var err error
+	if limits.Message, err = service.ParseRate(cfg.MessageRate); err != nil {
+		return Limits{}, fmt.Errorf("message_rate: %w", err)
+	}
+	if limits.ChatMessage, err = service.ParseRate(cfg.ChatMessageRate); err != nil {
+		return Limits{}, fmt.Errorf("chat_message_rate: %w", err)
+	}
+	if limits.MarkRead, err = service.ParseRate(cfg.MarkReadRate); err != nil {
+		return Limits{}, fmt.Errorf("mark_read_rate: %w", err)
+	}
+	return limits, nil
+}
+
+type Verdict int
+
+const (
+	Allow      Verdict = iota
+	Drop               // coalesced, the client isn't told
+	Reject             // over a limit, the client gets an error frame
+	Disconnect         // too many rejects
+)
+
+// FloodControl - token buckets of one user, shared by the ReadPump
+// goroutines of all their connections
+type FloodControl struct {
+	mu           sync.Mutex
+	limits       Limits
+	messages     *bucket
+	markReads    *bucket
+	violations   *bucket
+	chatMessages map[string]*bucket
+	typing       map[string]time.Time
+}
+
+func NewFloodControl(limits Limits, now time.Time) *FloodControl {
+	return &FloodControl{
+		limits:       limits,
+		messages:     newBucket(limits.Message, now),
+		markReads:    newBucket(limits.MarkRead, now),
+		violations:   newBucket(service.Rate{Limit: limits.MaxViolations, Window: time.Minute}, now),
+		chatMessages: make(map[string]*bucket),
+		typing:       make(map[string]time.Time),
+	}
+}
+
+// Admit - what to do with the event, with Reject also when to retry
+func (f *FloodControl) Admit(msg IncomingMessage, now time.Time) (Verdict, time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var ok bool
+	var retryAfter time.Duration
+
+	switch msg.Type {
+	case EventNewMessage:
+		if ok, retryAfter = f.messages.take(now); ok {
+			if ok, retryAfter = f.chatBucket(msg.ChatID, now).take(now); !ok {
+				f.messages.refund() // the message isn't sent after all
+			}
+		}
+	case EventMarkRead:
+		ok, retryAfter = f.markReads.take(now)
+	case EventTyping:
+		if last, seen := f.typing[msg.ChatID]; seen && now.Sub(last) < f.limits.TypingInterval {
+			return Drop, 0
+		}
+		f.pruneTyping(now)
+		f.typing[msg.ChatID] = now
+		return Allow, 0
+	default:
+		return Allow, 0 // the Hub logs it
+	}
+
+	if ok {
+		return Allow, 0
+	}
+	if allowed, _ := f.violations.take(now); !allowed {
+		return Disconnect, 0
+	}
+	return Reject, retryAfter
+}
+
+func (f *FloodControl) chatBucket(chatID string, now time.Time) *bucket {
+	b, ok := f.chatMessages[chatID]
+	if ok {
+		return b
+	}
+
+	if len(f.chatMessages) >= maxTrackedChats {
+		for id, b := range f.chatMessages {
+			if now.Sub(b.last) >= b.rate.Window { // refilled anyway
+				delete(f.chatMessages, id)
+			}
+		}
+	}
+	b = newBucket(f.limits.ChatMessage, now)
+	f.chatMessages[chatID] = b
+	return b
+}
+
+func (f *FloodControl) pruneTyping(now time.Time) {
+	if len(f.typing) < maxTrackedChats {
+		return
+	}
+	for id, last := range f.typing {
+		if now.Sub(last) >= f.limits.TypingInterval {
+			delete(f.typing, id)
+		}
+	}
+}
+
+// bucket - holds up to Limit tokens, refilled at Limit per Window
+type bucket struct {
+	rate   service.Rate
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate service.Rate, now time.Time) *bucket {
+	return &bucket{rate: rate, tokens: float64(rate.Limit), last: now}
+}
+
+func (b *bucket) take(now time.Time) (bool, time.Duration) {
+	perToken := b.rate.Window / time.Duration(b.rate.Limit)
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(float64(b.rate.Limit), b.tokens+float64(elapsed)/float64(perToken))
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) * float64(perToken))
+}
+
+func (b *bucket) refund() {
+	b.tokens = min(float64(b.rate.Limit), b.tokens+1)
+}
@@ -1,29 +1,86 @@
 package ws
 
 import (
+	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 
 	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/service"
 	"nhooyr.io/websocket"
 )
 
 type WSHandler struct {
-	hub *Hub
+	hub     *Hub
+	tickets *service.TicketService
+	limits  Limits
 }
 
-func NewWSHandler(hub *Hub) *WSHandler {
-	return &WSHandler{hub: hub}
+func NewWSHandler(hub *Hub, tickets *service.TicketService) *WSHandler {
+	return &WSHandler{
+		hub:     hub,
+		tickets: tickets,
+		limits:  DefaultLimits,
+	}
 }
 
-func (h *WSHandler) HandleWS(w http.ResponseWriter, r *http.Request) {
-	// 1. Getting user from ctx
-	userID, ok := r.Context().Value(handler.UserIDKey).(string)
+// SetLimits - overrides DefaultLimits of new connections
+func (h *WSHandler) SetLimits(limits Limits) {
+	h.limits = limits
+}
+
+type TicketResponse struct {
+	Ticket    string `json:"ticket"`
+	ExpiresIn int    `json:"expires_in"` // seconds
+}
+
+// IssueTicket - POST /api/ws/ticket, the ticket opens one connection
+func (h *WSHandler) IssueTicket(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(handler.ClaimsKey).(service.AccessClaims)
 	if !ok {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		http.Error(w, "user not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	ticket, err := h.tickets.Issue(r.Context(), claims)
+	if err != nil {
+		slog.Error("failed to issue ws ticket", "error", err)
+		http.Error(w, "failed to issue ticket", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TicketResponse{
+		Ticket:    ticket,
+		ExpiresIn: int(service.TicketTTL.Seconds()),
+	})
+}
+
+// HandleWS - GET /api/ws?ticket=, not behind AuthMiddleware
+func (h *WSHandler) HandleWS(w http.ResponseWriter, r *http.Request) {
+	// 1. Getting user from the ticket
+	claims, err := h.tickets.Redeem(r.Context(), r.URL.Query().Get("ticket"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTicket) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		slog.Error("failed to redeem ws ticket", "error", err)
+		http.Error(w, "failed to check ticket", http.StatusServiceUnavailable)
+		return
+	}
+
+	// 2. One more device, the user's limits are shared with the others
+	flood, err := h.hub.acquire(claims.UserID, h.limits)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
 		return
 	}
+	defer h.hub.release(claims.UserID)
 
-	// 2. HTTP to WebSocket
+	// 3. HTTP to WebSocket
 	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
 		InsecureSkipVerify: true, // TODO: del in prod
 	})
@@ -31,17 +88,20 @@ func (h *WSHandler) HandleWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 3. Making client
+	// 4. Making client
 	client := &Client{
-		UserID: userID,
+		UserID: claims.UserID,
+		Claims: *claims,
 		Conn:   c,
 		Hub:    h.hub,
+		Limits: h.limits,
+		Flood:  flood,
 	}
 
-	// 4. Reg in hub
+	// 5. Reg in hub
 	h.hub.register <- client
 
-	// 5. Run message reading
+	// 6. Run message reading
 	client.ReadPump(r.Context()) // blocks this go while the connection is open
 
 }
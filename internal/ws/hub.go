@@ -2,28 +2,38 @@ package ws
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/Adopten123/go-messenger/internal/handler"
 	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/redis/go-redis/v9"
-	"nhooyr.io/websocket/wsjson"
+	"nhooyr.io/websocket"
 )
 
+var ErrTooManyConnections = errors.New("too many connections")
+
 type HubMessage struct {
 	Client *Client
 	Msg    IncomingMessage
 }
 
 type Hub struct {
-	// clients: map [UserID] -> Client.
-	// User has 1 connection.
+	// clients: map [UserID] -> connections of the user, one per device.
 	// sync.RWMutex - needed for reading/writing to the map from different goroutines.
-	clients map[string]*Client
+	clients map[string]map[*Client]struct{}
 	mu      sync.RWMutex
 
+	// users: map [UserID] -> limits all connections of the user share
+	users   map[string]*userLimits
+	usersMu sync.Mutex
+
 	// Channels for reg/unreg
 	register   chan *Client
 	unregister chan *Client
@@ -35,17 +45,63 @@ type Hub struct {
 	repo *pgdb.Queries
 	// Redis
 	rdb *redis.Client
+
+	presence *PresenceDebouncer
 }
 
 func NewHub(repo *pgdb.Queries, rdb *redis.Client) *Hub {
-	return &Hub{
-		clients:    make(map[string]*Client),
+	h := &Hub{
+		clients:    make(map[string]map[*Client]struct{}),
+		users:      make(map[string]*userLimits),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		broadcast:  make(chan *HubMessage),
 		repo:       repo,
 		rdb:        rdb,
 	}
+	h.presence = NewPresenceDebouncer(DefaultPresenceDebounce, h.announcePresence)
+	return h
+}
+
+// SetPresenceDebounce - overrides DefaultPresenceDebounce, before Run
+func (h *Hub) SetPresenceDebounce(delay time.Duration) {
+	h.presence = NewPresenceDebouncer(delay, h.announcePresence)
+}
+
+// userLimits - open connections of a user and their shared flood control
+type userLimits struct {
+	conns int
+	flood *FloodControl
+}
+
+// acquire - reserves a connection for the user, before the upgrade. The
+// buckets live as long as the user has a connection.
+func (h *Hub) acquire(userID string, limits Limits) (*FloodControl, error) {
+	h.usersMu.Lock()
+	defer h.usersMu.Unlock()
+
+	user, ok := h.users[userID]
+	if !ok {
+		user = &userLimits{flood: NewFloodControl(limits, time.Now())}
+		h.users[userID] = user
+	}
+	if user.conns >= limits.MaxConnections {
+		return nil, ErrTooManyConnections
+	}
+	user.conns++
+	return user.flood, nil
+}
+
+// release - gives back a connection taken with acquire
+func (h *Hub) release(userID string) {
+	h.usersMu.Lock()
+	defer h.usersMu.Unlock()
+
+	if user, ok := h.users[userID]; ok {
+		if user.conns--; user.conns <= 0 {
+			delete(h.users, userID)
+		}
+	}
 }
 
 // Run - starting Hub
@@ -54,22 +110,42 @@ func (h *Hub) Run() {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
-			h.clients[client.UserID] = client
+			conns, online := h.clients[client.UserID]
+			if !online {
+				conns = make(map[*Client]struct{})
+				h.clients[client.UserID] = conns
+			}
+			conns[client] = struct{}{}
 			h.mu.Unlock()
 
-			go func(uid string) {
-				h.rdb.Set(context.Background(), "user:"+uid+":online", "true", 0)
-			}(client.UserID)
+			// the user is online from the first device on
+			if !online {
+				go func(uid string) {
+					h.rdb.Set(context.Background(), "user:"+uid+":online", "true", 0)
+				}(client.UserID)
+				h.presence.Set(client.UserID, true)
+			}
 
 			slog.Info("client registered", "user_id", client.UserID)
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client.UserID]; ok {
+			conns := h.clients[client.UserID]
+			_, registered := conns[client]
+			delete(conns, client)
+			// and offline once the last device is gone
+			if registered && len(conns) == 0 {
 				delete(h.clients, client.UserID)
 
 				go func(uid string) {
 					h.rdb.Del(context.Background(), "user:"+uid+":online")
+
+					var userUUID pgtype.UUID
+					userUUID.Scan(uid)
+					if err := h.repo.UpdateLastSeen(context.Background(), userUUID); err != nil {
+						slog.Error("failed to update last seen", "user_id", uid, "error", err)
+					}
 				}(client.UserID)
+				h.presence.Set(client.UserID, false)
 			}
 			h.mu.Unlock()
 			slog.Info("client unregistered", "user_id", client.UserID)
@@ -119,10 +195,58 @@ func (h *Hub) handleNewMessage(hm *HubMessage) {
 		return
 	}
 
+	// a block closes a direct chat both ways, groups stay as they are
+	blocked, err := h.repo.IsDirectChatBlocked(ctx, pgdb.IsDirectChatBlockedParams{
+		ChatID: chatUUID,
+		UserID: senderUUID,
+	})
+	if err != nil {
+		slog.Error("failed to check blocks", "error", err)
+		return
+	}
+	if blocked {
+		slog.Warn("message to a blocked chat", "user_id", client.UserID, "chat_id", msg.ChatID)
+		go client.sendError(ctx, msg, "chat is blocked", 0)
+		return
+	}
+
+	var file *pgdb.File
+	if msg.FileID != "" {
+		file, err = h.getAttachment(ctx, msg.FileID, senderUUID)
+		if err != nil {
+			slog.Warn("invalid attachment", "user_id", client.UserID, "file_id", msg.FileID, "error", err)
+			return
+		}
+	}
+
+	kind := msg.Kind
+	switch kind {
+	case "":
+		kind = MessageText
+	case MessageText:
+	case MessageVoice:
+		if file == nil || !file.DurationMs.Valid {
+			slog.Warn("voice message without a voice file", "user_id", client.UserID, "file_id", msg.FileID)
+			return
+		}
+	default:
+		slog.Warn("unknown message kind", "kind", msg.Kind)
+		return
+	}
+
+	var fileUUID pgtype.UUID
+	var attachment *Attachment
+	if file != nil {
+		fileUUID = file.ID
+		attachment = newAttachment(file)
+	}
+
 	savedMsg, err := h.repo.CreateMessage(ctx, pgdb.CreateMessageParams{
 		ChatID:   chatUUID,
 		SenderID: senderUUID,
 		Content:  msg.Content,
+		FileID:   fileUUID,
+		Kind:     kind,
 	})
 	if err != nil {
 		slog.Error("failed to save message", "error", err)
@@ -130,16 +254,212 @@ func (h *Hub) handleNewMessage(hm *HubMessage) {
 	}
 
 	response := OutgoingMessage{
-		Type:      EventNewMessage,
-		ID:        savedMsg.ID.String(),
-		ChatID:    savedMsg.ChatID.String(),
-		Content:   savedMsg.Content,
-		SenderID:  savedMsg.SenderID.String(),
-		CreatedAt: savedMsg.CreatedAt.Time.Format(time.RFC3339),
-		IsRead:    false,
+		Type:       EventNewMessage,
+		ID:         savedMsg.ID.String(),
+		ChatID:     savedMsg.ChatID.String(),
+		Kind:       savedMsg.Kind,
+		Content:    savedMsg.Content,
+		SenderID:   savedMsg.SenderID.String(),
+		CreatedAt:  savedMsg.CreatedAt.Time.Format(time.RFC3339),
+		IsRead:     false,
+		Attachment: attachment,
+	}
+
+	// the message is out, its draft is gone on every device
+	cleared, err := h.repo.DeleteDraft(ctx, pgdb.DeleteDraftParams{
+		ChatID: chatUUID,
+		UserID: senderUUID,
+	})
+	if err != nil {
+		slog.Error("failed to clear draft", "error", err)
+	} else if cleared > 0 {
+		h.NotifyDraft(ctx, &pgdb.ChatDraft{ChatID: chatUUID, UserID: senderUUID}, client.Claims.SessionID)
+	}
+
+	// everyone gets the message, members who muted the chat without a notification
+	members, err := h.repo.ListChatMembersMuted(ctx, chatUUID)
+	if err != nil {
+		slog.Error("failed to get chat members", "error", err)
+		return
+	}
+
+	var loud, muted []pgtype.UUID
+	for _, m := range members {
+		if m.Muted {
+			muted = append(muted, m.UserID)
+		} else {
+			loud = append(loud, m.UserID)
+		}
+	}
+	h.sendToUsers(loud, response)
+
+	response.Muted = true
+	h.sendToUsers(muted, response)
+}
+
+// getAttachment - the sender may attach own files or files already shared with them
+func (h *Hub) getAttachment(ctx context.Context, fileID string, senderUUID pgtype.UUID) (*pgdb.File, error) {
+	var fileUUID pgtype.UUID
+	if err := fileUUID.Scan(fileID); err != nil {
+		return nil, err
+	}
+
+	canAccess, err := h.repo.CanAccessFile(ctx, pgdb.CanAccessFileParams{
+		FileID: fileUUID,
+		UserID: senderUUID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess {
+		return nil, errors.New("access denied")
+	}
+
+	file, err := h.repo.GetFileByID(ctx, fileUUID)
+	if err != nil {
+		return nil, err
+	}
+	// pending files may be sent, recipients get file_available later
+	if file.ScanStatus == service.ScanInfected || file.ScanStatus == service.ScanFailed {
+		return nil, errors.New("file is quarantined")
+	}
+	return &file, nil
+}
+
+// NotifyFileScanned - tells everyone who can see the file about its verdict
+func (h *Hub) NotifyFileScanned(ctx context.Context, file *pgdb.File) {
+	recipients, err := h.repo.ListFileRecipients(ctx, file.ID)
+	if err != nil {
+		slog.Error("failed to list file recipients", "error", err)
+		return
 	}
 
-	h.broadcastToChat(ctx, chatUUID, response)
+	eventType := EventFileAvailable
+	if file.ScanStatus != service.ScanClean {
+		eventType = EventFileQuarantined
+	}
+
+	h.sendToUsers(recipients, OutgoingMessage{
+		Type:       eventType,
+		Attachment: newAttachment(file),
+	})
+}
+
+// NotifyChatSettings - the settings of a chat are per user, so only the
+// user's own devices hear about them
+func (h *Hub) NotifyChatSettings(ctx context.Context, member *pgdb.ChatMember) {
+	settings := handler.NewChatSettingsResponse(member)
+	h.sendToUsers([]pgtype.UUID{member.UserID}, OutgoingMessage{
+		Type:     EventChatSettings,
+		ChatID:   member.ChatID.String(),
+		Settings: &settings,
+	})
+}
+
+// NotifyDraft - drafts are per user, the device of sessionID already has it
+func (h *Hub) NotifyDraft(ctx context.Context, draft *pgdb.ChatDraft, sessionID string) {
+	resp := handler.NewDraftResponse(draft)
+	h.sendToOtherDevices(draft.UserID.String(), sessionID, OutgoingMessage{
+		Type:   EventDraftUpdated,
+		ChatID: draft.ChatID.String(),
+		Draft:  &resp,
+	})
+}
+
+// NotifyPin - the system message of a pin or unpin, content is the ID of the
+// message
+func (h *Hub) NotifyPin(ctx context.Context, msg *pgdb.Message) {
+	eventType := EventPinned
+	if msg.Kind == service.MessageUnpinned {
+		eventType = EventUnpinned
+	}
+
+	h.broadcastToChat(ctx, msg.ChatID, OutgoingMessage{
+		Type:      eventType,
+		ID:        msg.ID.String(),
+		ChatID:    msg.ChatID.String(),
+		Kind:      msg.Kind,
+		Content:   msg.Content,
+		SenderID:  msg.SenderID.String(),
+		CreatedAt: msg.CreatedAt.Time.Format(time.RFC3339),
+	})
+}
+
+// announcePresence - tells the connected users who share a chat or a contact
+// with the user, those the privacy settings hide the user from learn nothing
+func (h *Hub) announcePresence(userID string, online bool) {
+	ctx := context.Background()
+
+	var userUUID pgtype.UUID
+	if err := userUUID.Scan(userID); err != nil {
+		return
+	}
+
+	user, err := h.repo.GetUserByID(ctx, userUUID)
+	if err != nil {
+		slog.Error("failed to get user for presence", "user_id", userID, "error", err)
+		return
+	}
+	watchers, err := h.repo.ListPresenceWatchers(ctx, userUUID)
+	if err != nil {
+		slog.Error("failed to list presence watchers", "user_id", userID, "error", err)
+		return
+	}
+
+	var lastSeen string
+	if !online && user.LastSeenAt.Valid {
+		lastSeen = user.LastSeenAt.Time.UTC().Format(time.RFC3339)
+	}
+
+	// recipients by whether they may see last_seen
+	var withLastSeen, withoutLastSeen []pgtype.UUID
+	for _, w := range watchers {
+		showOnline := service.Visible(user.OnlineVisibility, w.IsContact)
+		showLastSeen := lastSeen != "" && service.Visible(user.LastSeenVisibility, w.IsContact)
+
+		switch {
+		case showLastSeen:
+			withLastSeen = append(withLastSeen, w.UserID)
+		case showOnline:
+			withoutLastSeen = append(withoutLastSeen, w.UserID)
+		}
+	}
+
+	msg := OutgoingMessage{
+		Type:   EventPresence,
+		UserID: userID,
+		Online: &online,
+	}
+	h.sendToUsers(withoutLastSeen, msg)
+
+	msg.LastSeen = lastSeen
+	h.sendToUsers(withLastSeen, msg)
+}
+
+// WatchRevocations - closes sockets opened with a revoked token, blocks until revocations is closed
+func (h *Hub) WatchRevocations(revocations <-chan service.Revocation) {
+	for rev := range revocations {
+		h.mu.RLock()
+		for client := range h.clients[rev.UserID] {
+			if rev.Matches(client.Claims) {
+				slog.Info("closing revoked connection", "user_id", rev.UserID)
+				go client.Conn.Close(websocket.StatusPolicyViolation, "session revoked")
+			}
+		}
+		h.mu.RUnlock()
+	}
+}
+
+func newAttachment(file *pgdb.File) *Attachment {
+	return &Attachment{
+		ID:          file.ID.String(),
+		FileName:    file.FileName,
+		ContentType: file.ContentType,
+		Size:        file.Size,
+		ScanStatus:  file.ScanStatus,
+		DurationMs:  file.DurationMs.Int32,
+		Waveform:    file.Waveform,
+	}
 }
 
 // handleMarkRead - DB Update -> Send Notification
@@ -161,13 +481,36 @@ func (h *Hub) handleMarkRead(hm *HubMessage) {
 		return
 	}
 
+	// reading a chat takes back marking it unread, on every device
+	member, err := h.repo.ClearMarkedUnread(ctx, pgdb.ClearMarkedUnreadParams{
+		ChatID: chatUUID,
+		UserID: userUUID,
+	})
+	switch {
+	case err == nil:
+		h.NotifyChatSettings(ctx, &member)
+	case !errors.Is(err, pgx.ErrNoRows):
+		slog.Error("failed to clear marked unread", "error", err)
+	}
+
 	response := OutgoingMessage{
 		Type:     EventMarkRead,
 		ChatID:   hm.Msg.ChatID,
 		SenderID: hm.Client.UserID,
 	}
 
-	h.broadcastToChat(ctx, chatUUID, response)
+	// the messages are read either way, read_receipts_visibility only
+	// decides who is told
+	recipients, err := h.repo.ListReadReceiptRecipients(ctx, pgdb.ListReadReceiptRecipientsParams{
+		ReaderID: userUUID,
+		ChatID:   chatUUID,
+	})
+	if err != nil {
+		slog.Error("failed to list read receipt recipients", "error", err)
+		return
+	}
+
+	h.sendToUsers(recipients, response)
 }
 
 // broadcastToChat - find chat members and send message
@@ -178,20 +521,53 @@ func (h *Hub) broadcastToChat(ctx context.Context, chatUUID pgtype.UUID, msg Out
 		return
 	}
 
+	h.sendToUsers(memberIDs, msg)
+}
+
+// broadcastToChatFrom - activity of the user goes to the chat members except
+// those blocked by or blocking the user
+func (h *Hub) broadcastToChatFrom(ctx context.Context, chatUUID, userUUID pgtype.UUID, msg OutgoingMessage) {
+	memberIDs, err := h.repo.GetChatMembers(ctx, chatUUID)
+	if err != nil {
+		slog.Error("failed to get chat members", "error", err)
+		return
+	}
+
+	hidden, err := h.repo.ListBlockRelations(ctx, userUUID)
+	if err != nil {
+		slog.Error("failed to list blocks", "error", err)
+		return
+	}
+
+	if len(hidden) > 0 {
+		memberIDs = slices.DeleteFunc(memberIDs, func(id pgtype.UUID) bool {
+			return slices.Contains(hidden, id)
+		})
+	}
+	h.sendToUsers(memberIDs, msg)
+}
+
+// sendToUsers - send message to every connection of the users
+func (h *Hub) sendToUsers(userIDs []pgtype.UUID, msg OutgoingMessage) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	for _, memberUUID := range memberIDs {
-		memberID := memberUUID.String()
+	for _, userUUID := range userIDs {
+		for client := range h.clients[userUUID.String()] {
+			go client.write(msg)
+		}
+	}
+}
 
-		if client, ok := h.clients[memberID]; ok {
-			// async send
-			go func(c *Client) {
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-				defer cancel()
+// sendToOtherDevices - send message to the connections of the user opened
+// with another session than sessionID, every connection when it's empty
+func (h *Hub) sendToOtherDevices(userID, sessionID string, msg OutgoingMessage) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 
-				wsjson.Write(ctx, c.Conn, msg)
-			}(client)
+	for client := range h.clients[userID] {
+		if sessionID == "" || client.Claims.SessionID != sessionID {
+			go client.write(msg)
 		}
 	}
 }
@@ -222,5 +598,5 @@ func (h *Hub) handleTyping(hm *HubMessage) {
 		SenderID: hm.Client.UserID,
 	}
 
-	h.broadcastToChat(ctx, chatUUID, response)
+	h.broadcastToChatFrom(ctx, chatUUID, userUUID, response)
 }
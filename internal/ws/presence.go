@@ -0,0 +1,74 @@
+package ws
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultPresenceDebounce - how long a change must hold before it is announced
+const DefaultPresenceDebounce = 5 * time.Second
+
+// PresenceDebouncer - announces a user going online or offline once the
+// change held for the delay. A reconnect within the delay announces nothing.
+type PresenceDebouncer struct {
+	delay    time.Duration
+	announce func(userID string, online bool)
+
+	mu      sync.Mutex
+	pending map[string]pendingPresence
+	online  map[string]bool // announced as online
+	gen     uint64
+}
+
+type pendingPresence struct {
+	timer *time.Timer
+	gen   uint64 // tells a stale timer from the current one
+}
+
+func NewPresenceDebouncer(delay time.Duration, announce func(userID string, online bool)) *PresenceDebouncer {
+	return &PresenceDebouncer{
+		delay:    delay,
+		announce: announce,
+		pending:  make(map[string]pendingPresence),
+		online:   make(map[string]bool),
+	}
+}
+
+// Set - the user is online or offline as of now
+func (d *PresenceDebouncer) Set(userID string, online bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if p, ok := d.pending[userID]; ok {
+		p.timer.Stop()
+		delete(d.pending, userID)
+	}
+	// back to what the others already know
+	if d.online[userID] == online {
+		return
+	}
+
+	d.gen++
+	gen := d.gen
+	d.pending[userID] = pendingPresence{
+		timer: time.AfterFunc(d.delay, func() { d.fire(userID, online, gen) }),
+		gen:   gen,
+	}
+}
+
+func (d *PresenceDebouncer) fire(userID string, online bool, gen uint64) {
+	d.mu.Lock()
+	if p, ok := d.pending[userID]; !ok || p.gen != gen {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.pending, userID)
+	if online {
+		d.online[userID] = true
+	} else {
+		delete(d.online, userID)
+	}
+	d.mu.Unlock()
+
+	d.announce(userID, online)
+}
@@ -0,0 +1,47 @@
+-- +goose Up
+CREATE TABLE files
+(
+    id           UUID PRIMARY KEY      DEFAULT gen_random_uuid(),
+    owner_id     UUID         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    object_key   VARCHAR(255) NOT NULL,
+    file_name    VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size         BIGINT       NOT NULL,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+CREATE TABLE uploads
+(
+    id              UUID PRIMARY KEY      DEFAULT gen_random_uuid(),
+    user_id         UUID         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    object_key      VARCHAR(255) NOT NULL,
+    minio_upload_id TEXT         NOT NULL,
+    file_name       VARCHAR(255) NOT NULL,
+    content_type    VARCHAR(255) NOT NULL,
+    total_size      BIGINT       NOT NULL,
+    upload_offset   BIGINT       NOT NULL DEFAULT 0,
+    file_id         UUID REFERENCES files (id) ON DELETE SET NULL,
+    created_at      TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    expires_at      TIMESTAMPTZ  NOT NULL
+);
+
+CREATE TABLE upload_parts
+(
+    upload_id   UUID    NOT NULL REFERENCES uploads (id) ON DELETE CASCADE,
+    part_number INTEGER NOT NULL,
+    etag        TEXT    NOT NULL,
+    size        BIGINT  NOT NULL,
+    PRIMARY KEY (upload_id, part_number)
+);
+
+ALTER TABLE messages ADD COLUMN file_id UUID REFERENCES files (id) ON DELETE SET NULL;
+
+CREATE INDEX idx_files_owner ON files (owner_id);
+CREATE INDEX idx_uploads_expires ON uploads (expires_at) WHERE file_id IS NULL;
+CREATE INDEX idx_messages_file ON messages (file_id) WHERE file_id IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN file_id;
+DROP TABLE IF EXISTS upload_parts;
+DROP TABLE IF EXISTS uploads;
+DROP TABLE IF EXISTS files;
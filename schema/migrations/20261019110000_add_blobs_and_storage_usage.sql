@@ -0,0 +1,26 @@
+-- +goose Up
+-- Content-addressed objects, shared by every file with the same SHA-256
+CREATE TABLE blobs
+(
+    sha256     CHAR(64) PRIMARY KEY,
+    object_key VARCHAR(255) NOT NULL,
+    size       BIGINT       NOT NULL,
+    ref_count  INTEGER      NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+ALTER TABLE files ADD COLUMN sha256 CHAR(64) REFERENCES blobs (sha256);
+ALTER TABLE uploads ADD COLUMN hash_state BYTEA;
+ALTER TABLE users ADD COLUMN storage_used BIGINT NOT NULL DEFAULT 0;
+
+UPDATE users u
+SET storage_used = COALESCE((SELECT SUM(f.size) FROM files f WHERE f.owner_id = u.id), 0);
+
+CREATE INDEX idx_files_sha256 ON files (sha256);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_files_sha256;
+ALTER TABLE users DROP COLUMN storage_used;
+ALTER TABLE uploads DROP COLUMN hash_state;
+ALTER TABLE files DROP COLUMN sha256;
+DROP TABLE IF EXISTS blobs;
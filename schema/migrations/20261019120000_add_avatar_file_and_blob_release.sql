@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN avatar_file_id UUID REFERENCES files (id) ON DELETE SET NULL;
+
+-- Set when the last file referencing the blob is gone, the object is removed
+-- once the grace period has passed
+ALTER TABLE blobs ADD COLUMN released_at TIMESTAMPTZ;
+
+CREATE INDEX idx_users_avatar_file ON users (avatar_file_id) WHERE avatar_file_id IS NOT NULL;
+CREATE INDEX idx_blobs_released ON blobs (released_at) WHERE ref_count <= 0;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_blobs_released;
+DROP INDEX IF EXISTS idx_users_avatar_file;
+ALTER TABLE blobs DROP COLUMN released_at;
+ALTER TABLE users DROP COLUMN avatar_file_id;
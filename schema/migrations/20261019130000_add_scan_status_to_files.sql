@@ -0,0 +1,9 @@
+-- +goose Up
+-- pending - not scanned yet, clean - may be served, infected - quarantined
+ALTER TABLE files ADD COLUMN scan_status VARCHAR(20) NOT NULL DEFAULT 'clean';
+
+CREATE INDEX idx_files_scan_pending ON files (created_at) WHERE scan_status = 'pending';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_files_scan_pending;
+ALTER TABLE files DROP COLUMN scan_status;
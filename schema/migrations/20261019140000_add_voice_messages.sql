@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE files ADD COLUMN duration_ms INT;
+ALTER TABLE files ADD COLUMN waveform BYTEA; -- peak amplitude per bar, 0-255
+
+ALTER TABLE messages ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'text';
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN kind;
+
+ALTER TABLE files DROP COLUMN waveform;
+ALTER TABLE files DROP COLUMN duration_ms;
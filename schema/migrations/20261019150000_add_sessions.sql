@@ -0,0 +1,28 @@
+-- +goose Up
+CREATE TABLE sessions
+(
+    id           UUID PRIMARY KEY      DEFAULT gen_random_uuid(),
+    user_id      UUID         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    user_agent   VARCHAR(512) NOT NULL DEFAULT '',
+    ip_address   VARCHAR(64)  NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ  NOT NULL
+);
+
+-- Every refresh token ever issued for a session. Used ones are kept to detect reuse.
+CREATE TABLE refresh_tokens
+(
+    token_hash CHAR(64) PRIMARY KEY, -- SHA-256 hex, the token itself is never stored
+    session_id UUID        NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX idx_sessions_user ON sessions (user_id);
+CREATE INDEX idx_sessions_expires ON sessions (expires_at);
+CREATE INDEX idx_refresh_tokens_session ON refresh_tokens (session_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- A secret without enabled_at is an enrollment that wasn't confirmed yet
+CREATE TABLE user_totp
+(
+    user_id    UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret     TEXT        NOT NULL,          -- base32, as shown to the user
+    enabled_at TIMESTAMPTZ,
+    last_step  BIGINT      NOT NULL DEFAULT 0 -- newest accepted time step, codes can't be replayed
+);
+
+CREATE TABLE recovery_codes
+(
+    user_id   UUID     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL, -- SHA-256 hex of the normalized code
+    used_at   TIMESTAMPTZ,
+    PRIMARY KEY (user_id, code_hash)
+);
+
+-- Password checked, the second factor is pending
+CREATE TABLE login_challenges
+(
+    id         UUID PRIMARY KEY     DEFAULT gen_random_uuid(),
+    user_id    UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    attempts   INT         NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_login_challenges_expires ON login_challenges (expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS login_challenges;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS user_totp;
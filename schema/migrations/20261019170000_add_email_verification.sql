@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT false;
+
+-- Single-use links sent by mail. email is the address the link went to,
+-- so a verification link is worthless once the user changed it.
+CREATE TABLE email_tokens
+(
+    token_hash CHAR(64) PRIMARY KEY, -- SHA-256 hex, the token itself is never stored
+    user_id    UUID         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    purpose    VARCHAR(20)  NOT NULL, -- 'verify_email' or 'reset_password'
+    email      VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ  NOT NULL
+);
+
+CREATE INDEX idx_email_tokens_user ON email_tokens (user_id, purpose);
+CREATE INDEX idx_email_tokens_expires ON email_tokens (expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS email_tokens;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS email_verified;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Messages outlive their sender: a deleted account's messages stay in the
+-- chats with sender_id NULL, shown as a deleted account.
+ALTER TABLE messages
+    ALTER COLUMN sender_id DROP NOT NULL;
+
+-- +goose Down
+DELETE FROM messages WHERE sender_id IS NULL;
+ALTER TABLE messages
+    ALTER COLUMN sender_id SET NOT NULL;
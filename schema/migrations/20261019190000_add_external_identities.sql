@@ -0,0 +1,18 @@
+-- +goose Up
+-- Accounts at OIDC providers, (provider, subject) is the stable identifier.
+-- Users provisioned through a provider have an empty password_hash, so the
+-- password login doesn't work for them until they reset the password.
+CREATE TABLE external_identities
+(
+    provider   VARCHAR(50)  NOT NULL, -- name of the provider in the config
+    subject    VARCHAR(255) NOT NULL, -- "sub" of the ID token
+    user_id    UUID         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    email      VARCHAR(255) NOT NULL, -- as the provider reported it on linking
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX idx_external_identities_user ON external_identities (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS external_identities;
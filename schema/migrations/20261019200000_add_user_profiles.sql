@@ -0,0 +1,15 @@
+-- +goose Up
+-- Profile shown to other users. A custom status without status_expires_at
+-- stays until it is cleared.
+ALTER TABLE users
+    ADD COLUMN display_name      VARCHAR(64),
+    ADD COLUMN bio               VARCHAR(500),
+    ADD COLUMN status_text       VARCHAR(100),
+    ADD COLUMN status_expires_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN IF EXISTS status_expires_at,
+    DROP COLUMN IF EXISTS status_text,
+    DROP COLUMN IF EXISTS bio,
+    DROP COLUMN IF EXISTS display_name;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Users found by name in the directory search. Users who are not
+-- discoverable only show up for people who have them as a contact.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE users
+    ADD COLUMN discoverable BOOLEAN NOT NULL DEFAULT TRUE;
+
+CREATE INDEX idx_users_username_trgm ON users USING gin (lower(username) gin_trgm_ops);
+CREATE INDEX idx_users_display_name_trgm ON users USING gin (lower(display_name) gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_display_name_trgm;
+DROP INDEX IF EXISTS idx_users_username_trgm;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS discoverable;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- A contact request becomes two contacts rows, one per direction, once it is
+-- accepted. Users with contacts_only_dms set can only be messaged directly
+-- by their contacts.
+CREATE TABLE contact_requests
+(
+    from_user_id UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    to_user_id   UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (from_user_id, to_user_id),
+    CHECK (from_user_id <> to_user_id)
+);
+
+CREATE INDEX idx_contact_requests_to ON contact_requests (to_user_id, created_at DESC);
+
+CREATE TABLE contacts
+(
+    user_id    UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    contact_id UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, contact_id),
+    CHECK (user_id <> contact_id)
+);
+
+ALTER TABLE users
+    ADD COLUMN contacts_only_dms BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN IF EXISTS contacts_only_dms;
+
+DROP TABLE IF EXISTS contacts;
+DROP TABLE IF EXISTS contact_requests;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- A block goes one way, but hides both users from each other: no direct
+-- messages, typing or presence in either direction.
+CREATE TABLE blocks
+(
+    user_id    UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    blocked_id UUID        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, blocked_id),
+    CHECK (user_id <> blocked_id)
+);
+
+CREATE INDEX idx_blocks_blocked ON blocks (blocked_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS blocks;
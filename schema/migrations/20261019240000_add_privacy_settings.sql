@@ -0,0 +1,19 @@
+-- +goose Up
+-- Who sees that the user is online, when they were last seen and that they
+-- read a message: everyone, their contacts or nobody. last_seen_at is set
+-- when the user's last connection closes.
+ALTER TABLE users
+    ADD COLUMN online_visibility        VARCHAR(10) NOT NULL DEFAULT 'everyone'
+        CHECK (online_visibility IN ('everyone', 'contacts', 'nobody')),
+    ADD COLUMN last_seen_visibility     VARCHAR(10) NOT NULL DEFAULT 'everyone'
+        CHECK (last_seen_visibility IN ('everyone', 'contacts', 'nobody')),
+    ADD COLUMN read_receipts_visibility VARCHAR(10) NOT NULL DEFAULT 'everyone'
+        CHECK (read_receipts_visibility IN ('everyone', 'contacts', 'nobody')),
+    ADD COLUMN last_seen_at             TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN IF EXISTS last_seen_at,
+    DROP COLUMN IF EXISTS read_receipts_visibility,
+    DROP COLUMN IF EXISTS last_seen_visibility,
+    DROP COLUMN IF EXISTS online_visibility;
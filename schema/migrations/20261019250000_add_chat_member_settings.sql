@@ -0,0 +1,15 @@
+-- +goose Up
+-- Inbox settings of a member for the chat. pin_order is NULL for chats that
+-- are not pinned, lower comes first. Archived chats are never pinned.
+ALTER TABLE chat_members
+    ADD COLUMN muted_until   TIMESTAMPTZ,
+    ADD COLUMN archived      BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN pin_order     INTEGER,
+    ADD COLUMN marked_unread BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE chat_members
+    DROP COLUMN IF EXISTS marked_unread,
+    DROP COLUMN IF EXISTS pin_order,
+    DROP COLUMN IF EXISTS archived,
+    DROP COLUMN IF EXISTS muted_until;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- User-defined views of the inbox. A folder holds the chats listed in
+-- chat_folder_chats, or every chat when none are listed, narrowed down by
+-- the rules. groups_only keeps chats of more than two members.
+CREATE TABLE chat_folders
+(
+    id            UUID PRIMARY KEY      DEFAULT gen_random_uuid(),
+    user_id       UUID         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name          VARCHAR(64)  NOT NULL,
+    groups_only   BOOLEAN      NOT NULL DEFAULT FALSE,
+    unread_only   BOOLEAN      NOT NULL DEFAULT FALSE,
+    exclude_muted BOOLEAN      NOT NULL DEFAULT FALSE,
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+CREATE TABLE chat_folder_chats
+(
+    folder_id UUID NOT NULL REFERENCES chat_folders (id) ON DELETE CASCADE,
+    chat_id   UUID NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+    PRIMARY KEY (folder_id, chat_id)
+);
+
+CREATE INDEX idx_chat_folders_user ON chat_folders (user_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS chat_folder_chats;
+DROP TABLE IF EXISTS chat_folders;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- The unsent text of a member in a chat, one per member shared by all the
+-- devices of the user. Leaving the chat drops it.
+CREATE TABLE chat_drafts
+(
+    chat_id    UUID        NOT NULL,
+    user_id    UUID        NOT NULL,
+    content    TEXT        NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (chat_id, user_id),
+    FOREIGN KEY (chat_id, user_id) REFERENCES chat_members (chat_id, user_id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS chat_drafts;
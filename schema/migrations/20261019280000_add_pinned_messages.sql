@@ -0,0 +1,20 @@
+-- +goose Up
+-- Admins pin messages, other members only where members_can_pin is set.
+-- Every pin and unpin also leaves a system message in the chat.
+ALTER TABLE chats
+    ADD COLUMN members_can_pin BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE pinned_messages
+(
+    chat_id    UUID        NOT NULL REFERENCES chats (id) ON DELETE CASCADE,
+    message_id UUID        NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    pinned_by  UUID        REFERENCES users (id) ON DELETE SET NULL,
+    pinned_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (chat_id, message_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS pinned_messages;
+
+ALTER TABLE chats
+    DROP COLUMN IF EXISTS members_can_pin;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- failed scans of a pending file, after too many it's given up on as failed
+ALTER TABLE files ADD COLUMN scan_attempts INT NOT NULL DEFAULT 0;
+
+DROP INDEX IF EXISTS idx_files_scan_pending;
+CREATE INDEX idx_files_scan_pending ON files (scan_attempts, created_at) WHERE scan_status = 'pending';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_files_scan_pending;
+CREATE INDEX idx_files_scan_pending ON files (created_at) WHERE scan_status = 'pending';
+
+ALTER TABLE files DROP COLUMN scan_attempts;
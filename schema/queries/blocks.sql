@@ -0,0 +1,53 @@
+-- name: BlockUser :execrows
+INSERT INTO blocks (user_id, blocked_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: UnblockUser :execrows
+DELETE FROM blocks
+WHERE user_id = $1 AND blocked_id = $2;
+
+-- name: ListBlockedUsers :many
+SELECT
+    u.id,
+    u.username,
+    u.display_name,
+    u.avatar_url,
+    b.created_at
+FROM blocks b
+         JOIN users u ON u.id = b.blocked_id
+WHERE b.user_id = $1
+ORDER BY b.created_at DESC;
+
+-- name: IsBlockedBetween :one
+-- Whether either user blocked the other.
+SELECT EXISTS (
+    SELECT 1
+    FROM blocks
+    WHERE (user_id = sqlc.arg(user_id) AND blocked_id = sqlc.arg(other_id))
+       OR (user_id = sqlc.arg(other_id) AND blocked_id = sqlc.arg(user_id))
+);
+
+-- name: ListBlockRelations :many
+-- Users the user blocked or was blocked by.
+SELECT blocked_id AS other_id
+FROM blocks
+WHERE blocks.user_id = $1
+UNION
+SELECT blocks.user_id AS other_id
+FROM blocks
+WHERE blocked_id = $1;
+
+-- name: IsDirectChatBlocked :one
+-- Whether the chat is a direct chat, two members, and one of them blocked
+-- the other.
+SELECT EXISTS (
+    SELECT 1
+    FROM chat_members me
+             JOIN chat_members other ON other.chat_id = me.chat_id AND other.user_id <> me.user_id
+             JOIN blocks b ON (b.user_id = me.user_id AND b.blocked_id = other.user_id)
+        OR (b.user_id = other.user_id AND b.blocked_id = me.user_id)
+    WHERE me.chat_id = sqlc.arg(chat_id)
+      AND me.user_id = sqlc.arg(user_id)
+      AND (SELECT count(*) FROM chat_members cm WHERE cm.chat_id = sqlc.arg(chat_id)) = 2
+);
@@ -11,12 +11,102 @@ SELECT EXISTS (
 );
 
 -- name: ListUserChats :many
+-- The inbox or the archive of the user: pinned chats first in the user's
+-- order, then the latest activity first. With folder_id only the chats of
+-- that folder of the user.
 SELECT
     c.id,
     c.name,
     c.is_group,
-    c.created_at
+    c.created_at,
+    cm.muted_until,
+    cm.archived,
+    cm.pin_order,
+    cm.marked_unread,
+    COALESCE(last.created_at, c.created_at)::timestamptz AS last_activity_at,
+    d.content AS draft,
+    d.updated_at AS draft_updated_at
 FROM chats c
          JOIN chat_members cm ON c.id = cm.chat_id
-WHERE cm.user_id = $1
-ORDER BY c.created_at DESC;
\ No newline at end of file
+         LEFT JOIN chat_drafts d ON d.chat_id = c.id AND d.user_id = cm.user_id
+         LEFT JOIN LATERAL (
+    SELECT m.created_at
+    FROM messages m
+    WHERE m.chat_id = c.id
+    ORDER BY m.created_at DESC
+    LIMIT 1
+    ) last ON TRUE
+WHERE cm.user_id = sqlc.arg(user_id)
+  AND cm.archived = sqlc.arg(archived)
+  AND (sqlc.narg(folder_id)::uuid IS NULL OR EXISTS (
+    SELECT 1
+    FROM chat_folders f
+    WHERE f.id = sqlc.narg(folder_id)
+      AND f.user_id = cm.user_id
+      AND (NOT EXISTS (SELECT 1 FROM chat_folder_chats fc WHERE fc.folder_id = f.id)
+        OR EXISTS (SELECT 1 FROM chat_folder_chats fc WHERE fc.folder_id = f.id AND fc.chat_id = c.id))
+      -- chats named on creation are flagged is_group, count the members instead
+      AND (NOT f.groups_only OR (SELECT count(*) FROM chat_members g WHERE g.chat_id = c.id) > 2)
+      AND (NOT f.exclude_muted OR cm.muted_until IS NULL OR cm.muted_until <= now())
+      AND (NOT f.unread_only OR cm.marked_unread OR EXISTS (
+        SELECT 1
+        FROM messages m
+        WHERE m.chat_id = c.id
+          AND m.sender_id IS DISTINCT FROM cm.user_id
+          AND NOT m.is_read))
+))
+ORDER BY cm.pin_order IS NULL, cm.pin_order, last_activity_at DESC;
+
+-- name: GetChatMember :one
+SELECT *
+FROM chat_members
+WHERE chat_id = $1 AND user_id = $2;
+
+-- name: UpdateChatMemberSettings :one
+UPDATE chat_members
+SET muted_until   = $3,
+    archived      = $4,
+    pin_order     = $5,
+    marked_unread = $6
+WHERE chat_id = $1 AND user_id = $2
+    RETURNING *;
+
+-- name: LockUserChatMembers :exec
+-- Pin changes of the user wait for each other, so the pin limit holds.
+SELECT 1 FROM chat_members
+WHERE user_id = $1
+    FOR UPDATE;
+
+-- name: CountPinnedChats :one
+SELECT count(*)
+FROM chat_members
+WHERE user_id = $1 AND pin_order IS NOT NULL;
+
+-- name: NextPinOrder :one
+-- New pins go on top.
+SELECT (COALESCE(MIN(pin_order), 1) - 1)::integer AS pin_order
+FROM chat_members
+WHERE user_id = $1;
+
+-- name: UnpinUserChats :many
+UPDATE chat_members
+SET pin_order = NULL
+WHERE user_id = $1 AND pin_order IS NOT NULL
+    RETURNING *;
+
+-- name: SetPinOrder :one
+UPDATE chat_members
+SET pin_order = $3
+WHERE chat_id = $1 AND user_id = $2 AND NOT archived
+    RETURNING *;
+
+-- name: ClearMarkedUnread :one
+UPDATE chat_members
+SET marked_unread = FALSE
+WHERE chat_id = $1 AND user_id = $2 AND marked_unread
+    RETURNING *;
+
+-- name: ListChatMembersMuted :many
+SELECT user_id, (muted_until IS NOT NULL AND muted_until > now())::boolean AS muted
+FROM chat_members
+WHERE chat_id = $1;
\ No newline at end of file
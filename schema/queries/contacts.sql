@@ -0,0 +1,79 @@
+-- name: CreateContactRequest :execrows
+INSERT INTO contact_requests (from_user_id, to_user_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteContactRequest :execrows
+DELETE FROM contact_requests
+WHERE from_user_id = $1 AND to_user_id = $2;
+
+-- name: ListIncomingContactRequests :many
+SELECT
+    u.id,
+    u.username,
+    u.display_name,
+    u.avatar_url,
+    r.created_at
+FROM contact_requests r
+         JOIN users u ON u.id = r.from_user_id
+WHERE r.to_user_id = $1
+ORDER BY r.created_at DESC;
+
+-- name: ListOutgoingContactRequests :many
+SELECT
+    u.id,
+    u.username,
+    u.display_name,
+    u.avatar_url,
+    r.created_at
+FROM contact_requests r
+         JOIN users u ON u.id = r.to_user_id
+WHERE r.from_user_id = $1
+ORDER BY r.created_at DESC;
+
+-- name: AddContact :exec
+-- Both directions, contacts are mutual.
+INSERT INTO contacts (user_id, contact_id)
+VALUES (sqlc.arg(user_id), sqlc.arg(contact_id)),
+       (sqlc.arg(contact_id), sqlc.arg(user_id))
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteContact :execrows
+DELETE FROM contacts
+WHERE (user_id = sqlc.arg(user_id) AND contact_id = sqlc.arg(contact_id))
+   OR (user_id = sqlc.arg(contact_id) AND contact_id = sqlc.arg(user_id));
+
+-- name: IsContact :one
+SELECT EXISTS (
+    SELECT 1
+    FROM contacts
+    WHERE user_id = $1 AND contact_id = $2
+);
+
+-- name: ListContacts :many
+SELECT
+    u.id,
+    u.username,
+    u.display_name,
+    u.avatar_url,
+    u.online_visibility,
+    c.created_at
+FROM contacts c
+         JOIN users u ON u.id = c.contact_id
+WHERE c.user_id = $1
+ORDER BY lower(coalesce(u.display_name, u.username));
+
+-- name: AcceptsDirectChat :one
+-- Whether sender may start a direct chat with the user.
+SELECT (NOT u.contacts_only_dms OR EXISTS (
+    SELECT 1
+    FROM contacts c
+    WHERE c.user_id = u.id AND c.contact_id = sqlc.arg(sender_id)
+))::boolean AS accepts
+FROM users u
+WHERE u.id = sqlc.arg(user_id);
+
+-- name: DeleteContactRequestsBetween :exec
+DELETE FROM contact_requests
+WHERE (from_user_id = sqlc.arg(user_id) AND to_user_id = sqlc.arg(other_id))
+   OR (from_user_id = sqlc.arg(other_id) AND to_user_id = sqlc.arg(user_id));
@@ -0,0 +1,16 @@
+-- name: GetDraft :one
+SELECT *
+FROM chat_drafts
+WHERE chat_id = $1 AND user_id = $2;
+
+-- name: UpsertDraft :one
+INSERT INTO chat_drafts (chat_id, user_id, content)
+VALUES ($1, $2, $3)
+ON CONFLICT (chat_id, user_id) DO UPDATE
+    SET content    = EXCLUDED.content,
+        updated_at = now()
+    RETURNING *;
+
+-- name: DeleteDraft :execrows
+DELETE FROM chat_drafts
+WHERE chat_id = $1 AND user_id = $2;
@@ -0,0 +1,19 @@
+-- name: CreateEmailToken :exec
+INSERT INTO email_tokens (token_hash, user_id, purpose, email, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ConsumeEmailToken :one
+-- Deleting makes the token single-use even with concurrent requests.
+DELETE FROM email_tokens
+WHERE token_hash = sqlc.arg(token_hash)
+  AND purpose = sqlc.arg(purpose)
+  AND expires_at > sqlc.arg(now)
+    RETURNING *;
+
+-- name: DeleteUserEmailTokens :exec
+DELETE FROM email_tokens
+WHERE user_id = $1 AND purpose = $2;
+
+-- name: DeleteExpiredEmailTokens :execrows
+DELETE FROM email_tokens
+WHERE expires_at < $1;
@@ -0,0 +1,8 @@
+-- name: GetExternalIdentity :one
+SELECT * FROM external_identities
+WHERE provider = $1 AND subject = $2;
+
+-- name: CreateExternalIdentity :one
+INSERT INTO external_identities (provider, subject, user_id, email)
+VALUES ($1, $2, $3, $4)
+    RETURNING *;
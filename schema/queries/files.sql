@@ -0,0 +1,148 @@
+-- name: CreateFile :one
+INSERT INTO files (owner_id, object_key, file_name, content_type, size, sha256, scan_status)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+    RETURNING *;
+
+-- name: GetFileByID :one
+SELECT * FROM files
+WHERE id = $1 LIMIT 1;
+
+-- name: CanAccessFile :one
+SELECT EXISTS (
+    SELECT 1
+    FROM files f
+    WHERE f.id = sqlc.arg(file_id) AND f.owner_id = sqlc.arg(user_id)
+) OR EXISTS (
+    SELECT 1
+    FROM messages m
+             JOIN chat_members cm ON m.chat_id = cm.chat_id
+    WHERE m.file_id = sqlc.arg(file_id) AND cm.user_id = sqlc.arg(user_id)
+) AS can_access;
+
+-- name: GetBlob :one
+SELECT * FROM blobs
+WHERE sha256 = $1 LIMIT 1;
+
+-- name: LockBlob :one
+-- Until the transaction ends the GC can't delete the blob.
+SELECT * FROM blobs
+WHERE sha256 = $1
+    FOR UPDATE;
+
+-- name: AcquireBlob :one
+INSERT INTO blobs (sha256, object_key, size)
+VALUES ($1, $2, $3)
+ON CONFLICT (sha256) DO UPDATE
+    SET ref_count   = blobs.ref_count + 1,
+        released_at = NULL
+    RETURNING *;
+
+-- name: ChargeStorage :execrows
+UPDATE users
+SET storage_used = storage_used + sqlc.arg(size)
+WHERE id = sqlc.arg(id) AND storage_used + sqlc.arg(size) <= sqlc.arg(quota);
+
+-- name: GetStorageUsage :one
+SELECT
+    u.storage_used,
+    (SELECT COUNT(*) FROM files f WHERE f.owner_id = u.id) AS files_count
+FROM users u
+WHERE u.id = $1;
+
+-- name: RefundStorage :exec
+UPDATE users
+SET storage_used = GREATEST(storage_used - sqlc.arg(size), 0)
+WHERE id = sqlc.arg(id);
+
+-- name: ListOrphanFiles :many
+SELECT * FROM files f
+WHERE f.created_at < sqlc.arg(created_before)
+  AND NOT EXISTS (SELECT 1 FROM messages m WHERE m.file_id = f.id)
+  AND NOT EXISTS (SELECT 1 FROM users u WHERE u.avatar_file_id = f.id)
+ORDER BY f.created_at
+    LIMIT sqlc.arg(max_files);
+
+-- name: DeleteOrphanFile :one
+DELETE FROM files f
+WHERE f.id = $1
+  AND NOT EXISTS (SELECT 1 FROM messages m WHERE m.file_id = f.id)
+  AND NOT EXISTS (SELECT 1 FROM users u WHERE u.avatar_file_id = f.id)
+    RETURNING *;
+
+-- name: ReleaseBlob :exec
+UPDATE blobs
+SET ref_count   = ref_count - 1,
+    released_at = CASE WHEN ref_count - 1 <= 0 THEN now() END
+WHERE sha256 = $1;
+
+-- name: ListDeadBlobs :many
+SELECT * FROM blobs
+WHERE ref_count <= 0 AND released_at < sqlc.arg(released_before)
+ORDER BY released_at
+    LIMIT sqlc.arg(max_blobs);
+
+-- name: DeleteDeadBlob :execrows
+DELETE FROM blobs
+WHERE sha256 = sqlc.arg(sha256) AND ref_count <= 0 AND released_at < sqlc.arg(released_before);
+
+-- name: ListReferencedObjectKeys :many
+SELECT k::text AS object_key
+FROM unnest(sqlc.arg(keys)::text[]) AS k
+WHERE EXISTS (SELECT 1 FROM blobs b WHERE b.object_key = k)
+   OR EXISTS (SELECT 1 FROM files f WHERE f.object_key = k)
+   OR EXISTS (SELECT 1 FROM uploads up WHERE up.object_key = k)
+   OR EXISTS (SELECT 1 FROM users u WHERE u.avatar_url LIKE '%/' || k);
+
+-- name: GetScanVerdict :one
+SELECT scan_status FROM files
+WHERE sha256 = $1 AND scan_status IN ('clean', 'infected')
+LIMIT 1;
+
+-- name: ListPendingFiles :many
+SELECT * FROM files
+WHERE scan_status = 'pending'
+ORDER BY scan_attempts, created_at
+    LIMIT $1;
+
+-- name: SetFileScanStatus :one
+UPDATE files
+SET scan_status = $2
+WHERE id = $1 AND scan_status = 'pending'
+    RETURNING *;
+
+-- name: RecordScanFailure :one
+-- The file stays pending for a retry, until max_attempts make it failed.
+UPDATE files
+SET scan_attempts = scan_attempts + 1,
+    scan_status   = CASE WHEN scan_attempts + 1 >= sqlc.arg(max_attempts) THEN 'failed' ELSE scan_status END
+WHERE id = sqlc.arg(id) AND scan_status = 'pending'
+    RETURNING *;
+
+-- name: ClearAvatarFile :exec
+UPDATE users
+SET avatar_url     = NULL,
+    avatar_file_id = NULL
+WHERE avatar_file_id = $1;
+
+-- name: PublishAvatarFile :exec
+-- Avatars get their URL once the scan found them clean.
+UPDATE users
+SET avatar_url = $2
+WHERE avatar_file_id = $1;
+
+-- name: ListFileRecipients :many
+SELECT cm.user_id
+FROM messages m
+         JOIN chat_members cm ON m.chat_id = cm.chat_id
+WHERE m.file_id = sqlc.arg(file_id)
+UNION
+SELECT f.owner_id
+FROM files f
+WHERE f.id = sqlc.arg(file_id);
+
+-- name: SetFileVoice :one
+UPDATE files
+SET duration_ms = $2,
+    waveform    = $3
+WHERE id = $1
+    RETURNING *;
@@ -0,0 +1,53 @@
+-- name: CreateChatFolder :one
+INSERT INTO chat_folders (user_id, name, groups_only, unread_only, exclude_muted)
+VALUES ($1, $2, $3, $4, $5)
+    RETURNING *;
+
+-- name: GetChatFolder :one
+SELECT *
+FROM chat_folders
+WHERE id = $1 AND user_id = $2;
+
+-- name: ListChatFolders :many
+SELECT *
+FROM chat_folders
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: CountChatFolders :one
+SELECT count(*)
+FROM chat_folders
+WHERE user_id = $1;
+
+-- name: UpdateChatFolder :one
+UPDATE chat_folders
+SET name          = $3,
+    groups_only   = $4,
+    unread_only   = $5,
+    exclude_muted = $6
+WHERE id = $1 AND user_id = $2
+    RETURNING *;
+
+-- name: DeleteChatFolder :execrows
+DELETE FROM chat_folders
+WHERE id = $1 AND user_id = $2;
+
+-- name: ListUserFolderChats :many
+-- The chats listed in every folder of the user.
+SELECT fc.folder_id, fc.chat_id
+FROM chat_folder_chats fc
+         JOIN chat_folders f ON f.id = fc.folder_id
+WHERE f.user_id = $1;
+
+-- name: ClearChatFolderChats :exec
+DELETE FROM chat_folder_chats
+WHERE folder_id = $1;
+
+-- name: AddChatFolderChats :execrows
+-- Chats the user is not a member of are skipped.
+INSERT INTO chat_folder_chats (folder_id, chat_id)
+SELECT sqlc.arg(folder_id), cm.chat_id
+FROM chat_members cm
+WHERE cm.user_id = sqlc.arg(user_id)
+  AND cm.chat_id = ANY (sqlc.arg(chat_ids)::uuid[])
+ON CONFLICT DO NOTHING;
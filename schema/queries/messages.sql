@@ -8,8 +8,8 @@ INSERT INTO chat_members (chat_id, user_id, role)
 VALUES ($1, $2, $3);
 
 -- name: CreateMessage :one
-INSERT INTO messages (chat_id, sender_id, content)
-VALUES ($1, $2, $3)
+INSERT INTO messages (chat_id, sender_id, content, file_id, kind)
+VALUES ($1, $2, $3, $4, $5)
     RETURNING *;
 
 -- name: ListMessages :many
@@ -18,9 +18,18 @@ SELECT
     m.content,
     m.created_at,
     m.sender_id,
-    u.username as sender_username
+    u.username as sender_username,
+    m.kind,
+    m.file_id,
+    f.file_name,
+    f.content_type as file_content_type,
+    f.size as file_size,
+    f.scan_status as file_scan_status,
+    f.duration_ms as file_duration_ms,
+    f.waveform as file_waveform
 FROM messages m
-         JOIN users u ON m.sender_id = u.id
+         LEFT JOIN users u ON m.sender_id = u.id
+         LEFT JOIN files f ON m.file_id = f.id
 WHERE m.chat_id = $1
 ORDER BY m.created_at DESC
     LIMIT $2 OFFSET $3;
@@ -28,4 +37,4 @@ ORDER BY m.created_at DESC
 -- name: MarkMessagesAsRead :exec
 UPDATE messages
 SET is_read = TRUE
-WHERE chat_id = $1 AND sender_id != $2 AND is_read = FALSE;
\ No newline at end of file
+WHERE chat_id = $1 AND sender_id IS DISTINCT FROM $2 AND is_read = FALSE;
\ No newline at end of file
@@ -0,0 +1,51 @@
+-- name: CanPinMessages :one
+-- Admins always, other members where the chat allows it. Locks the chat,
+-- so concurrent pins can't go over the limit together.
+SELECT (cm.role = 'admin' OR c.members_can_pin)::boolean AS can_pin
+FROM chat_members cm
+         JOIN chats c ON c.id = cm.chat_id
+WHERE cm.chat_id = $1 AND cm.user_id = $2
+    FOR UPDATE OF c;
+
+-- name: GetChatMessage :one
+SELECT *
+FROM messages
+WHERE id = $1 AND chat_id = $2;
+
+-- name: PinMessage :execrows
+INSERT INTO pinned_messages (chat_id, message_id, pinned_by)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING;
+
+-- name: UnpinMessage :execrows
+DELETE FROM pinned_messages
+WHERE chat_id = $1 AND message_id = $2;
+
+-- name: CountPinnedMessages :one
+SELECT count(*)
+FROM pinned_messages
+WHERE chat_id = $1;
+
+-- name: ListPinnedMessages :many
+-- The latest pin first.
+SELECT
+    m.id,
+    m.content,
+    m.kind,
+    m.created_at,
+    m.sender_id,
+    u.username AS sender_username,
+    m.file_id,
+    p.pinned_by,
+    p.pinned_at
+FROM pinned_messages p
+         JOIN messages m ON m.id = p.message_id
+         LEFT JOIN users u ON u.id = m.sender_id
+WHERE p.chat_id = $1
+ORDER BY p.pinned_at DESC;
+
+-- name: UpdateChatPinPermission :one
+UPDATE chats
+SET members_can_pin = $2
+WHERE id = $1
+    RETURNING *;
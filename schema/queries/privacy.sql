@@ -0,0 +1,74 @@
+-- name: UpdatePrivacySettings :exec
+UPDATE users
+SET online_visibility        = $2,
+    last_seen_visibility     = $3,
+    read_receipts_visibility = $4,
+    updated_at               = now()
+WHERE id = $1;
+
+-- name: UpdateLastSeen :exec
+UPDATE users
+SET last_seen_at = now()
+WHERE id = $1;
+
+-- name: GetPresence :one
+-- Privacy settings of the user and how the viewer relates to them.
+SELECT
+    u.online_visibility,
+    u.last_seen_visibility,
+    u.last_seen_at,
+    EXISTS (
+        SELECT 1
+        FROM contacts c
+        WHERE c.user_id = u.id AND c.contact_id = sqlc.arg(viewer_id)
+    ) AS is_contact,
+    EXISTS (
+        SELECT 1
+        FROM blocks b
+        WHERE (b.user_id = u.id AND b.blocked_id = sqlc.arg(viewer_id))
+           OR (b.user_id = sqlc.arg(viewer_id) AND b.blocked_id = u.id)
+    ) AS is_blocked
+FROM users u
+WHERE u.id = sqlc.arg(user_id);
+
+-- name: ListReadReceiptRecipients :many
+-- Members of the chat who may learn that the reader read it: the reader,
+-- and the others read_receipts_visibility allows, never across a block.
+SELECT cm.user_id
+FROM chat_members cm
+         JOIN users reader ON reader.id = sqlc.arg(reader_id)
+WHERE cm.chat_id = sqlc.arg(chat_id)
+  AND (cm.user_id = reader.id OR (
+    NOT EXISTS (
+        SELECT 1
+        FROM blocks b
+        WHERE (b.user_id = reader.id AND b.blocked_id = cm.user_id)
+           OR (b.user_id = cm.user_id AND b.blocked_id = reader.id)
+    )
+    AND (reader.read_receipts_visibility = 'everyone'
+        OR (reader.read_receipts_visibility = 'contacts' AND EXISTS (
+            SELECT 1
+            FROM contacts c
+            WHERE c.user_id = reader.id AND c.contact_id = cm.user_id
+        )))
+    ));
+
+-- name: ListPresenceWatchers :many
+-- Users who share a chat or a contact with the user, except those blocked
+-- either way, and whether they are contacts of the user.
+SELECT w.user_id, bool_or(w.is_contact)::boolean AS is_contact
+FROM (SELECT other.user_id, FALSE AS is_contact
+      FROM chat_members mine
+               JOIN chat_members other ON other.chat_id = mine.chat_id AND other.user_id <> mine.user_id
+      WHERE mine.user_id = $1
+      UNION ALL
+      SELECT c.contact_id, TRUE
+      FROM contacts c
+      WHERE c.user_id = $1) w
+WHERE NOT EXISTS (
+    SELECT 1
+    FROM blocks b
+    WHERE (b.user_id = $1 AND b.blocked_id = w.user_id)
+       OR (b.user_id = w.user_id AND b.blocked_id = $1)
+)
+GROUP BY w.user_id;
@@ -0,0 +1,65 @@
+-- name: CreateSession :one
+-- The session and its first refresh token in a single statement, so a
+-- failure never leaves a session nobody can refresh.
+WITH session AS (
+    INSERT INTO sessions (user_id, user_agent, ip_address, expires_at)
+    VALUES (sqlc.arg(user_id), sqlc.arg(user_agent), sqlc.arg(ip_address), sqlc.arg(expires_at))
+        RETURNING *
+), token AS (
+    INSERT INTO refresh_tokens (token_hash, session_id)
+    SELECT sqlc.arg(token_hash), id FROM session
+)
+SELECT * FROM session;
+
+-- name: RotateRefreshToken :one
+-- Marks the old token used and issues the new one in a single statement,
+-- so two concurrent refreshes with the same token can't both succeed.
+WITH used AS (
+    UPDATE refresh_tokens rt
+    SET used_at = now()
+    FROM sessions s
+    WHERE rt.token_hash = sqlc.arg(old_hash)
+      AND rt.used_at IS NULL
+      AND s.id = rt.session_id
+      AND s.expires_at > now()
+        RETURNING rt.session_id
+), touched AS (
+    UPDATE sessions
+    SET last_used_at = now(),
+        expires_at   = sqlc.arg(expires_at)
+    WHERE id = (SELECT session_id FROM used)
+)
+INSERT INTO refresh_tokens (token_hash, session_id)
+SELECT sqlc.arg(new_hash), session_id FROM used
+    RETURNING session_id;
+
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens
+WHERE token_hash = $1 LIMIT 1;
+
+-- name: GetSession :one
+SELECT * FROM sessions
+WHERE id = $1 LIMIT 1;
+
+-- name: ListUserSessions :many
+SELECT * FROM sessions
+WHERE user_id = $1 AND expires_at > now()
+ORDER BY last_used_at DESC;
+
+-- name: DeleteSession :one
+DELETE FROM sessions
+WHERE id = $1
+    RETURNING *;
+
+-- name: DeleteUserSession :execrows
+DELETE FROM sessions
+WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteOtherSessions :many
+DELETE FROM sessions
+WHERE user_id = sqlc.arg(user_id) AND id IS DISTINCT FROM sqlc.arg(keep_id)
+    RETURNING id;
+
+-- name: DeleteExpiredSessions :execrows
+DELETE FROM sessions
+WHERE expires_at < now();
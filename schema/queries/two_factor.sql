@@ -0,0 +1,68 @@
+-- name: SetTOTPSecret :execrows
+-- Starts over an unconfirmed enrollment, an enabled one is left alone.
+INSERT INTO user_totp (user_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+    SET secret    = EXCLUDED.secret,
+        last_step = 0
+    WHERE user_totp.enabled_at IS NULL;
+
+-- name: GetTOTP :one
+SELECT * FROM user_totp
+WHERE user_id = $1 LIMIT 1;
+
+-- name: EnableTOTP :execrows
+UPDATE user_totp
+SET enabled_at = $2,
+    last_step  = $3
+WHERE user_id = $1 AND enabled_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+UPDATE user_totp
+SET last_step = $2
+WHERE user_id = $1 AND last_step < $2;
+
+-- name: DeleteTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: ReplaceRecoveryCodes :exec
+WITH deleted AS (
+    DELETE FROM recovery_codes
+    WHERE user_id = sqlc.arg(user_id)
+)
+INSERT INTO recovery_codes (user_id, code_hash)
+SELECT sqlc.arg(user_id), unnest(sqlc.arg(code_hashes)::text[]);
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = now()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CountUnusedRecoveryCodes :one
+SELECT count(*) FROM recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: CreateLoginChallenge :one
+INSERT INTO login_challenges (user_id, expires_at)
+VALUES ($1, $2)
+    RETURNING *;
+
+-- name: AttemptLoginChallenge :one
+-- Counts the attempt, nothing is returned once they are used up.
+UPDATE login_challenges
+SET attempts = attempts + 1
+WHERE id = sqlc.arg(id) AND attempts < sqlc.arg(max_attempts)
+    RETURNING *;
+
+-- name: DeleteLoginChallenge :exec
+DELETE FROM login_challenges
+WHERE id = $1;
+
+-- name: DeleteExpiredLoginChallenges :execrows
+DELETE FROM login_challenges
+WHERE expires_at < $1;
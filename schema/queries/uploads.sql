@@ -0,0 +1,45 @@
+-- name: CreateUpload :one
+INSERT INTO uploads (user_id, object_key, minio_upload_id, file_name, content_type, total_size, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+    RETURNING *;
+
+-- name: GetUpload :one
+SELECT * FROM uploads
+WHERE id = $1 AND user_id = $2 LIMIT 1;
+
+-- name: AddUploadPart :exec
+INSERT INTO upload_parts (upload_id, part_number, etag, size)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (upload_id, part_number) DO UPDATE
+    SET etag = EXCLUDED.etag,
+        size = EXCLUDED.size;
+
+-- name: ListUploadParts :many
+SELECT * FROM upload_parts
+WHERE upload_id = $1
+ORDER BY part_number;
+
+-- name: AdvanceUploadOffset :execrows
+UPDATE uploads
+SET upload_offset = sqlc.arg(new_offset),
+    hash_state    = sqlc.arg(hash_state)
+WHERE id = sqlc.arg(id) AND upload_offset = sqlc.arg(expected_offset);
+
+-- name: CompleteUpload :exec
+UPDATE uploads
+SET file_id = $2
+WHERE id = $1;
+
+-- name: DeleteUpload :exec
+DELETE FROM uploads
+WHERE id = $1;
+
+-- name: ListExpiredUploads :many
+SELECT * FROM uploads
+WHERE file_id IS NULL AND expires_at < now()
+ORDER BY expires_at
+    LIMIT $1;
+
+-- name: DeleteCompletedUploads :execrows
+DELETE FROM uploads
+WHERE file_id IS NOT NULL AND created_at < $1;
@@ -12,6 +12,83 @@ SELECT * FROM users
 WHERE id = $1 LIMIT 1;
 
 -- name: UpdateUserAvatar :exec
+-- The URL waits until the file is clean, the scanner publishes it then.
 UPDATE users
-SET avatar_url = $2
-WHERE id = $1;
\ No newline at end of file
+SET avatar_url     = CASE WHEN (SELECT scan_status FROM files WHERE id = $3) = 'clean' THEN $2 END,
+    avatar_file_id = $3
+WHERE id = $1;
+
+-- name: SetEmailVerified :execrows
+-- Only while the user still has the address the link was sent to.
+UPDATE users
+SET email_verified = true
+WHERE id = $1 AND email = $2;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET password_hash = $2,
+    updated_at    = now()
+WHERE id = $1;
+
+-- name: UpdateUserEmail :exec
+-- The new address was just confirmed through the emailed link.
+UPDATE users
+SET email          = $2,
+    email_verified = true,
+    updated_at     = now()
+WHERE id = $1;
+
+-- name: DeleteUser :one
+-- Files of the user go with it, so the blobs they shared are released in the
+-- same statement. Their messages stay, with sender_id set to NULL.
+WITH released AS (
+    UPDATE blobs b
+    SET ref_count   = b.ref_count - f.files,
+        released_at = CASE WHEN b.ref_count - f.files <= 0 THEN now() END
+    FROM (SELECT sha256, count(*) AS files
+          FROM files
+          WHERE owner_id = $1 AND sha256 IS NOT NULL
+          GROUP BY sha256) f
+    WHERE b.sha256 = f.sha256
+)
+DELETE FROM users
+WHERE id = $1
+    RETURNING *;
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET display_name      = $2,
+    bio               = $3,
+    status_text       = $4,
+    status_expires_at = $5,
+    discoverable      = $6,
+    contacts_only_dms = $7,
+    updated_at        = now()
+WHERE id = $1
+    RETURNING *;
+
+-- name: SearchUsers :many
+-- Prefix matches rank above fuzzy ones, contacts of the searcher above
+-- everyone else. Users who are not discoverable are only found by their
+-- contacts.
+SELECT
+    u.id,
+    u.username,
+    u.display_name,
+    u.avatar_url,
+    (c.contact_id IS NOT NULL)::boolean AS is_contact
+FROM users u
+         LEFT JOIN contacts c ON c.user_id = sqlc.arg(searcher_id) AND c.contact_id = u.id
+WHERE u.id <> sqlc.arg(searcher_id)
+  AND (u.discoverable OR c.contact_id IS NOT NULL)
+  AND (lower(u.username) LIKE sqlc.arg(prefix)::text
+    OR lower(u.display_name) LIKE sqlc.arg(prefix)::text
+    OR lower(u.username) % sqlc.arg(query)::text
+    OR lower(u.display_name) % sqlc.arg(query)::text)
+ORDER BY is_contact DESC,
+         (lower(u.username) LIKE sqlc.arg(prefix)::text
+             OR coalesce(lower(u.display_name), '') LIKE sqlc.arg(prefix)::text) DESC,
+         GREATEST(similarity(lower(u.username), sqlc.arg(query)::text),
+                  similarity(coalesce(lower(u.display_name), ''), sqlc.arg(query)::text)) DESC,
+         u.username
+    LIMIT sqlc.arg(page_limit) OFFSET sqlc.arg(page_offset);
\ No newline at end of file
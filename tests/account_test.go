@@ -0,0 +1,305 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var linkToken = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer, err := service.NewFileMailer(config.Mail{From: "Messenger <no-reply@localhost>", OutboxDir: dir})
+	require.NoError(t, err)
+
+	err = mailer.Send(context.Background(), service.Email{
+		To:      "dev@example.com",
+		Subject: "Привет",
+		Body:    "line one\nline two",
+	})
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "To: <dev@example.com>\r\n")
+	assert.Contains(t, string(data), "Subject: =?utf-8?q?")
+	assert.Contains(t, string(data), "line one")
+
+	err = mailer.Send(context.Background(), service.Email{To: "not an address"})
+	assert.Error(t, err)
+}
+
+func TestEmailVerificationAndPasswordReset(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	repo := pgdb.New(pool)
+
+	now := time.Now()
+	outbox := service.NewMemoryOutbox()
+	userService := service.NewUserService(repo, secret_token)
+	userService.SetMailer(outbox, "http://messenger.test")
+	userService.SetClock(func() time.Time { return now })
+	userHandler := handler.NewUserHandler(userService, nil, nil)
+
+	r := chi.NewRouter()
+	r.Post("/users/register", userHandler.Register)
+	r.Post("/users/login", userHandler.Login)
+	r.Post("/auth/refresh", userHandler.Refresh)
+	r.Post("/users/verify-email", userHandler.VerifyEmail)
+	r.Post("/users/password/forgot", userHandler.ForgotPassword)
+	r.Post("/users/password/reset", userHandler.ResetPassword)
+	r.Group(func(r chi.Router) {
+		r.Use(userHandler.AuthMiddleware)
+		r.Get("/users/me", userHandler.GetMe)
+		r.Post("/users/me/verify-email", userHandler.ResendVerification)
+	})
+
+	post := func(path string, body any, token string) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(data))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tokenFrom := func(t *testing.T, to string) string {
+		email, ok := outbox.Last(to)
+		require.True(t, ok, "no email to %s", to)
+
+		m := linkToken.FindStringSubmatch(email.Body)
+		require.Len(t, m, 2)
+		return m[1]
+	}
+
+	isVerified := func(t *testing.T, accessToken string) bool {
+		req := httptest.NewRequest("GET", "/users/me", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp["email_verified"].(bool)
+	}
+
+	t.Run("Invalid Email Rejected", func(t *testing.T) {
+		w := post("/users/register", map[string]string{
+			"username": "Nobody", "email": "not-an-email", "password": "password123",
+		}, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	accessToken := RegisterAndLogin(t, userHandler, "Verifier", "verifier@example.com")
+
+	t.Run("Verification", func(t *testing.T) {
+		assert.False(t, isVerified(t, accessToken))
+
+		first := tokenFrom(t, "verifier@example.com")
+		assert.Equal(t, 1, outbox.Count("verifier@example.com"))
+
+		w := post("/users/me/verify-email", nil, accessToken)
+		require.Equal(t, http.StatusAccepted, w.Code)
+		second := tokenFrom(t, "verifier@example.com")
+		assert.NotEqual(t, first, second)
+
+		w = post("/users/verify-email", map[string]string{"token": first}, "")
+		require.Equal(t, http.StatusNoContent, w.Code)
+		assert.True(t, isVerified(t, accessToken))
+
+		// single use
+		w = post("/users/verify-email", map[string]string{"token": first}, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = post("/users/me/verify-email", nil, accessToken)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Unknown Email Looks The Same", func(t *testing.T) {
+		w := post("/users/password/forgot", map[string]string{"email": "ghost@example.com"}, "")
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.Equal(t, 0, outbox.Count("ghost@example.com"))
+	})
+
+	t.Run("Reset Link Expires", func(t *testing.T) {
+		w := post("/users/password/forgot", map[string]string{"email": "verifier@example.com"}, "")
+		require.Equal(t, http.StatusAccepted, w.Code)
+		token := tokenFrom(t, "verifier@example.com")
+
+		now = now.Add(2 * time.Hour)
+		w = post("/users/password/reset", map[string]string{"token": token, "password": "new-password"}, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Reset Revokes Sessions", func(t *testing.T) {
+		w := post("/users/login", map[string]string{"email": "verifier@example.com", "password": "password123"}, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var session handler.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+
+		w = post("/users/password/forgot", map[string]string{"email": "verifier@example.com"}, "")
+		require.Equal(t, http.StatusAccepted, w.Code)
+		token := tokenFrom(t, "verifier@example.com")
+
+		w = post("/users/password/reset", map[string]string{"token": token, "password": "new-password"}, "")
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		w = post("/users/password/reset", map[string]string{"token": token, "password": "another-one"}, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = post("/auth/refresh", map[string]string{"refresh_token": session.RefreshToken}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = post("/users/login", map[string]string{"email": "verifier@example.com", "password": "password123"}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = post("/users/login", map[string]string{"email": "verifier@example.com", "password": "new-password"}, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestAccountChanges(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	repo := pgdb.New(pool)
+
+	outbox := service.NewMemoryOutbox()
+	userService := service.NewUserService(repo, secret_token)
+	userService.SetMailer(outbox, "http://messenger.test")
+	userHandler := handler.NewUserHandler(userService, nil, nil)
+
+	r := chi.NewRouter()
+	r.Post("/users/login", userHandler.Login)
+	r.Post("/auth/refresh", userHandler.Refresh)
+	r.Post("/users/email/confirm", userHandler.ConfirmEmailChange)
+	r.Group(func(r chi.Router) {
+		r.Use(userHandler.AuthMiddleware)
+		r.Get("/users/me", userHandler.GetMe)
+		r.Delete("/users/me", userHandler.DeleteMe)
+		r.Put("/users/me/password", userHandler.ChangePassword)
+		r.Post("/users/me/email", userHandler.ChangeEmail)
+	})
+
+	send := func(method, path string, body any, token string) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(data))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	login := func(t *testing.T, email, password string) handler.LoginResponse {
+		w := send("POST", "/users/login", map[string]string{"email": email, "password": password}, "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var session handler.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+		return session
+	}
+
+	RegisterAndLogin(t, userHandler, "Taken", "taken@example.com")
+	RegisterAndLogin(t, userHandler, "Mover", "mover@example.com")
+	current := login(t, "mover@example.com", "password123")
+	other := login(t, "mover@example.com", "password123")
+
+	t.Run("Change Password", func(t *testing.T) {
+		w := send("PUT", "/users/me/password", map[string]string{
+			"current_password": "wrong", "new_password": "new-password",
+		}, current.Token)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = send("PUT", "/users/me/password", map[string]string{
+			"current_password": "password123", "new_password": "new-password",
+		}, current.Token)
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		// the other session ended, this one didn't
+		w = send("POST", "/auth/refresh", map[string]string{"refresh_token": other.RefreshToken}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = send("POST", "/auth/refresh", map[string]string{"refresh_token": current.RefreshToken}, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &current))
+
+		login(t, "mover@example.com", "new-password")
+	})
+
+	t.Run("Change Email", func(t *testing.T) {
+		w := send("POST", "/users/me/email", map[string]string{
+			"email": "taken@example.com", "password": "new-password",
+		}, current.Token)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = send("POST", "/users/me/email", map[string]string{
+			"email": "moved@example.com", "password": "password123",
+		}, current.Token)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = send("POST", "/users/me/email", map[string]string{
+			"email": "moved@example.com", "password": "new-password",
+		}, current.Token)
+		require.Equal(t, http.StatusAccepted, w.Code)
+
+		notice, ok := outbox.Last("mover@example.com")
+		require.True(t, ok)
+		assert.Contains(t, notice.Body, "moved@example.com")
+
+		email, ok := outbox.Last("moved@example.com")
+		require.True(t, ok)
+		m := linkToken.FindStringSubmatch(email.Body)
+		require.Len(t, m, 2)
+
+		// nothing changes until the link is opened
+		login(t, "mover@example.com", "new-password")
+
+		w = send("POST", "/users/email/confirm", map[string]string{"token": m[1]}, "")
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		w = send("GET", "/users/me", nil, current.Token)
+		require.Equal(t, http.StatusOK, w.Code)
+		var me map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &me))
+		assert.Equal(t, "moved@example.com", me["email"])
+		assert.Equal(t, true, me["email_verified"])
+
+		w = send("POST", "/users/email/confirm", map[string]string{"token": m[1]}, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Delete Account", func(t *testing.T) {
+		w := send("DELETE", "/users/me", map[string]string{"password": "wrong"}, current.Token)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = send("DELETE", "/users/me", map[string]string{"password": "new-password"}, current.Token)
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		w = send("POST", "/users/login", map[string]string{"email": "moved@example.com", "password": "new-password"}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		w = send("POST", "/auth/refresh", map[string]string{"refresh_token": current.RefreshToken}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
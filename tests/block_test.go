@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocking(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	rdb := SetupTestRedis(t)
+	defer rdb.Close()
+	repo := pgdb.New(pool)
+
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, rdb, nil)
+	chatHandler := handler.NewChatHandler(service.NewChatService(repo, pool), userService)
+	contactHandler := handler.NewContactHandler(service.NewContactService(repo, pool), rdb)
+
+	r := chi.NewRouter()
+	r.Use(userHandler.AuthMiddleware)
+	r.Get("/users/me", userHandler.GetMe)
+	r.Get("/users/{user_id}/status", userHandler.GetOnlineStatus)
+	r.Post("/chats", chatHandler.CreateChat)
+	r.Get("/contacts", contactHandler.ListContacts)
+	r.Post("/contacts/requests", contactHandler.SendRequest)
+	r.Get("/blocks", contactHandler.ListBlocked)
+	r.Post("/blocks", contactHandler.Block)
+	r.Delete("/blocks/{user_id}", contactHandler.Unblock)
+
+	do := func(token, method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	meID := func(token string) string {
+		var me map[string]any
+		json.Unmarshal(do(token, "GET", "/users/me", nil).Body.Bytes(), &me)
+		return me["id"].(string)
+	}
+
+	online := func(t *testing.T, token, userID string) bool {
+		w := do(token, "GET", "/users/"+userID+"/status", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]bool
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp["online"]
+	}
+
+	alice := RegisterAndLogin(t, userHandler, "Alice", "alice@example.com")
+	bob := RegisterAndLogin(t, userHandler, "Bob", "bob@example.com")
+	aliceID, bobID := meID(alice), meID(bob)
+
+	// contacts to begin with, both online
+	require.Equal(t, http.StatusCreated, do(alice, "POST", "/contacts/requests", map[string]string{"user_id": bobID}).Code)
+	require.Equal(t, http.StatusOK, do(bob, "POST", "/contacts/requests", map[string]string{"user_id": aliceID}).Code)
+	rdb.Set(t.Context(), "user:"+aliceID+":online", "true", 0)
+	rdb.Set(t.Context(), "user:"+bobID+":online", "true", 0)
+	require.True(t, online(t, alice, bobID))
+
+	t.Run("Block", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, do(alice, "POST", "/blocks", map[string]string{"user_id": bobID}).Code)
+		// twice is fine
+		assert.Equal(t, http.StatusNoContent, do(alice, "POST", "/blocks", map[string]string{"user_id": bobID}).Code)
+
+		var blocked []handler.ContactResponse
+		require.NoError(t, json.Unmarshal(do(alice, "GET", "/blocks", nil).Body.Bytes(), &blocked))
+		require.Len(t, blocked, 1)
+		assert.Equal(t, "Bob", blocked[0].Username)
+		assert.Empty(t, decodeContacts(t, do(bob, "GET", "/contacts", nil)))
+	})
+
+	t.Run("Hidden Both Ways", func(t *testing.T) {
+		assert.False(t, online(t, bob, aliceID))
+		assert.False(t, online(t, alice, bobID))
+
+		assert.Equal(t, http.StatusForbidden, do(bob, "POST", "/chats", map[string]any{"user_ids": []string{aliceID}}).Code)
+		assert.Equal(t, http.StatusForbidden, do(alice, "POST", "/chats", map[string]any{"partner_email": "bob@example.com"}).Code)
+		assert.Equal(t, http.StatusForbidden, do(bob, "POST", "/contacts/requests", map[string]string{"user_id": aliceID}).Code)
+	})
+
+	t.Run("Unblock", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, do(bob, "DELETE", "/blocks/"+aliceID, nil).Code)
+		assert.Equal(t, http.StatusNoContent, do(alice, "DELETE", "/blocks/"+bobID, nil).Code)
+
+		assert.True(t, online(t, bob, aliceID))
+		assert.Equal(t, http.StatusCreated, do(bob, "POST", "/chats", map[string]any{"user_ids": []string{aliceID}}).Code)
+		// the contact is gone for good
+		assert.Empty(t, decodeContacts(t, do(alice, "GET", "/contacts", nil)))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do(alice, "POST", "/blocks", map[string]string{"user_id": aliceID}).Code)
+		assert.Equal(t, http.StatusNotFound, do(alice, "POST", "/blocks", map[string]string{"user_id": "00000000-0000-0000-0000-000000000000"}).Code)
+	})
+}
+
+func decodeContacts(t *testing.T, w *httptest.ResponseRecorder) []handler.ContactResponse {
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp []handler.ContactResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
@@ -0,0 +1,223 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatSettings(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	rdb := SetupTestRedis(t)
+	defer rdb.Close()
+	repo := pgdb.New(pool)
+
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, rdb, nil)
+	chatService := service.NewChatService(repo, pool)
+	chatHandler := handler.NewChatHandler(chatService, userService)
+
+	var mu sync.Mutex
+	var synced []pgdb.ChatMember
+	chatService.OnSettingsChanged(func(ctx context.Context, member *pgdb.ChatMember) {
+		mu.Lock()
+		defer mu.Unlock()
+		synced = append(synced, *member)
+	})
+
+	r := chi.NewRouter()
+	r.Use(userHandler.AuthMiddleware)
+	r.Get("/chats", chatHandler.ListChats)
+	r.Post("/chats", chatHandler.CreateChat)
+	r.Put("/chats/pinned", chatHandler.ReorderPinned)
+	r.Get("/chats/{chat_id}/settings", chatHandler.GetSettings)
+	r.Patch("/chats/{chat_id}/settings", chatHandler.UpdateSettings)
+
+	do := func(token, method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tokenA := RegisterAndLogin(t, userHandler, "alice", "alice@test.com")
+	tokenB := RegisterAndLogin(t, userHandler, "bob", "bob@test.com")
+
+	newChat := func(name string) string {
+		w := do(tokenA, "POST", "/chats", map[string]any{"name": name, "partner_email": "bob@test.com"})
+		require.Equal(t, http.StatusCreated, w.Code)
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp["chat_id"]
+	}
+	first := newChat("first")
+	second := newChat("second")
+	third := newChat("third")
+
+	list := func(t *testing.T, token, query string) []string {
+		w := do(token, "GET", "/chats"+query, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp []handler.ChatListItem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		ids := make([]string, 0, len(resp))
+		for _, c := range resp {
+			ids = append(ids, c.ID)
+		}
+		return ids
+	}
+
+	patch := func(t *testing.T, chatID string, body any) handler.ChatSettingsResponse {
+		w := do(tokenA, "PATCH", "/chats/"+chatID+"/settings", body)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp handler.ChatSettingsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	t.Run("Latest activity first", func(t *testing.T) {
+		assert.Equal(t, []string{third, second, first}, list(t, tokenA, ""))
+	})
+
+	t.Run("Pinned chats come first", func(t *testing.T) {
+		settings := patch(t, first, map[string]any{"pinned": true})
+		assert.True(t, settings.Pinned)
+		patch(t, second, map[string]any{"pinned": true})
+
+		// the latest pin goes on top
+		assert.Equal(t, []string{second, first, third}, list(t, tokenA, ""))
+		// settings are per member
+		assert.Equal(t, []string{third, second, first}, list(t, tokenB, ""))
+	})
+
+	t.Run("Reorder pinned", func(t *testing.T) {
+		synced = nil
+		w := do(tokenA, "PUT", "/chats/pinned", map[string]any{"chat_ids": []string{first, third}})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, []string{first, third, second}, list(t, tokenA, ""))
+
+		// the chat that lost its pin is synced too
+		pinned := make(map[string]bool)
+		for _, member := range synced {
+			pinned[member.ChatID.String()] = member.PinOrder.Valid
+		}
+		assert.Equal(t, map[string]bool{first: true, third: true, second: false}, pinned)
+
+		w = do(tokenA, "PUT", "/chats/pinned", map[string]any{"chat_ids": []string{"00000000-0000-0000-0000-000000000000"}})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		// nothing changed
+		assert.Equal(t, []string{first, third, second}, list(t, tokenA, ""))
+	})
+
+	t.Run("Archive", func(t *testing.T) {
+		settings := patch(t, first, map[string]any{"archived": true})
+		assert.True(t, settings.Archived)
+		assert.False(t, settings.Pinned, "archiving unpins")
+
+		assert.Equal(t, []string{third, second}, list(t, tokenA, ""))
+		assert.Equal(t, []string{first}, list(t, tokenA, "?archived=true"))
+
+		w := do(tokenA, "PATCH", "/chats/"+first+"/settings", map[string]any{"pinned": true})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		patch(t, first, map[string]any{"archived": false})
+		assert.Empty(t, list(t, tokenA, "?archived=true"))
+	})
+
+	t.Run("Mute", func(t *testing.T) {
+		until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		settings := patch(t, second, map[string]any{"muted_until": until})
+		assert.True(t, settings.Muted)
+		require.NotNil(t, settings.MutedUntil)
+		assert.True(t, until.Equal(*settings.MutedUntil))
+
+		// absent fields stay as they are
+		settings = patch(t, second, map[string]any{"marked_unread": true})
+		assert.True(t, settings.Muted)
+		assert.True(t, settings.MarkedUnread)
+
+		w := do(tokenA, "PATCH", "/chats/"+second+"/settings", map[string]any{"muted_until": time.Now().Add(-time.Hour)})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		settings = patch(t, second, map[string]any{"muted_until": nil})
+		assert.False(t, settings.Muted)
+		assert.Nil(t, settings.MutedUntil)
+
+		w = do(tokenA, "GET", "/chats/"+second+"/settings", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &settings))
+		assert.False(t, settings.Muted)
+		assert.True(t, settings.MarkedUnread)
+	})
+
+	t.Run("Not a member", func(t *testing.T) {
+		tokenC := RegisterAndLogin(t, userHandler, "carol", "carol@test.com")
+		w := do(tokenC, "GET", "/chats/"+first+"/settings", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = do(tokenC, "PATCH", "/chats/"+first+"/settings", map[string]any{"archived": true})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Changes are synced", func(t *testing.T) {
+		require.NotEmpty(t, synced)
+		last := synced[len(synced)-1]
+		assert.Equal(t, second, last.ChatID.String())
+		assert.False(t, last.MutedUntil.Valid)
+	})
+
+	t.Run("Concurrent pins", func(t *testing.T) {
+		alice, err := repo.GetUserByEmail(t.Context(), "alice@test.com")
+		require.NoError(t, err)
+		before, err := repo.CountPinnedChats(t.Context(), alice.ID)
+		require.NoError(t, err)
+
+		// more chats than free slots, pinned at once
+		chats := make([]string, 12)
+		for i := range chats {
+			chats[i] = newChat(fmt.Sprint("race ", i))
+		}
+
+		codes := make([]int, len(chats))
+		var wg sync.WaitGroup
+		for i, chatID := range chats {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes[i] = do(tokenA, "PATCH", "/chats/"+chatID+"/settings", map[string]any{"pinned": true}).Code
+			}()
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, code := range codes {
+			if code == http.StatusOK {
+				succeeded++
+			} else {
+				assert.Equal(t, http.StatusBadRequest, code)
+			}
+		}
+		assert.Equal(t, 10-int(before), succeeded)
+
+		pinned, err := repo.CountPinnedChats(t.Context(), alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), pinned)
+	})
+}
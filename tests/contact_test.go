@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContacts(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	rdb := SetupTestRedis(t)
+	defer rdb.Close()
+	repo := pgdb.New(pool)
+
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, rdb, nil)
+	chatHandler := handler.NewChatHandler(service.NewChatService(repo, pool), userService)
+	contactHandler := handler.NewContactHandler(service.NewContactService(repo, pool), rdb)
+
+	r := chi.NewRouter()
+	r.Use(userHandler.AuthMiddleware)
+	r.Get("/users/me", userHandler.GetMe)
+	r.Patch("/users/me", userHandler.UpdateMe)
+	r.Post("/chats", chatHandler.CreateChat)
+	r.Get("/contacts", contactHandler.ListContacts)
+	r.Delete("/contacts/{user_id}", contactHandler.RemoveContact)
+	r.Get("/contacts/requests", contactHandler.ListRequests)
+	r.Post("/contacts/requests", contactHandler.SendRequest)
+	r.Delete("/contacts/requests/{user_id}", contactHandler.CancelRequest)
+	r.Post("/contacts/requests/{user_id}/accept", contactHandler.AcceptRequest)
+	r.Post("/contacts/requests/{user_id}/decline", contactHandler.DeclineRequest)
+
+	do := func(token, method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	meID := func(token string) string {
+		var me map[string]any
+		json.Unmarshal(do(token, "GET", "/users/me", nil).Body.Bytes(), &me)
+		return me["id"].(string)
+	}
+
+	contacts := func(t *testing.T, token string) []handler.ContactResponse {
+		w := do(token, "GET", "/contacts", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp []handler.ContactResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	requests := func(t *testing.T, token string) handler.ContactRequestsResponse {
+		w := do(token, "GET", "/contacts/requests", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp handler.ContactRequestsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	alice := RegisterAndLogin(t, userHandler, "Alice", "alice@example.com")
+	bob := RegisterAndLogin(t, userHandler, "Bob", "bob@example.com")
+	carol := RegisterAndLogin(t, userHandler, "Carol", "carol@example.com")
+	aliceID, bobID, carolID := meID(alice), meID(bob), meID(carol)
+
+	t.Run("Request And Accept", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, do(alice, "POST", "/contacts/requests", map[string]string{"user_id": bobID}).Code)
+		// asking twice changes nothing
+		assert.Equal(t, http.StatusCreated, do(alice, "POST", "/contacts/requests", map[string]string{"user_id": bobID}).Code)
+
+		pending := requests(t, bob)
+		require.Len(t, pending.Incoming, 1)
+		assert.Equal(t, "Alice", pending.Incoming[0].Username)
+		assert.Len(t, requests(t, alice).Outgoing, 1)
+
+		assert.Equal(t, http.StatusNoContent, do(bob, "POST", "/contacts/requests/"+aliceID+"/accept", nil).Code)
+		assert.Empty(t, requests(t, bob).Incoming)
+
+		rdb.Set(t.Context(), "user:"+bobID+":online", "true", 0)
+		list := contacts(t, alice)
+		require.Len(t, list, 1)
+		assert.Equal(t, "Bob", list[0].Username)
+		require.NotNil(t, list[0].Online)
+		assert.True(t, *list[0].Online)
+
+		require.Len(t, contacts(t, bob), 1)
+		assert.False(t, *contacts(t, bob)[0].Online)
+
+		assert.Equal(t, http.StatusConflict, do(bob, "POST", "/contacts/requests", map[string]string{"user_id": aliceID}).Code)
+	})
+
+	t.Run("Crossed Requests", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, do(carol, "POST", "/contacts/requests", map[string]string{"user_id": bobID}).Code)
+		// bob asking carol back accepts hers
+		assert.Equal(t, http.StatusOK, do(bob, "POST", "/contacts/requests", map[string]string{"user_id": carolID}).Code)
+		assert.Len(t, contacts(t, carol), 1)
+		assert.Len(t, contacts(t, bob), 2)
+	})
+
+	t.Run("Decline And Cancel", func(t *testing.T) {
+		do(carol, "POST", "/contacts/requests", map[string]string{"user_id": aliceID})
+		assert.Equal(t, http.StatusNoContent, do(alice, "POST", "/contacts/requests/"+carolID+"/decline", nil).Code)
+		assert.Equal(t, http.StatusNotFound, do(alice, "POST", "/contacts/requests/"+carolID+"/accept", nil).Code)
+
+		do(carol, "POST", "/contacts/requests", map[string]string{"user_id": aliceID})
+		assert.Equal(t, http.StatusNoContent, do(carol, "DELETE", "/contacts/requests/"+aliceID, nil).Code)
+		assert.Empty(t, requests(t, alice).Incoming)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do(alice, "POST", "/contacts/requests", map[string]string{"user_id": aliceID}).Code)
+		assert.Equal(t, http.StatusNotFound, do(alice, "POST", "/contacts/requests", map[string]string{"user_id": "00000000-0000-0000-0000-000000000000"}).Code)
+		assert.Equal(t, http.StatusNotFound, do(alice, "DELETE", "/contacts/"+carolID, nil).Code)
+	})
+
+	t.Run("Contacts Only DMs", func(t *testing.T) {
+		do(bob, "PATCH", "/users/me", map[string]any{"contacts_only_dms": true})
+
+		// carol is a contact of bob, alice was, until now
+		assert.Equal(t, http.StatusNoContent, do(alice, "DELETE", "/contacts/"+bobID, nil).Code)
+		assert.Empty(t, contacts(t, alice))
+
+		assert.Equal(t, http.StatusForbidden, do(alice, "POST", "/chats", map[string]any{"user_ids": []string{bobID}}).Code)
+		assert.Equal(t, http.StatusForbidden, do(alice, "POST", "/chats", map[string]any{"partner_email": "bob@example.com"}).Code)
+		assert.Equal(t, http.StatusCreated, do(carol, "POST", "/chats", map[string]any{"user_ids": []string{bobID}}).Code)
+
+		// groups are not direct chats
+		assert.Equal(t, http.StatusCreated, do(alice, "POST", "/chats", map[string]any{
+			"name": "Team", "user_ids": []string{bobID, carolID},
+		}).Code)
+	})
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrafts(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	rdb := SetupTestRedis(t)
+	defer rdb.Close()
+	repo := pgdb.New(pool)
+
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, rdb, nil)
+	chatService := service.NewChatService(repo, pool)
+	chatHandler := handler.NewChatHandler(chatService, userService)
+
+	type change struct {
+		draft     pgdb.ChatDraft
+		sessionID string
+	}
+	var changes []change
+	chatService.OnDraftChanged(func(ctx context.Context, draft *pgdb.ChatDraft, sessionID string) {
+		changes = append(changes, change{*draft, sessionID})
+	})
+
+	r := chi.NewRouter()
+	r.Use(userHandler.AuthMiddleware)
+	r.Get("/chats", chatHandler.ListChats)
+	r.Post("/chats", chatHandler.CreateChat)
+	r.Get("/chats/{chat_id}/draft", chatHandler.GetDraft)
+	r.Put("/chats/{chat_id}/draft", chatHandler.PutDraft)
+
+	do := func(token, method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tokenA := RegisterAndLogin(t, userHandler, "alice", "alice@test.com")
+	tokenB := RegisterAndLogin(t, userHandler, "bob", "bob@test.com")
+	tokenC := RegisterAndLogin(t, userHandler, "carol", "carol@test.com")
+
+	w := do(tokenA, "POST", "/chats", map[string]any{"partner_email": "bob@test.com"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var chat map[string]string
+	json.Unmarshal(w.Body.Bytes(), &chat)
+	chatID := chat["chat_id"]
+
+	draft := func(t *testing.T, token string) handler.DraftResponse {
+		w := do(token, "GET", "/chats/"+chatID+"/draft", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp handler.DraftResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	t.Run("Empty by default", func(t *testing.T) {
+		resp := draft(t, tokenA)
+		assert.Equal(t, chatID, resp.ChatID)
+		assert.Empty(t, resp.Content)
+		assert.Nil(t, resp.UpdatedAt)
+	})
+
+	t.Run("Save and sync", func(t *testing.T) {
+		w := do(tokenA, "PUT", "/chats/"+chatID+"/draft", map[string]string{"content": "see you at"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		resp := draft(t, tokenA)
+		assert.Equal(t, "see you at", resp.Content)
+		assert.NotNil(t, resp.UpdatedAt)
+
+		// drafts are per member
+		assert.Empty(t, draft(t, tokenB).Content)
+
+		require.NotEmpty(t, changes)
+		last := changes[len(changes)-1]
+		assert.Equal(t, "see you at", last.draft.Content)
+		assert.NotEmpty(t, last.sessionID, "the saving device is left out of the sync")
+	})
+
+	t.Run("In the chat list", func(t *testing.T) {
+		w := do(tokenA, "GET", "/chats", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var chats []handler.ChatListItem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &chats))
+		require.Len(t, chats, 1)
+		require.NotNil(t, chats[0].Draft)
+		assert.Equal(t, "see you at", chats[0].Draft.Content)
+
+		w = do(tokenB, "GET", "/chats", nil)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &chats))
+		require.Len(t, chats, 1)
+		assert.Nil(t, chats[0].Draft)
+	})
+
+	t.Run("Blank content clears", func(t *testing.T) {
+		w := do(tokenA, "PUT", "/chats/"+chatID+"/draft", map[string]string{"content": "  "})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, draft(t, tokenA).Content)
+		assert.Empty(t, changes[len(changes)-1].draft.Content)
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		w := do(tokenA, "PUT", "/chats/"+chatID+"/draft", map[string]string{"content": strings.Repeat("a", 33<<10)})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+		w = do(tokenC, "PUT", "/chats/"+chatID+"/draft", map[string]string{"content": "hi"})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = do(tokenC, "GET", "/chats/"+chatID+"/draft", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatFolders(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	rdb := SetupTestRedis(t)
+	defer rdb.Close()
+	repo := pgdb.New(pool)
+
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, rdb, nil)
+	chatHandler := handler.NewChatHandler(service.NewChatService(repo, pool), userService)
+
+	r := chi.NewRouter()
+	r.Use(userHandler.AuthMiddleware)
+	r.Get("/users/me", userHandler.GetMe)
+	r.Get("/chats", chatHandler.ListChats)
+	r.Post("/chats", chatHandler.CreateChat)
+	r.Patch("/chats/{chat_id}/settings", chatHandler.UpdateSettings)
+	r.Get("/folders", chatHandler.ListFolders)
+	r.Post("/folders", chatHandler.CreateFolder)
+	r.Patch("/folders/{folder_id}", chatHandler.UpdateFolder)
+	r.Delete("/folders/{folder_id}", chatHandler.DeleteFolder)
+
+	do := func(token, method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tokenA := RegisterAndLogin(t, userHandler, "alice", "alice@test.com")
+	tokenB := RegisterAndLogin(t, userHandler, "bob", "bob@test.com")
+	RegisterAndLogin(t, userHandler, "carol", "carol@test.com")
+
+	var meB map[string]any
+	json.Unmarshal(do(tokenB, "GET", "/users/me", nil).Body.Bytes(), &meB)
+
+	newChat := func(body map[string]any) string {
+		w := do(tokenA, "POST", "/chats", body)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp["chat_id"]
+	}
+	direct := newChat(map[string]any{"partner_email": "bob@test.com"})
+	work := newChat(map[string]any{"name": "work", "partner_email": "carol@test.com", "user_ids": []string{meB["id"].(string)}})
+	family := newChat(map[string]any{"name": "family", "partner_email": "carol@test.com", "user_ids": []string{meB["id"].(string)}})
+
+	list := func(t *testing.T, query string) []string {
+		w := do(tokenA, "GET", "/chats"+query, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp []handler.ChatListItem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		ids := make([]string, 0, len(resp))
+		for _, c := range resp {
+			ids = append(ids, c.ID)
+		}
+		return ids
+	}
+
+	create := func(t *testing.T, body map[string]any) handler.FolderResponse {
+		w := do(tokenA, "POST", "/folders", body)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp handler.FolderResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	t.Run("Explicit chats", func(t *testing.T) {
+		folder := create(t, map[string]any{"name": "Work", "chat_ids": []string{work, direct}})
+		assert.Equal(t, "Work", folder.Name)
+		assert.ElementsMatch(t, []string{work, direct}, folder.ChatIDs)
+
+		assert.ElementsMatch(t, []string{work, direct}, list(t, "?folder_id="+folder.ID))
+
+		w := do(tokenA, "PATCH", "/folders/"+folder.ID, map[string]any{"chat_ids": []string{work}})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, []string{work}, list(t, "?folder_id="+folder.ID))
+	})
+
+	t.Run("Rules", func(t *testing.T) {
+		groups := create(t, map[string]any{"name": "Groups", "groups_only": true, "exclude_muted": true})
+		assert.Empty(t, groups.ChatIDs)
+		assert.ElementsMatch(t, []string{work, family}, list(t, "?folder_id="+groups.ID))
+
+		w := do(tokenA, "PATCH", "/chats/"+family+"/settings", map[string]any{"muted_until": time.Now().Add(time.Hour)})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{work}, list(t, "?folder_id="+groups.ID))
+
+		unread := create(t, map[string]any{"name": "Unread", "unread_only": true})
+		assert.Empty(t, list(t, "?folder_id="+unread.ID))
+
+		var chatUUID, bobUUID pgtype.UUID
+		chatUUID.Scan(direct)
+		bobUUID.Scan(meB["id"].(string))
+		_, err := repo.CreateMessage(t.Context(), pgdb.CreateMessageParams{
+			ChatID:   chatUUID,
+			SenderID: bobUUID,
+			Content:  "hi",
+			Kind:     "text",
+		})
+		require.NoError(t, err)
+
+		w = do(tokenA, "PATCH", "/chats/"+work+"/settings", map[string]any{"marked_unread": true})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.ElementsMatch(t, []string{direct, work}, list(t, "?folder_id="+unread.ID))
+	})
+
+	t.Run("Invalid folders", func(t *testing.T) {
+		w := do(tokenA, "POST", "/folders", map[string]any{"name": "Everything"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = do(tokenA, "POST", "/folders", map[string]any{"chat_ids": []string{work}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		// bob is not in this chat
+		w = do(tokenB, "POST", "/folders", map[string]any{"name": "x", "chat_ids": []string{work, "00000000-0000-0000-0000-000000000000"}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Folders are per user", func(t *testing.T) {
+		w := do(tokenA, "GET", "/folders", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var folders []handler.FolderResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &folders))
+		require.Len(t, folders, 3)
+		assert.Equal(t, []string{"Work", "Groups", "Unread"}, []string{folders[0].Name, folders[1].Name, folders[2].Name})
+		assert.Equal(t, []string{work}, folders[0].ChatIDs)
+
+		w = do(tokenB, "GET", "/chats?folder_id="+folders[0].ID, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = do(tokenB, "DELETE", "/folders/"+folders[0].ID, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = do(tokenA, "DELETE", "/folders/"+folders[0].ID, nil)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		w = do(tokenA, "GET", "/chats?folder_id="+folders[0].ID, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		// the chats themselves stay
+		assert.Len(t, list(t, ""), 3)
+	})
+}
@@ -0,0 +1,358 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 - a bucket that keeps object sizes only: it can be listed, stat'ed,
+// deleted from and filled by multipart uploads
+type fakeS3 struct {
+	*httptest.Server
+	bucket string
+
+	mu        sync.Mutex
+	objects   map[string]int64            // size by key, all modified long ago
+	uploads   map[string]map[string]int64 // part sizes by ETag, by upload id
+	completed int
+	aborted   int
+
+	// onComplete - runs once the parts are glued, before the response is sent
+	onComplete func()
+}
+
+func newFakeS3(t *testing.T, bucket string) *fakeS3 {
+	s := &fakeS3{
+		bucket:  bucket,
+		objects: make(map[string]int64),
+		uploads: make(map[string]map[string]int64),
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/"+bucket+"/")
+		query := r.URL.Query()
+		uploadID := query.Get("uploadId")
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		switch {
+		case r.Method == http.MethodGet && key == "":
+			type content struct {
+				Key          string
+				LastModified string
+				Size         int64
+			}
+			result := struct {
+				XMLName     xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+				Name        string
+				KeyCount    int
+				IsTruncated bool
+				Contents    []content
+			}{Name: bucket, KeyCount: len(s.objects)}
+
+			modified := time.Now().Add(-30 * 24 * time.Hour).UTC().Format("2006-01-02T15:04:05.000Z")
+			for key, size := range s.objects {
+				result.Contents = append(result.Contents, content{Key: key, LastModified: modified, Size: size})
+			}
+			w.Header().Set("Content-Type", "application/xml")
+			xml.NewEncoder(w).Encode(result)
+		case r.Method == http.MethodHead:
+			size, ok := s.objects[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.Header().Set("ETag", `"`+key+`"`)
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			uploadID := rand.Text()
+			s.uploads[uploadID] = make(map[string]int64)
+			xml.NewEncoder(w).Encode(struct {
+				XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+				Bucket   string
+				Key      string
+				UploadId string
+			}{Bucket: bucket, Key: key, UploadId: uploadID})
+		case r.Method == http.MethodPut && uploadID != "":
+			parts, ok := s.uploads[uploadID]
+			if !ok {
+				writeS3Error(w, "NoSuchUpload")
+				return
+			}
+			// parts may come aws-chunked, with a checksum trailer
+			size, _ := io.Copy(io.Discard, r.Body)
+			if decoded := r.Header.Get("X-Amz-Decoded-Content-Length"); decoded != "" {
+				size, _ = strconv.ParseInt(decoded, 10, 64)
+			}
+			etag := rand.Text()
+			parts[etag] = size
+			w.Header().Set("ETag", `"`+etag+`"`)
+		case r.Method == http.MethodPost && uploadID != "":
+			parts, ok := s.uploads[uploadID]
+			if !ok {
+				writeS3Error(w, "NoSuchUpload")
+				return
+			}
+			var body struct {
+				Parts []struct{ ETag string } `xml:"Part"`
+			}
+			xml.NewDecoder(r.Body).Decode(&body)
+
+			var size int64
+			for _, part := range body.Parts {
+				size += parts[strings.Trim(part.ETag, `"`)]
+			}
+			s.objects[key] = size
+			delete(s.uploads, uploadID)
+			s.completed++
+			if s.onComplete != nil {
+				s.onComplete()
+			}
+
+			xml.NewEncoder(w).Encode(struct {
+				XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+				Bucket  string
+				Key     string
+				ETag    string
+			}{Bucket: bucket, Key: key, ETag: `"` + key + `"`})
+		case r.Method == http.MethodDelete && uploadID != "":
+			if _, ok := s.uploads[uploadID]; !ok {
+				writeS3Error(w, "NoSuchUpload")
+				return
+			}
+			delete(s.uploads, uploadID)
+			s.aborted++
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodDelete:
+			delete(s.objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func writeS3Error(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusNotFound)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+	}{Code: code})
+}
+
+func (s *fakeS3) put(key string, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = size
+}
+
+func (s *fakeS3) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.objects[key]
+	return ok
+}
+
+// multipart - how many uploads were completed and aborted so far
+func (s *fakeS3) multipart() (completed, aborted int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.completed, s.aborted
+}
+
+func (s *fakeS3) client(t *testing.T) *minio.Client {
+	endpoint, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	client, err := minio.New(endpoint.Host, &minio.Options{Region: "us-east-1"})
+	require.NoError(t, err)
+	return client
+}
+
+func TestGarbageCollector(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	repo := pgdb.New(pool)
+	ctx := t.Context()
+
+	s3 := newFakeS3(t, "images")
+	fileService := service.NewFileService(s3.client(t), "images", "localhost:9000", repo, pool, 1<<20)
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, nil, fileService)
+
+	RegisterAndLogin(t, userHandler, "Collector", "collector@example.com")
+	user, err := repo.GetUserByEmail(ctx, "collector@example.com")
+	require.NoError(t, err)
+
+	// save - a file with new content, its object in the bucket
+	save := func(t *testing.T) *pgdb.File {
+		sum := sha256.Sum256([]byte(rand.Text()))
+		key := rand.Text() + ".bin"
+		s3.put(key, 10)
+
+		file, err := fileService.SaveFile(ctx, repo, service.NewFile{
+			OwnerID: user.ID, Sha256: hex.EncodeToString(sum[:]),
+			ObjectKey: key, FileName: "file.bin", ContentType: "application/octet-stream", Size: 10,
+		})
+		require.NoError(t, err)
+		return file
+	}
+
+	fileExists := func(t *testing.T, file *pgdb.File) bool {
+		_, err := repo.GetFileByID(ctx, file.ID)
+		if err == nil {
+			return true
+		}
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+		return false
+	}
+
+	blobExists := func(t *testing.T, file *pgdb.File) bool {
+		_, err := repo.GetBlob(ctx, file.Sha256.String)
+		if err == nil {
+			return true
+		}
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+		return false
+	}
+
+	// a cutoff in the future makes everything old enough
+	collect := func(t *testing.T, gracePeriod time.Duration, dryRun bool) *service.GCReport {
+		gc := service.NewGarbageCollector(repo, pool, fileService, config.GC{
+			Interval: time.Hour, GracePeriod: gracePeriod, DryRun: dryRun,
+		})
+		report, err := gc.Collect(ctx)
+		require.NoError(t, err)
+		return report
+	}
+
+	t.Run("Dry Run", func(t *testing.T) {
+		orphan := save(t)
+		stray := rand.Text()
+		s3.put(stray, 5)
+
+		report := collect(t, -time.Hour, true)
+		assert.True(t, report.DryRun)
+		assert.GreaterOrEqual(t, report.Files, 1)
+
+		assert.True(t, fileExists(t, orphan))
+		assert.True(t, blobExists(t, orphan))
+		assert.True(t, s3.has(orphan.ObjectKey))
+		assert.True(t, s3.has(stray))
+	})
+
+	t.Run("Grace Period", func(t *testing.T) {
+		fresh := save(t)
+		collect(t, time.Hour, false)
+
+		assert.True(t, fileExists(t, fresh))
+		assert.True(t, s3.has(fresh.ObjectKey))
+	})
+
+	t.Run("Orphans Are Collected", func(t *testing.T) {
+		orphan := save(t)
+		stray := rand.Text()
+		s3.put(stray, 5)
+
+		usage, err := fileService.GetUsage(ctx, user.ID.String())
+		require.NoError(t, err)
+
+		report := collect(t, -time.Hour, false)
+		assert.GreaterOrEqual(t, report.Files, 1)
+
+		assert.False(t, fileExists(t, orphan))
+		assert.False(t, blobExists(t, orphan), "blob is not released")
+		assert.False(t, s3.has(orphan.ObjectKey))
+		assert.False(t, s3.has(stray))
+
+		after, err := fileService.GetUsage(ctx, user.ID.String())
+		require.NoError(t, err)
+		assert.Less(t, after.UsedBytes, usage.UsedBytes)
+	})
+
+	t.Run("Referenced Files Survive", func(t *testing.T) {
+		avatar := save(t)
+		require.NoError(t, userService.UpdateAvatar(ctx, user.ID, fileService.PublicURL(avatar.ObjectKey), avatar.ID))
+
+		// the same content owned twice, one copy is an orphan
+		shared := save(t)
+		_, err := fileService.SaveFile(ctx, repo, service.NewFile{
+			OwnerID: user.ID, Sha256: shared.Sha256.String,
+			ObjectKey: "unused", FileName: "copy.bin", ContentType: "application/octet-stream", Size: 10,
+		})
+		require.NoError(t, err)
+		require.NoError(t, userService.UpdateAvatar(ctx, user.ID, fileService.PublicURL(shared.ObjectKey), shared.ID))
+
+		collect(t, -time.Hour, false)
+
+		assert.False(t, fileExists(t, avatar), "the previous avatar is unreferenced")
+		assert.False(t, s3.has(avatar.ObjectKey))
+
+		assert.True(t, fileExists(t, shared))
+		assert.True(t, blobExists(t, shared))
+		assert.True(t, s3.has(shared.ObjectKey))
+	})
+
+	t.Run("Reacquired Blob Survives", func(t *testing.T) {
+		sum := sha256.Sum256([]byte(rand.Text()))
+		blob, err := repo.AcquireBlob(ctx, pgdb.AcquireBlobParams{
+			Sha256: hex.EncodeToString(sum[:]), ObjectKey: rand.Text(), Size: 10,
+		})
+		require.NoError(t, err)
+		require.NoError(t, repo.ReleaseBlob(ctx, blob.Sha256))
+
+		// a new file takes the dead blob while the GC is about to delete it
+		tx, err := pool.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback(ctx)
+		_, err = repo.WithTx(tx).LockBlob(ctx, blob.Sha256)
+		require.NoError(t, err)
+
+		deleted := make(chan int64)
+		go func() {
+			n, err := repo.DeleteDeadBlob(ctx, pgdb.DeleteDeadBlobParams{
+				Sha256:         blob.Sha256,
+				ReleasedBefore: pgtype.Timestamptz{Time: time.Now().Add(time.Hour), Valid: true},
+			})
+			assert.NoError(t, err)
+			deleted <- n
+		}()
+
+		_, err = repo.WithTx(tx).AcquireBlob(ctx, pgdb.AcquireBlobParams{
+			Sha256: blob.Sha256, ObjectKey: blob.ObjectKey, Size: blob.Size,
+		})
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit(ctx))
+
+		assert.Equal(t, int64(0), <-deleted)
+		acquired, err := repo.GetBlob(ctx, blob.Sha256)
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), acquired.RefCount)
+	})
+}
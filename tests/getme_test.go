@@ -20,7 +20,7 @@ func TestGetMe(t *testing.T) {
 	repo := pgdb.New(pool)
 
 	userService := service.NewUserService(repo, secret_token)
-	userHandler := handler.NewUserHandler(userService, secret_token, nil, nil)
+	userHandler := handler.NewUserHandler(userService, nil, nil)
 
 	r := chi.NewRouter()
 	r.Use(userHandler.AuthMiddleware)
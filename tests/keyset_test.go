@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKey(t *testing.T, dir, kid string, key any) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600))
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writeKey(t, dir, "2026-01", rsaKey)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writeKey(t, dir, "2026-02", edKey)
+
+	claims := jwt.MapClaims{
+		"user_id": "user-1",
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	}
+
+	_, err = service.LoadKeySet(config.Auth{KeysDir: dir})
+	assert.Error(t, err, "two private keys and no signing_key")
+
+	oldKeys, err := service.LoadKeySet(config.Auth{KeysDir: dir, SigningKey: "2026-01"})
+	require.NoError(t, err)
+	newKeys, err := service.LoadKeySet(config.Auth{KeysDir: dir, SigningKey: "2026-02"})
+	require.NoError(t, err)
+
+	t.Run("Old Tokens Still Verify", func(t *testing.T) {
+		oldToken, err := oldKeys.Sign(claims)
+		require.NoError(t, err)
+
+		token, err := newKeys.Parse(oldToken)
+		require.NoError(t, err)
+		assert.Equal(t, "2026-01", token.Header["kid"])
+		assert.Equal(t, "RS256", token.Method.Alg())
+
+		newToken, err := newKeys.Sign(claims)
+		require.NoError(t, err)
+
+		token, err = newKeys.Parse(newToken)
+		require.NoError(t, err)
+		assert.Equal(t, "2026-02", token.Header["kid"])
+		assert.Equal(t, "EdDSA", token.Method.Alg())
+	})
+
+	t.Run("Unknown Kid", func(t *testing.T) {
+		otherKeys := service.NewHMACKeySet(secret_token)
+		forged, err := otherKeys.Sign(claims)
+		require.NoError(t, err)
+
+		_, err = newKeys.Parse(forged)
+		assert.Error(t, err)
+	})
+
+	t.Run("Public Key As HMAC Secret", func(t *testing.T) {
+		der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+		require.NoError(t, err)
+
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["kid"] = "2026-01"
+		forged, err := token.SignedString(der)
+		require.NoError(t, err)
+
+		_, err = newKeys.Parse(forged)
+		assert.Error(t, err)
+	})
+
+	t.Run("Middleware And JWKS", func(t *testing.T) {
+		userService := service.NewUserService(nil, secret_token)
+		userService.SetKeySet(newKeys)
+		userHandler := handler.NewUserHandler(userService, nil, nil)
+
+		protected := userHandler.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		oldToken, err := oldKeys.Sign(claims)
+		require.NoError(t, err)
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+oldToken)
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		hmacToken, err := service.NewHMACKeySet(secret_token).Sign(claims)
+		require.NoError(t, err)
+		req = httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+hmacToken)
+		w = httptest.NewRecorder()
+		protected.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = httptest.NewRecorder()
+		userHandler.JWKS(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var jwks service.JWKS
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+		require.Len(t, jwks.Keys, 2)
+		assert.Equal(t, "RSA", jwks.Keys[0].Kty)
+		assert.Equal(t, "AQAB", jwks.Keys[0].E)
+		assert.Equal(t, "OKP", jwks.Keys[1].Kty)
+		assert.Equal(t, "Ed25519", jwks.Keys[1].Crv)
+	})
+}
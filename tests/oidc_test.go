@@ -0,0 +1,323 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockOIDC - a provider with discovery, JWKS, an authorize endpoint that
+// logs in User right away, and a token endpoint checking PKCE
+type mockOIDC struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]mockGrant // by code
+	User   jwt.MapClaims
+}
+
+type mockGrant struct {
+	challenge string
+	nonce     string
+	user      jwt.MapClaims
+}
+
+const (
+	mockClientID     = "messenger"
+	mockClientSecret = "s3cret"
+	mockRedirectURL  = "http://messenger.test/api/auth/oidc/mock/callback"
+)
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	m := &mockOIDC{key: key, grants: make(map[string]mockGrant)}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(service.JWKS{Keys: []service.JWK{{
+			Kty: "RSA", Kid: "mock-key", Use: "sig", Alg: "RS256",
+			N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != mockClientID || q.Get("code_challenge_method") != "S256" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		code := rand.Text()
+		m.mu.Lock()
+		m.grants[code] = mockGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), user: m.User}
+		m.mu.Unlock()
+
+		http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{
+			"code":  {code},
+			"state": {q.Get("state")},
+		}.Encode(), http.StatusFound)
+	})
+
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != mockClientID || secret != mockClientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		m.mu.Lock()
+		grant, ok := m.grants[r.PostFormValue("code")]
+		delete(m.grants, r.PostFormValue("code"))
+		m.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := jwt.MapClaims{"nonce": grant.nonce}
+		for k, v := range grant.user {
+			claims[k] = v
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "opaque",
+			"token_type":   "Bearer",
+			"id_token":     m.sign(t, claims),
+		})
+	})
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// sign - an ID token from the provider, claims override the defaults
+func (m *mockOIDC) sign(t *testing.T, claims jwt.MapClaims) string {
+	full := jwt.MapClaims{
+		"iss": m.URL,
+		"aud": mockClientID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(5 * time.Minute).Unix(),
+	}
+	for k, v := range claims {
+		full[k] = v
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, full)
+	token.Header["kid"] = "mock-key"
+	signed, err := token.SignedString(m.key)
+	require.NoError(t, err)
+	return signed
+}
+
+func (m *mockOIDC) config() config.OIDCProvider {
+	return config.OIDCProvider{
+		Name:         "mock",
+		Issuer:       m.URL,
+		ClientID:     mockClientID,
+		ClientSecret: mockClientSecret,
+		RedirectURL:  mockRedirectURL,
+	}
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	mock := newMockOIDC(t)
+	provider := service.NewOIDCProvider(mock.config(), mock.Client())
+	ctx := t.Context()
+
+	valid := jwt.MapClaims{"sub": "u-1", "email": "dev@corp.example", "nonce": "n-1", "email_verified": true}
+	claims, err := provider.VerifyIDToken(ctx, mock.sign(t, valid), "n-1")
+	require.NoError(t, err)
+	assert.Equal(t, "u-1", claims.Subject)
+	assert.True(t, claims.EmailVerified)
+
+	with := func(k string, v any) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		for key, value := range valid {
+			claims[key] = value
+		}
+		claims[k] = v
+		return claims
+	}
+
+	invalid := map[string]jwt.MapClaims{
+		"other nonce":    with("nonce", "n-2"),
+		"other audience": with("aud", "someone-else"),
+		"other issuer":   with("iss", "https://evil.example"),
+		"expired":        with("exp", time.Now().Add(-time.Hour).Unix()),
+		"no email":       with("email", ""),
+	}
+	for name, claims := range invalid {
+		_, err := provider.VerifyIDToken(ctx, mock.sign(t, claims), "n-1")
+		assert.ErrorIs(t, err, service.ErrInvalidIDToken, name)
+	}
+
+	// right kid, wrong key
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, with("iss", mock.URL))
+	forged.Header["kid"] = "mock-key"
+	signed, err := forged.SignedString(otherKey)
+	require.NoError(t, err)
+	_, err = provider.VerifyIDToken(ctx, signed, "n-1")
+	assert.ErrorIs(t, err, service.ErrInvalidIDToken)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	rdb := SetupTestRedis(t)
+	defer rdb.Close()
+	repo := pgdb.New(pool)
+
+	mock := newMockOIDC(t)
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, nil, nil)
+	oidcService, err := service.NewOIDCService(rdb, userService, []config.OIDCProvider{mock.config()})
+	require.NoError(t, err)
+	oidcHandler := handler.NewOIDCHandler(oidcService)
+
+	r := chi.NewRouter()
+	r.Get("/auth/oidc/{provider}/login", oidcHandler.Login)
+	r.Get("/auth/oidc/{provider}/callback", oidcHandler.Callback)
+	r.With(userHandler.AuthMiddleware).Get("/users/me", userHandler.GetMe)
+
+	browser := mock.Client()
+	browser.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	// authorize - our login redirect, then the provider's back to the callback
+	authorize := func(t *testing.T) string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/mock/login", nil))
+		require.Equal(t, http.StatusFound, w.Code)
+
+		resp, err := browser.Get(w.Header().Get("Location"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		require.NoError(t, err)
+		return callback.RawQuery
+	}
+
+	callback := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/mock/callback?"+query, nil))
+		return w
+	}
+
+	me := func(t *testing.T, w *httptest.ResponseRecorder) map[string]any {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var session handler.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+
+		req := httptest.NewRequest("GET", "/users/me", nil)
+		req.Header.Set("Authorization", "Bearer "+session.Token)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp
+	}
+
+	var firstID any
+
+	t.Run("First Login Provisions", func(t *testing.T) {
+		mock.User = jwt.MapClaims{
+			"sub": "employee-1", "email": "jane@corp.example", "email_verified": true,
+			"preferred_username": "jane doe",
+		}
+		user := me(t, callback(authorize(t)))
+		assert.Equal(t, "jane@corp.example", user["email"])
+		assert.Equal(t, "jane_doe", user["username"])
+		assert.Equal(t, true, user["email_verified"])
+		firstID = user["id"]
+
+		// the same identity, the same user
+		user = me(t, callback(authorize(t)))
+		assert.Equal(t, firstID, user["id"])
+	})
+
+	t.Run("State Is Single Use", func(t *testing.T) {
+		query := authorize(t)
+		require.Equal(t, http.StatusOK, callback(query).Code)
+		assert.Equal(t, http.StatusUnauthorized, callback(query).Code)
+	})
+
+	t.Run("PKCE Binds The Code", func(t *testing.T) {
+		first, _ := url.ParseQuery(authorize(t))
+		second, _ := url.ParseQuery(authorize(t))
+
+		// the code of one login with the state, so the verifier, of another
+		w := callback(url.Values{"code": {first.Get("code")}, "state": {second.Get("state")}}.Encode())
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Existing Account", func(t *testing.T) {
+		RegisterAndLogin(t, userHandler, "Bob", "bob@corp.example")
+
+		mock.User = jwt.MapClaims{"sub": "employee-2", "email": "bob@corp.example", "email_verified": false}
+		assert.Equal(t, http.StatusConflict, callback(authorize(t)).Code)
+
+		// the provider vouches for the email, the account never did
+		mock.User["email_verified"] = true
+		assert.Equal(t, http.StatusConflict, callback(authorize(t)).Code)
+
+		bob, err := repo.GetUserByEmail(t.Context(), "bob@corp.example")
+		require.NoError(t, err)
+		_, err = repo.SetEmailVerified(t.Context(), pgdb.SetEmailVerifiedParams{ID: bob.ID, Email: bob.Email})
+		require.NoError(t, err)
+
+		user := me(t, callback(authorize(t)))
+		assert.Equal(t, "Bob", user["username"])
+	})
+	t.Run("Password-less Account", func(t *testing.T) {
+		mock.User = jwt.MapClaims{"sub": "employee-3", "email": "carol@corp.example", "email_verified": true}
+		carol := me(t, callback(authorize(t)))["id"].(string)
+		ctx := t.Context()
+
+		// the first password needs no current one, the next ones do
+		require.NoError(t, userService.ChangePassword(ctx, carol, "", "", "carol-password"))
+		err := userService.ChangePassword(ctx, carol, "", "", "other-password")
+		assert.ErrorIs(t, err, service.ErrWrongPassword)
+
+		require.NoError(t, userService.DeleteAccount(ctx, carol, "carol-password"))
+	})
+}
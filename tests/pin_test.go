@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPinnedMessages(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	rdb := SetupTestRedis(t)
+	defer rdb.Close()
+	repo := pgdb.New(pool)
+
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, rdb, nil)
+	chatService := service.NewChatService(repo, pool)
+	chatHandler := handler.NewChatHandler(chatService, userService)
+
+	var mu sync.Mutex
+	var notices []pgdb.Message
+	chatService.OnPinChanged(func(ctx context.Context, msg *pgdb.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		notices = append(notices, *msg)
+	})
+
+	r := chi.NewRouter()
+	r.Use(userHandler.AuthMiddleware)
+	r.Get("/users/me", userHandler.GetMe)
+	r.Post("/chats", chatHandler.CreateChat)
+	r.Patch("/chats/{chat_id}", chatHandler.UpdateChat)
+	r.Get("/chats/{chat_id}/messages", chatHandler.GetMessages)
+	r.Get("/chats/{chat_id}/pins", chatHandler.ListPinned)
+	r.Post("/chats/{chat_id}/pins", chatHandler.PinMessage)
+	r.Delete("/chats/{chat_id}/pins/{message_id}", chatHandler.UnpinMessage)
+
+	do := func(token, method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tokenA := RegisterAndLogin(t, userHandler, "alice", "alice@test.com")
+	tokenB := RegisterAndLogin(t, userHandler, "bob", "bob@test.com")
+	tokenC := RegisterAndLogin(t, userHandler, "carol", "carol@test.com")
+
+	var meB map[string]any
+	json.Unmarshal(do(tokenB, "GET", "/users/me", nil).Body.Bytes(), &meB)
+
+	// alice creates the chat and is its admin
+	w := do(tokenA, "POST", "/chats", map[string]any{"name": "team", "partner_email": "bob@test.com"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var chat map[string]string
+	json.Unmarshal(w.Body.Bytes(), &chat)
+	chatID := chat["chat_id"]
+	pins := "/chats/" + chatID + "/pins"
+
+	var chatUUID, bobUUID pgtype.UUID
+	chatUUID.Scan(chatID)
+	bobUUID.Scan(meB["id"].(string))
+	send := func(t *testing.T, content string) string {
+		msg, err := repo.CreateMessage(t.Context(), pgdb.CreateMessageParams{
+			ChatID:   chatUUID,
+			SenderID: bobUUID,
+			Content:  content,
+			Kind:     "text",
+		})
+		require.NoError(t, err)
+		return msg.ID.String()
+	}
+	first := send(t, "first")
+
+	listPinned := func(t *testing.T) []handler.PinnedMessageResponse {
+		w := do(tokenB, "GET", pins, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp []handler.PinnedMessageResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	t.Run("Admins pin", func(t *testing.T) {
+		w := do(tokenB, "POST", pins, map[string]string{"message_id": first})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = do(tokenA, "POST", pins, map[string]string{"message_id": first})
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+		pinned := listPinned(t)
+		require.Len(t, pinned, 1)
+		assert.Equal(t, first, pinned[0].ID)
+		assert.Equal(t, "first", pinned[0].Content)
+		assert.Equal(t, "bob", pinned[0].SenderUsername)
+
+		w = do(tokenA, "POST", pins, map[string]string{"message_id": first})
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("System message", func(t *testing.T) {
+		require.Len(t, notices, 1)
+		assert.Equal(t, service.MessagePinned, notices[0].Kind)
+		assert.Equal(t, first, notices[0].Content)
+
+		w := do(tokenB, "GET", "/chats/"+chatID+"/messages", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var history []pgdb.ListMessagesRow
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+		require.Len(t, history, 2)
+		assert.Equal(t, service.MessagePinned, history[0].Kind)
+		assert.Equal(t, "alice", history[0].SenderUsername.String)
+
+		// a pin notice is not pinnable itself
+		w = do(tokenA, "POST", pins, map[string]string{"message_id": history[0].ID.String()})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Members where allowed", func(t *testing.T) {
+		w := do(tokenB, "PATCH", "/chats/"+chatID, map[string]bool{"members_can_pin": true})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = do(tokenA, "PATCH", "/chats/"+chatID, map[string]bool{"members_can_pin": true})
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp handler.ChatResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.True(t, resp.MembersCanPin)
+
+		second := send(t, "second")
+		w = do(tokenB, "POST", pins, map[string]string{"message_id": second})
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, second, listPinned(t)[0].ID, "the latest pin first")
+	})
+
+	t.Run("Outsiders", func(t *testing.T) {
+		w := do(tokenC, "GET", pins, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = do(tokenC, "POST", pins, map[string]string{"message_id": first})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = do(tokenA, "POST", pins, map[string]string{"message_id": "00000000-0000-0000-0000-000000000000"})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		for i := len(listPinned(t)); i < 20; i++ {
+			w := do(tokenA, "POST", pins, map[string]string{"message_id": send(t, fmt.Sprint(i))})
+			require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+		}
+		w := do(tokenA, "POST", pins, map[string]string{"message_id": send(t, "one too many")})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Unpin", func(t *testing.T) {
+		w := do(tokenA, "DELETE", pins+"/"+first, nil)
+		require.Equal(t, http.StatusNoContent, w.Code)
+		assert.Len(t, listPinned(t), 19)
+
+		last := notices[len(notices)-1]
+		assert.Equal(t, service.MessageUnpinned, last.Kind)
+		assert.Equal(t, first, last.Content)
+
+		w = do(tokenA, "DELETE", pins+"/"+first, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Concurrent Limit", func(t *testing.T) {
+		// one slot left, several pins at once
+		messages := make([]string, 5)
+		for i := range messages {
+			messages[i] = send(t, fmt.Sprint("race ", i))
+		}
+
+		codes := make([]int, len(messages))
+		var wg sync.WaitGroup
+		for i, id := range messages {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes[i] = do(tokenA, "POST", pins, map[string]string{"message_id": id}).Code
+			}()
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, code := range codes {
+			if code == http.StatusNoContent {
+				succeeded++
+			} else {
+				assert.Equal(t, http.StatusBadRequest, code)
+			}
+		}
+		assert.Equal(t, 1, succeeded)
+		assert.Len(t, listPinned(t), 20)
+	})
+}
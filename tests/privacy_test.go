@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrivacySettings(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	rdb := SetupTestRedis(t)
+	defer rdb.Close()
+	repo := pgdb.New(pool)
+
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, rdb, nil)
+	contactService := service.NewContactService(repo, pool)
+	contactHandler := handler.NewContactHandler(contactService, rdb)
+
+	r := chi.NewRouter()
+	r.Use(userHandler.AuthMiddleware)
+	r.Get("/users/me", userHandler.GetMe)
+	r.Get("/users/me/privacy", userHandler.GetPrivacy)
+	r.Patch("/users/me/privacy", userHandler.UpdatePrivacy)
+	r.Get("/users/{user_id}/status", userHandler.GetOnlineStatus)
+	r.Get("/contacts", contactHandler.ListContacts)
+
+	do := func(token, method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	meID := func(token string) string {
+		var me map[string]any
+		json.Unmarshal(do(token, "GET", "/users/me", nil).Body.Bytes(), &me)
+		return me["id"].(string)
+	}
+
+	status := func(t *testing.T, token, userID string) map[string]any {
+		w := do(token, "GET", "/users/"+userID+"/status", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	alice := RegisterAndLogin(t, userHandler, "Alice", "alice@example.com")
+	bob := RegisterAndLogin(t, userHandler, "Bob", "bob@example.com")
+	stranger := RegisterAndLogin(t, userHandler, "Eve", "eve@example.com")
+	aliceID, bobID := meID(alice), meID(bob)
+
+	_, err := contactService.SendRequest(t.Context(), aliceID, bobID)
+	require.NoError(t, err)
+	require.NoError(t, contactService.AcceptRequest(t.Context(), bobID, aliceID))
+
+	t.Run("Settings", func(t *testing.T) {
+		var settings handler.PrivacySettingsResponse
+		require.NoError(t, json.Unmarshal(do(alice, "GET", "/users/me/privacy", nil).Body.Bytes(), &settings))
+		assert.Equal(t, handler.PrivacySettingsResponse{Online: "everyone", LastSeen: "everyone", ReadReceipts: "everyone"}, settings)
+
+		w := do(alice, "PATCH", "/users/me/privacy", map[string]string{"online": "contacts", "read_receipts": "nobody"})
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &settings))
+		assert.Equal(t, handler.PrivacySettingsResponse{Online: "contacts", LastSeen: "everyone", ReadReceipts: "nobody"}, settings)
+
+		assert.Equal(t, http.StatusBadRequest, do(alice, "PATCH", "/users/me/privacy", map[string]string{"last_seen": "friends"}).Code)
+	})
+
+	t.Run("Online", func(t *testing.T) {
+		rdb.Set(t.Context(), "user:"+aliceID+":online", "true", 0)
+
+		assert.Equal(t, true, status(t, bob, aliceID)["online"])
+		assert.Equal(t, false, status(t, stranger, aliceID)["online"])
+		assert.Equal(t, true, status(t, alice, aliceID)["online"])
+
+		do(alice, "PATCH", "/users/me/privacy", map[string]string{"online": "nobody"})
+		assert.Equal(t, false, status(t, bob, aliceID)["online"])
+
+		var contacts []handler.ContactResponse
+		require.NoError(t, json.Unmarshal(do(bob, "GET", "/contacts", nil).Body.Bytes(), &contacts))
+		require.Len(t, contacts, 1)
+		assert.Nil(t, contacts[0].Online)
+	})
+
+	t.Run("Last Seen", func(t *testing.T) {
+		rdb.Del(t.Context(), "user:"+aliceID+":online")
+		var aliceUUID pgtype.UUID
+		require.NoError(t, aliceUUID.Scan(aliceID))
+		require.NoError(t, repo.UpdateLastSeen(t.Context(), aliceUUID))
+
+		assert.NotEmpty(t, status(t, stranger, aliceID)["last_seen"])
+
+		do(alice, "PATCH", "/users/me/privacy", map[string]string{"last_seen": "contacts"})
+		assert.NotContains(t, status(t, stranger, aliceID), "last_seen")
+		assert.NotEmpty(t, status(t, bob, aliceID)["last_seen"])
+	})
+
+	t.Run("Read Receipts", func(t *testing.T) {
+		chat, err := service.NewChatService(repo, pool).CreateChat(t.Context(), "Team", aliceID, []string{bobID, meID(stranger)})
+		require.NoError(t, err)
+
+		recipients := func(t *testing.T) []string {
+			var readerUUID pgtype.UUID
+			require.NoError(t, readerUUID.Scan(aliceID))
+			ids, err := repo.ListReadReceiptRecipients(t.Context(), pgdb.ListReadReceiptRecipientsParams{
+				ReaderID: readerUUID,
+				ChatID:   chat.ID,
+			})
+			require.NoError(t, err)
+
+			var result []string
+			for _, id := range ids {
+				result = append(result, id.String())
+			}
+			return result
+		}
+
+		// nobody, from the settings above - only the reader hears of it
+		assert.ElementsMatch(t, []string{aliceID}, recipients(t))
+
+		do(alice, "PATCH", "/users/me/privacy", map[string]string{"read_receipts": "contacts"})
+		assert.ElementsMatch(t, []string{aliceID, bobID}, recipients(t))
+
+		do(alice, "PATCH", "/users/me/privacy", map[string]string{"read_receipts": "everyone"})
+		assert.ElementsMatch(t, []string{aliceID, bobID, meID(stranger)}, recipients(t))
+	})
+
+	t.Run("Unknown User", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, do(bob, "GET", "/users/00000000-0000-0000-0000-000000000000/status", nil).Code)
+	})
+}
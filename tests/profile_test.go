@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfile(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	repo := pgdb.New(pool)
+
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, nil, nil)
+
+	r := chi.NewRouter()
+	r.Use(userHandler.AuthMiddleware)
+	r.Get("/users/me", userHandler.GetMe)
+	r.Patch("/users/me", userHandler.UpdateMe)
+	r.Get("/users/{user_id}", userHandler.GetProfile)
+
+	aliceToken := RegisterAndLogin(t, userHandler, "Alice", "alice@example.com")
+	bobToken := RegisterAndLogin(t, userHandler, "Bob", "bob@example.com")
+
+	do := func(token, method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	decode := func(t *testing.T, w *httptest.ResponseRecorder) map[string]any {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	aliceID := decode(t, do(aliceToken, "GET", "/users/me", nil))["id"].(string)
+
+	t.Run("Update", func(t *testing.T) {
+		me := decode(t, do(aliceToken, "PATCH", "/users/me", map[string]any{
+			"display_name":      "  Alice Liddell ",
+			"bio":               "Curiouser and curiouser",
+			"status_text":       "down the rabbit hole",
+			"status_expires_at": time.Now().Add(time.Hour).Format(time.RFC3339),
+		}))
+		assert.Equal(t, "Alice Liddell", me["display_name"])
+		assert.Equal(t, "down the rabbit hole", me["status_text"])
+		assert.NotEmpty(t, me["status_expires_at"])
+		assert.Equal(t, "alice@example.com", me["email"])
+
+		// absent fields stay, "" clears
+		me = decode(t, do(aliceToken, "PATCH", "/users/me", map[string]any{"bio": ""}))
+		assert.Equal(t, "Alice Liddell", me["display_name"])
+		assert.Equal(t, "", me["bio"])
+		assert.Equal(t, "down the rabbit hole", me["status_text"])
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		invalid := map[string]map[string]any{
+			"long name":        {"display_name": string(bytes.Repeat([]byte("a"), 65))},
+			"past expiry":      {"status_text": "away", "status_expires_at": time.Now().Add(-time.Minute).Format(time.RFC3339)},
+			"expiry no status": {"status_expires_at": time.Now().Add(time.Hour).Format(time.RFC3339)},
+		}
+		for name, body := range invalid {
+			assert.Equal(t, http.StatusBadRequest, do(aliceToken, "PATCH", "/users/me", body).Code, name)
+		}
+	})
+
+	t.Run("Public View", func(t *testing.T) {
+		w := do(bobToken, "GET", "/users/"+aliceID, nil)
+		profile := decode(t, w)
+		assert.Equal(t, "Alice", profile["username"])
+		assert.Equal(t, "Alice Liddell", profile["display_name"])
+		assert.Equal(t, "down the rabbit hole", profile["status_text"])
+		assert.NotContains(t, profile, "email")
+		assert.NotContains(t, w.Body.String(), "alice@example.com")
+	})
+
+	t.Run("Expired Status Is Hidden", func(t *testing.T) {
+		_, err := pool.Exec(t.Context(),
+			"UPDATE users SET status_expires_at = NOW() - INTERVAL '1 minute' WHERE username = 'Alice'")
+		require.NoError(t, err)
+
+		profile := decode(t, do(bobToken, "GET", "/users/"+aliceID, nil))
+		assert.NotContains(t, profile, "status_text")
+		assert.NotContains(t, profile, "status_expires_at")
+	})
+
+	t.Run("Unknown User", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, do(bobToken, "GET", "/users/00000000-0000-0000-0000-000000000000", nil).Code)
+		assert.Equal(t, http.StatusNotFound, do(bobToken, "GET", "/users/not-a-uuid", nil).Code)
+	})
+}
+
+func TestUserSearch(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	repo := pgdb.New(pool)
+
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, nil, nil)
+	contactService := service.NewContactService(repo, pool)
+
+	r := chi.NewRouter()
+	r.Use(userHandler.AuthMiddleware)
+	r.Get("/users/me", userHandler.GetMe)
+	r.Patch("/users/me", userHandler.UpdateMe)
+	r.Get("/users/search", userHandler.SearchUsers)
+
+	do := func(token, method, path string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	search := func(t *testing.T, token, query string) []handler.UserSearchResult {
+		w := do(token, "GET", "/users/search?"+query, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var results []handler.UserSearchResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+		return results
+	}
+
+	usernames := func(results []handler.UserSearchResult) []string {
+		names := make([]string, 0, len(results))
+		for _, result := range results {
+			names = append(names, result.Username)
+		}
+		return names
+	}
+
+	meID := func(token string) string {
+		var me map[string]any
+		json.Unmarshal(do(token, "GET", "/users/me", nil).Body.Bytes(), &me)
+		return me["id"].(string)
+	}
+
+	aliceToken := RegisterAndLogin(t, userHandler, "alice", "alice@example.com")
+	marthaToken := RegisterAndLogin(t, userHandler, "martha", "martha@example.com")
+	RegisterAndLogin(t, userHandler, "marty", "marty@example.com")
+	mark := RegisterAndLogin(t, userHandler, "mark_1", "mark@example.com")
+	RegisterAndLogin(t, userHandler, "bob", "bob@example.com")
+
+	do(mark, "PATCH", "/users/me", map[string]any{"display_name": "Marcus Aurelius"})
+
+	t.Run("Prefix And Display Name", func(t *testing.T) {
+		assert.ElementsMatch(t, []string{"martha", "marty", "mark_1"}, usernames(search(t, aliceToken, "q=mar")))
+		assert.NotContains(t, usernames(search(t, aliceToken, "q=mar")), "alice")
+
+		// prefix matches come before fuzzy ones
+		assert.Equal(t, "mark_1", search(t, aliceToken, "q=Marcus")[0].Username)
+		// "_" is a literal, not a wildcard
+		assert.Equal(t, "mark_1", search(t, aliceToken, "q=mark_")[0].Username)
+	})
+
+	t.Run("Fuzzy", func(t *testing.T) {
+		assert.Contains(t, usernames(search(t, aliceToken, "q=marthe")), "martha")
+	})
+
+	t.Run("Contacts First", func(t *testing.T) {
+		_, err := contactService.SendRequest(t.Context(), meID(aliceToken), meID(marthaToken))
+		require.NoError(t, err)
+		require.NoError(t, contactService.AcceptRequest(t.Context(), meID(marthaToken), meID(aliceToken)))
+
+		results := search(t, aliceToken, "q=mar")
+		require.NotEmpty(t, results)
+		assert.Equal(t, "martha", results[0].Username)
+		assert.True(t, results[0].IsContact)
+		assert.False(t, results[1].IsContact)
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		first := search(t, aliceToken, "q=mar&limit=2")
+		second := search(t, aliceToken, "q=mar&limit=2&offset=2")
+		assert.Len(t, first, 2)
+		assert.Len(t, second, 1)
+		assert.NotContains(t, usernames(first), second[0].Username)
+
+		// past the last page, not wrapped around in int32
+		assert.Empty(t, search(t, aliceToken, "q=mar&limit=2&offset=2147483648"))
+		assert.Empty(t, search(t, aliceToken, "q=mar&limit=2&offset=4294967298"))
+	})
+
+	t.Run("Not Discoverable", func(t *testing.T) {
+		do(marthaToken, "PATCH", "/users/me", map[string]any{"discoverable": false})
+
+		bob := RegisterAndLogin(t, userHandler, "bobby", "bobby@example.com")
+		assert.NotContains(t, usernames(search(t, bob, "q=martha")), "martha")
+		// still found by contacts
+		assert.Contains(t, usernames(search(t, aliceToken, "q=martha")), "martha")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, do(aliceToken, "GET", "/users/search?q=+", nil).Code)
+	})
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	rate, err := service.ParseRate("10/1m")
+	require.NoError(t, err)
+	assert.Equal(t, service.Rate{Limit: 10, Window: time.Minute}, rate)
+
+	for _, bad := range []string{"", "10", "0/1m", "-1/1m", "ten/1m", "10/", "10/0s", "10/soon"} {
+		_, err := service.ParseRate(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	rdb := SetupTestRedis(t)
+	defer rdb.Close()
+
+	limited := handler.RateLimit(service.NewRateLimiter(rdb), "test", service.Rate{Limit: 3, Window: time.Minute})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	request := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/users/login", nil)
+		req.RemoteAddr = ip + ":40000"
+		w := httptest.NewRecorder()
+		limited.ServeHTTP(w, req)
+		return w
+	}
+
+	for range 3 {
+		assert.Equal(t, http.StatusOK, request("10.0.0.1").Code)
+	}
+
+	w := request("10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// other clients have their own window
+	assert.Equal(t, http.StatusOK, request("10.0.0.2").Code)
+}
+
+func TestLoginGuard(t *testing.T) {
+	rdb := SetupTestRedis(t)
+	defer rdb.Close()
+	ctx := context.Background()
+
+	guard := service.NewLoginGuard(rdb, 3, time.Minute, 3*time.Minute)
+
+	for range 2 {
+		locked, err := guard.Fail(ctx, "Victim@example.com")
+		require.NoError(t, err)
+		assert.Zero(t, locked)
+	}
+
+	// the third failure locks, every further one doubles up to the max
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		locked, err := guard.Fail(ctx, "victim@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, want, locked)
+	}
+
+	remaining, err := guard.Check(ctx, "victim@example.com")
+	require.NoError(t, err)
+	assert.Greater(t, remaining, 2*time.Minute)
+
+	// a success ends the streak, the lock itself runs out on its own
+	require.NoError(t, guard.Succeed(ctx, "victim@example.com"))
+	locked, err := guard.Fail(ctx, "victim@example.com")
+	require.NoError(t, err)
+	assert.Zero(t, locked)
+
+	remaining, err = guard.Check(ctx, "someone-else@example.com")
+	require.NoError(t, err)
+	assert.Zero(t, remaining)
+}
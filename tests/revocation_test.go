@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevocationMatches(t *testing.T) {
+	issuedAt := time.Now()
+	claims := service.AccessClaims{
+		UserID:    "user-1",
+		SessionID: "session-1",
+		TokenID:   "token-1",
+		IssuedAt:  issuedAt,
+		ExpiresAt: issuedAt.Add(15 * time.Minute),
+	}
+
+	tests := []struct {
+		name string
+		rev  service.Revocation
+		want bool
+	}{
+		{"Same Token", service.Revocation{UserID: "user-1", TokenID: "token-1"}, true},
+		{"Other Token", service.Revocation{UserID: "user-1", TokenID: "token-2"}, false},
+		{"Same Session", service.Revocation{UserID: "user-1", SessionID: "session-1"}, true},
+		{"Other Session", service.Revocation{UserID: "user-1", SessionID: "session-2"}, false},
+		{"Issued Before", service.Revocation{UserID: "user-1", Before: issuedAt.UnixMilli() + 1}, true},
+		{"Issued After", service.Revocation{UserID: "user-1", Before: issuedAt.UnixMilli()}, false},
+		{"Other User", service.Revocation{UserID: "user-2", SessionID: "session-1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.rev.Matches(claims))
+		})
+	}
+}
+
+func TestAuthMiddleware_Revocation(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	rdb := SetupTestRedis(t)
+	defer rdb.Close()
+	repo := pgdb.New(pool)
+
+	userService := service.NewUserService(repo, secret_token)
+	userService.SetRevocations(service.NewRevocationService(rdb, config.Auth{AccessTTL: 15 * time.Minute}))
+	userHandler := handler.NewUserHandler(userService, rdb, nil)
+
+	r := chi.NewRouter()
+	r.Post("/users/login", userHandler.Login)
+	r.Post("/auth/logout", userHandler.Logout)
+	r.Group(func(r chi.Router) {
+		r.Use(userHandler.AuthMiddleware)
+		r.Get("/users/me/sessions", userHandler.ListSessions)
+		r.Delete("/users/me/sessions/{session_id}", userHandler.DeleteSession)
+	})
+
+	RegisterAndLogin(t, userHandler, "Revoked", "revoked@example.com")
+	user, err := repo.GetUserByEmail(t.Context(), "revoked@example.com")
+	require.NoError(t, err)
+
+	login := func(t *testing.T) handler.LoginResponse {
+		body, _ := json.Marshal(map[string]string{"email": "revoked@example.com", "password": "password123"})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/users/login", bytes.NewBuffer(body)))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp handler.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	do := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("Logout", func(t *testing.T) {
+		session := login(t)
+		require.Equal(t, http.StatusOK, do("GET", "/users/me/sessions", session.Token))
+
+		body, _ := json.Marshal(map[string]string{"refresh_token": session.RefreshToken})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/auth/logout", bytes.NewBuffer(body)))
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/users/me/sessions", session.Token))
+	})
+
+	t.Run("Delete Session", func(t *testing.T) {
+		phone := login(t)
+		laptop := login(t)
+
+		require.Equal(t, http.StatusNoContent, do("DELETE", "/users/me/sessions/"+laptop.SessionID, phone.Token))
+
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/users/me/sessions", laptop.Token))
+		assert.Equal(t, http.StatusOK, do("GET", "/users/me/sessions", phone.Token))
+	})
+
+	t.Run("Revoke All Tokens", func(t *testing.T) {
+		session := login(t)
+		// a day-long token from before sessions existed
+		legacy, err := userService.Keys().Sign(jwt.MapClaims{
+			"user_id": user.ID.String(),
+			"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, do("GET", "/users/me/sessions", legacy))
+
+		require.NoError(t, userService.RevokeAllTokens(t.Context(), user.ID))
+
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/users/me/sessions", session.Token))
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/users/me/sessions", legacy))
+
+		// and stays revoked for as long as the legacy token lives
+		ttl, err := rdb.TTL(t.Context(), "user:"+user.ID.String()+":tokens_valid_after").Result()
+		require.NoError(t, err)
+		assert.Greater(t, ttl, 23*time.Hour)
+
+		assert.Equal(t, http.StatusOK, do("GET", "/users/me/sessions", login(t).Token))
+	})
+
+	t.Run("Redis Down", func(t *testing.T) {
+		down := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+		defer down.Close()
+
+		downService := service.NewUserService(repo, secret_token)
+		downService.SetRevocations(service.NewRevocationService(down, config.Auth{AccessTTL: 15 * time.Minute}))
+		protected := handler.NewUserHandler(downService, down, nil).AuthMiddleware(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}),
+		)
+
+		req := httptest.NewRequest("GET", "/users/me/sessions", nil)
+		req.Header.Set("Authorization", "Bearer "+login(t).Token)
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
@@ -0,0 +1,253 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd - speaks enough of the clamd protocol to answer INSTREAM.
+// Streams larger than maxSize are refused like clamd's StreamMaxLength does.
+func fakeClamd(t *testing.T, maxSize int) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn, maxSize)
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func serveClamd(conn net.Conn, maxSize int) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	command, err := r.ReadString(0)
+	if err != nil || command != "zINSTREAM\x00" {
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var content bytes.Buffer
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		if content.Len()+int(size) > maxSize {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+		if _, err := io.CopyN(&content, r, int64(size)); err != nil {
+			return
+		}
+	}
+
+	if bytes.Contains(content.Bytes(), []byte(eicar)) {
+		conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		return
+	}
+	conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestClamAVScanner(t *testing.T) {
+	address := fakeClamd(t, 1<<20)
+	scanner := service.NewClamAVScanner(address, 5*time.Second)
+
+	tests := []struct {
+		name          string
+		content       string
+		wantInfected  bool
+		wantSignature string
+	}{
+		{name: "Clean", content: "hello, world"},
+		{name: "Empty", content: ""},
+		{name: "Clean Many Chunks", content: strings.Repeat("a", 200<<10)},
+		{name: "Infected", content: eicar, wantInfected: true, wantSignature: "Eicar-Test-Signature"},
+		{name: "Infected Inside", content: "prefix " + eicar + " suffix", wantInfected: true, wantSignature: "Eicar-Test-Signature"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := scanner.Scan(context.Background(), strings.NewReader(tt.content))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantInfected, result.Infected)
+			assert.Equal(t, tt.wantSignature, result.Signature)
+		})
+	}
+}
+
+func TestClamAVScanner_FailCases(t *testing.T) {
+	t.Run("Size Limit", func(t *testing.T) {
+		scanner := service.NewClamAVScanner(fakeClamd(t, 1024), 5*time.Second)
+
+		_, err := scanner.Scan(context.Background(), strings.NewReader(strings.Repeat("a", 4096)))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "size limit exceeded")
+	})
+
+	t.Run("Daemon Down", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		address := ln.Addr().String()
+		ln.Close()
+
+		scanner := service.NewClamAVScanner(address, time.Second)
+		_, err = scanner.Scan(context.Background(), strings.NewReader("hello"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Daemon Hangs", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { ln.Close() })
+
+		// accepts and never answers
+		go func() {
+			conn, err := ln.Accept()
+			if err == nil {
+				t.Cleanup(func() { conn.Close() })
+				io.Copy(io.Discard, conn)
+			}
+		}()
+
+		scanner := service.NewClamAVScanner(ln.Addr().String(), 200*time.Millisecond)
+		_, err = scanner.Scan(context.Background(), strings.NewReader("hello"))
+		assert.Error(t, err)
+	})
+}
+
+func TestScanService_Avatar(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	repo := pgdb.New(pool)
+	ctx := t.Context()
+
+	fileService := service.NewFileService(nil, "images", "localhost:9000", repo, pool, 1<<20)
+	scanService := service.NewScanService(repo, fileService, nil, config.Scanner{Timeout: time.Second, Interval: time.Minute})
+	fileService.SetScanQueue(scanService)
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, nil, fileService)
+
+	RegisterAndLogin(t, userHandler, "Painter", "painter@example.com")
+	user, err := repo.GetUserByEmail(ctx, "painter@example.com")
+	require.NoError(t, err)
+
+	sum := sha256.Sum256([]byte(rand.Text()))
+	avatar, err := fileService.SaveFile(ctx, repo, service.NewFile{
+		OwnerID: user.ID, Sha256: hex.EncodeToString(sum[:]),
+		ObjectKey: "avatar.png", FileName: "avatar.png", ContentType: "image/png", Size: 10,
+	})
+	require.NoError(t, err)
+	require.Equal(t, service.ScanPending, avatar.ScanStatus)
+
+	url := fileService.PublicURL(avatar.ObjectKey)
+	require.NoError(t, userService.UpdateAvatar(ctx, user.ID, url, avatar.ID))
+	user, err = repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.False(t, user.AvatarUrl.Valid, "an unscanned avatar is served")
+
+	// the same content was judged clean before, so no object has to be read
+	_, err = repo.CreateFile(ctx, pgdb.CreateFileParams{
+		OwnerID: user.ID, ObjectKey: avatar.ObjectKey, FileName: "copy.png", ContentType: "image/png",
+		Size: 10, Sha256: avatar.Sha256, ScanStatus: service.ScanClean,
+	})
+	require.NoError(t, err)
+	require.NoError(t, scanService.ScanFile(ctx, avatar))
+
+	user, err = repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, url, user.AvatarUrl.String)
+}
+
+// failingScanner - a scanner that is always down
+type failingScanner struct{}
+
+func (failingScanner) Scan(context.Context, io.Reader) (*service.ScanResult, error) {
+	return nil, errors.New("clamd is down")
+}
+
+func TestScanService_GivesUp(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	repo := pgdb.New(pool)
+	ctx := t.Context()
+
+	// objects are only fetched when read, and the scanner reads nothing
+	client, err := minio.New("127.0.0.1:1", &minio.Options{})
+	require.NoError(t, err)
+	fileService := service.NewFileService(client, "images", "127.0.0.1:1", repo, pool, 1<<20)
+	scanService := service.NewScanService(repo, fileService, failingScanner{}, config.Scanner{Timeout: time.Second, Interval: time.Minute})
+	fileService.SetScanQueue(scanService)
+	userHandler := handler.NewUserHandler(service.NewUserService(repo, secret_token), nil, fileService)
+
+	RegisterAndLogin(t, userHandler, "Unlucky", "unlucky@example.com")
+	user, err := repo.GetUserByEmail(ctx, "unlucky@example.com")
+	require.NoError(t, err)
+
+	sum := sha256.Sum256([]byte(rand.Text()))
+	newFile := service.NewFile{
+		OwnerID: user.ID, Sha256: hex.EncodeToString(sum[:]),
+		ObjectKey: "doc.bin", FileName: "doc.bin", ContentType: "application/octet-stream", Size: 10,
+	}
+	file, err := fileService.SaveFile(ctx, repo, newFile)
+	require.NoError(t, err)
+
+	for attempt := int32(1); ; attempt++ {
+		require.Error(t, scanService.ScanFile(ctx, file))
+
+		stored, err := repo.GetFileByID(ctx, file.ID)
+		require.NoError(t, err)
+		require.Equal(t, attempt, stored.ScanAttempts)
+		if stored.ScanStatus == service.ScanFailed {
+			break
+		}
+		require.Equal(t, service.ScanPending, stored.ScanStatus)
+		require.Less(t, attempt, int32(10), "never given up on")
+	}
+
+	// out of the pending batch, and not a verdict for the same content
+	pending, err := repo.ListPendingFiles(ctx, 100)
+	require.NoError(t, err)
+	for _, p := range pending {
+		assert.NotEqual(t, file.ID, p.ID)
+	}
+
+	again, err := fileService.SaveFile(ctx, repo, newFile)
+	require.NoError(t, err)
+	assert.Equal(t, service.ScanPending, again.ScanStatus)
+}
@@ -21,7 +21,7 @@ func TestChatAccessDenied(t *testing.T) {
 	repo := pgdb.New(pool)
 
 	userService := service.NewUserService(repo, secret_token)
-	userHandler := handler.NewUserHandler(userService, secret_token, nil, nil)
+	userHandler := handler.NewUserHandler(userService, nil, nil)
 	chatService := service.NewChatService(repo, pool)
 	chatHandler := handler.NewChatHandler(chatService, userService)
 
@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	repo := pgdb.New(pool)
+
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, nil, nil)
+
+	r := chi.NewRouter()
+	r.Post("/users/login", userHandler.Login)
+	r.Post("/auth/refresh", userHandler.Refresh)
+	r.Post("/auth/logout", userHandler.Logout)
+	r.Group(func(r chi.Router) {
+		r.Use(userHandler.AuthMiddleware)
+		r.Get("/users/me/sessions", userHandler.ListSessions)
+		r.Delete("/users/me/sessions", userHandler.DeleteOtherSessions)
+		r.Delete("/users/me/sessions/{session_id}", userHandler.DeleteSession)
+	})
+
+	RegisterAndLogin(t, userHandler, "Roamer", "roamer@example.com")
+
+	login := func(t *testing.T, userAgent string) handler.LoginResponse {
+		body, _ := json.Marshal(map[string]string{"email": "roamer@example.com", "password": "password123"})
+		req := httptest.NewRequest("POST", "/users/login", bytes.NewBuffer(body))
+		req.Header.Set("User-Agent", userAgent)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp handler.LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotEmpty(t, resp.RefreshToken)
+		return resp
+	}
+
+	refresh := func(refreshToken string) (*httptest.ResponseRecorder, handler.LoginResponse) {
+		body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/auth/refresh", bytes.NewBuffer(body)))
+
+		var resp handler.LoginResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	listSessions := func(t *testing.T, accessToken string) []handler.SessionResponse {
+		req := httptest.NewRequest("GET", "/users/me/sessions", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp []handler.SessionResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	t.Run("Rotation", func(t *testing.T) {
+		first := login(t, "phone")
+
+		w, second := refresh(first.RefreshToken)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+		assert.Equal(t, first.SessionID, second.SessionID)
+
+		w, _ = refresh(second.RefreshToken)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Reuse Revokes Session", func(t *testing.T) {
+		stolen := login(t, "laptop")
+
+		w, rotated := refresh(stolen.RefreshToken)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// the attacker replays the old token
+		w, _ = refresh(stolen.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// and the legitimate holder is logged out as well
+		w, _ = refresh(rotated.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Unknown Token", func(t *testing.T) {
+		w, _ := refresh("not-a-token")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Logout", func(t *testing.T) {
+		session := login(t, "tablet")
+
+		body, _ := json.Marshal(map[string]string{"refresh_token": session.RefreshToken})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/auth/logout", bytes.NewBuffer(body)))
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		w, _ = refresh(session.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("List And Revoke", func(t *testing.T) {
+		current := login(t, "desktop")
+		other := login(t, "watch")
+
+		sessions := listSessions(t, current.Token)
+		var currentFound bool
+		for _, s := range sessions {
+			if s.ID == current.SessionID {
+				currentFound = true
+				assert.True(t, s.Current)
+				assert.Equal(t, "desktop", s.UserAgent)
+			} else {
+				assert.False(t, s.Current)
+			}
+		}
+		assert.True(t, currentFound)
+
+		req := httptest.NewRequest("DELETE", "/users/me/sessions/"+other.SessionID, nil)
+		req.Header.Set("Authorization", "Bearer "+current.Token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		w, _ = refresh(other.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		// again - it's gone
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Revoke Others", func(t *testing.T) {
+		current := login(t, "desktop")
+		login(t, "phone")
+
+		req := httptest.NewRequest("DELETE", "/users/me/sessions", nil)
+		req.Header.Set("Authorization", "Bearer "+current.Token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		sessions := listSessions(t, current.Token)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, current.SessionID, sessions[0].ID)
+	})
+}
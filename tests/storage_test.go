@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetStorage(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	repo := pgdb.New(pool)
+
+	fileService := service.NewFileService(nil, "images", "localhost:9000", repo, pool, 1024)
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, nil, fileService)
+
+	r := chi.NewRouter()
+	r.Use(userHandler.AuthMiddleware)
+	r.Get("/users/me/storage", userHandler.GetStorage)
+
+	token := RegisterAndLogin(t, userHandler, "Hoarder", "hoarder@example.com")
+
+	req := httptest.NewRequest("GET", "/users/me/storage", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string]int64
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	assert.Equal(t, int64(0), resp["used_bytes"])
+	assert.Equal(t, int64(1024), resp["quota_bytes"])
+	assert.Equal(t, int64(0), resp["files_count"])
+}
+
+func TestSaveFile(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	repo := pgdb.New(pool)
+	ctx := t.Context()
+
+	s3 := newFakeS3(t, "images")
+	fileService := service.NewFileService(s3.client(t), "images", "localhost:9000", repo, pool, 100)
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, nil, fileService)
+
+	newUser := func(t *testing.T, username string) pgtype.UUID {
+		RegisterAndLogin(t, userHandler, username, username+"@example.com")
+		user, err := repo.GetUserByEmail(ctx, username+"@example.com")
+		require.NoError(t, err)
+		return user.ID
+	}
+
+	newSum := func() string {
+		sum := sha256.Sum256([]byte(rand.Text()))
+		return hex.EncodeToString(sum[:])
+	}
+
+	save := func(owner pgtype.UUID, sum string, size int64) (*pgdb.File, error) {
+		return fileService.SaveFile(ctx, repo, service.NewFile{
+			OwnerID: owner, Sha256: sum, ObjectKey: sum + ".bin",
+			FileName: "file.bin", ContentType: "application/octet-stream", Size: size,
+		})
+	}
+
+	usage := func(t *testing.T, owner pgtype.UUID) *service.StorageUsage {
+		usage, err := fileService.GetUsage(ctx, owner.String())
+		require.NoError(t, err)
+		return usage
+	}
+
+	t.Run("Quota Exceeded", func(t *testing.T) {
+		owner := newUser(t, "Filler")
+
+		_, err := save(owner, newSum(), 60)
+		require.NoError(t, err)
+		_, err = save(owner, newSum(), 40)
+		require.NoError(t, err, "exactly the quota fits")
+
+		rejected := newSum()
+		_, err = save(owner, rejected, 1)
+		assert.ErrorIs(t, err, service.ErrQuotaExceeded)
+
+		got := usage(t, owner)
+		assert.Equal(t, int64(100), got.UsedBytes)
+		assert.Equal(t, int64(2), got.FilesCount)
+
+		_, err = repo.GetBlob(ctx, rejected)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+
+	t.Run("Deduplicated Content", func(t *testing.T) {
+		ann, ben := newUser(t, "Ann"), newUser(t, "Ben")
+		sum := newSum()
+
+		first, err := save(ann, sum, 30)
+		require.NoError(t, err)
+		second, err := fileService.SaveFile(ctx, repo, service.NewFile{
+			OwnerID: ben, Sha256: sum, ObjectKey: "other-upload.bin",
+			FileName: "copy.bin", ContentType: "application/octet-stream", Size: 30,
+		})
+		require.NoError(t, err)
+
+		assert.NotEqual(t, first.ID, second.ID)
+		assert.Equal(t, first.ObjectKey, second.ObjectKey, "the stored object is reused")
+
+		blob, err := repo.GetBlob(ctx, sum)
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), blob.RefCount)
+
+		// one object, but each owner pays for their file
+		assert.Equal(t, int64(30), usage(t, ann).UsedBytes)
+		assert.Equal(t, int64(30), usage(t, ben).UsedBytes)
+	})
+
+	t.Run("Released With The Last File", func(t *testing.T) {
+		cal, dan := newUser(t, "Cal"), newUser(t, "Dan")
+		sum := newSum()
+
+		kept, err := save(cal, sum, 20)
+		require.NoError(t, err)
+		_, err = save(dan, sum, 20)
+		require.NoError(t, err)
+		s3.put(kept.ObjectKey, 20)
+
+		gc := service.NewGarbageCollector(repo, pool, fileService, config.GC{
+			Interval: time.Hour, GracePeriod: -time.Hour,
+		})
+
+		// Dan's copy is unreferenced, Cal's is the avatar
+		require.NoError(t, userService.UpdateAvatar(ctx, cal, fileService.PublicURL(kept.ObjectKey), kept.ID))
+		_, err = gc.Collect(ctx)
+		require.NoError(t, err)
+
+		blob, err := repo.GetBlob(ctx, sum)
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), blob.RefCount)
+		assert.False(t, blob.ReleasedAt.Valid)
+		assert.True(t, s3.has(kept.ObjectKey))
+		assert.Equal(t, int64(0), usage(t, dan).UsedBytes)
+
+		// the last reference goes
+		require.NoError(t, repo.ClearAvatarFile(ctx, kept.ID))
+		_, err = gc.Collect(ctx)
+		require.NoError(t, err)
+
+		_, err = repo.GetBlob(ctx, sum)
+		assert.ErrorIs(t, err, pgx.ErrNoRows)
+		assert.False(t, s3.has(kept.ObjectKey))
+		assert.Equal(t, int64(0), usage(t, cal).UsedBytes)
+	})
+}
@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 6238 appendix B, truncated to six digits
+func TestTOTPCode(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range vectors {
+		code, err := service.TOTPCode(secret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, "at %d", unix)
+	}
+
+	uri := service.TOTPURI("go-messenger", "alice@example.com", secret)
+	assert.Contains(t, uri, "otpauth://totp/go-messenger:alice@example.com?")
+	assert.Contains(t, uri, "secret="+secret)
+}
+
+func TestTwoFactor(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	repo := pgdb.New(pool)
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	userService := service.NewUserService(repo, secret_token)
+	userService.SetClock(func() time.Time { return now })
+	userHandler := handler.NewUserHandler(userService, nil, nil)
+
+	r := chi.NewRouter()
+	r.Post("/users/login", userHandler.Login)
+	r.Post("/users/login/2fa", userHandler.LoginTwoFactor)
+	r.Group(func(r chi.Router) {
+		r.Use(userHandler.AuthMiddleware)
+		r.Get("/users/me/2fa", userHandler.GetTwoFactor)
+		r.Post("/users/me/2fa/setup", userHandler.SetupTwoFactor)
+		r.Post("/users/me/2fa/confirm", userHandler.ConfirmTwoFactor)
+		r.Post("/users/me/2fa/disable", userHandler.DisableTwoFactor)
+		r.Post("/users/me/2fa/recovery-codes", userHandler.RegenerateRecoveryCodes)
+	})
+
+	token := RegisterAndLogin(t, userHandler, "Careful", "careful@example.com")
+
+	send := func(method, path string, body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(data))
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	login := func(t *testing.T) string {
+		w := send("POST", "/users/login", map[string]string{"email": "careful@example.com", "password": "password123"})
+		require.Equal(t, http.StatusAccepted, w.Code)
+
+		var resp handler.TwoFactorChallengeResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.NotEmpty(t, resp.ChallengeID)
+		return resp.ChallengeID
+	}
+
+	completeLogin := func(challengeID, code string) int {
+		return send("POST", "/users/login/2fa", map[string]string{"challenge_id": challengeID, "code": code}).Code
+	}
+
+	currentCode := func(t *testing.T, secret string) string {
+		code, err := service.TOTPCode(secret, now)
+		require.NoError(t, err)
+		return code
+	}
+
+	// 1. Enrollment
+	w := send("POST", "/users/me/2fa/setup", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var setup handler.TOTPSetupResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &setup))
+	assert.Contains(t, setup.OtpauthURI, "careful@example.com")
+	secret := setup.Secret
+
+	w = send("POST", "/users/me/2fa/confirm", map[string]string{"code": "000000"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = send("POST", "/users/me/2fa/confirm", map[string]string{"code": currentCode(t, secret)})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var recovery handler.RecoveryCodesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &recovery))
+	require.Len(t, recovery.RecoveryCodes, 10)
+
+	w = send("POST", "/users/me/2fa/setup", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	t.Run("TOTP Login", func(t *testing.T) {
+		// the confirmation code can't be used again
+		challenge := login(t)
+		assert.Equal(t, http.StatusUnauthorized, completeLogin(challenge, currentCode(t, secret)))
+
+		now = now.Add(30 * time.Second)
+		assert.Equal(t, http.StatusOK, completeLogin(challenge, currentCode(t, secret)))
+
+		// nor the challenge
+		now = now.Add(30 * time.Second)
+		assert.Equal(t, http.StatusUnauthorized, completeLogin(challenge, currentCode(t, secret)))
+	})
+
+	t.Run("Recovery Code Login", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, completeLogin(login(t), recovery.RecoveryCodes[0]))
+		assert.Equal(t, http.StatusUnauthorized, completeLogin(login(t), recovery.RecoveryCodes[0]))
+
+		w := send("GET", "/users/me/2fa", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var status handler.TwoFactorStatusResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+		assert.True(t, status.Enabled)
+		assert.Equal(t, int64(9), status.RecoveryCodesLeft)
+	})
+
+	t.Run("Challenge Expires", func(t *testing.T) {
+		challenge := login(t)
+		now = now.Add(6 * time.Minute)
+		assert.Equal(t, http.StatusUnauthorized, completeLogin(challenge, currentCode(t, secret)))
+	})
+
+	t.Run("Attempts Are Limited", func(t *testing.T) {
+		now = now.Add(30 * time.Second)
+		challenge := login(t)
+		for range 5 {
+			assert.Equal(t, http.StatusUnauthorized, completeLogin(challenge, "000000"))
+		}
+		assert.Equal(t, http.StatusUnauthorized, completeLogin(challenge, currentCode(t, secret)))
+	})
+
+	t.Run("Regenerate Recovery Codes", func(t *testing.T) {
+		now = now.Add(30 * time.Second)
+		w := send("POST", "/users/me/2fa/recovery-codes", map[string]string{"code": currentCode(t, secret)})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var fresh handler.RecoveryCodesResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fresh))
+		require.Len(t, fresh.RecoveryCodes, 10)
+
+		assert.Equal(t, http.StatusUnauthorized, completeLogin(login(t), recovery.RecoveryCodes[1]))
+		recovery = fresh
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		w := send("POST", "/users/me/2fa/disable", map[string]string{"code": "wrong-code"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = send("POST", "/users/me/2fa/disable", map[string]string{"code": recovery.RecoveryCodes[0]})
+		require.Equal(t, http.StatusNoContent, w.Code)
+
+		w = send("POST", "/users/login", map[string]string{"email": "careful@example.com", "password": "password123"})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
@@ -0,0 +1,263 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpload_FailCases(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	repo := pgdb.New(pool)
+
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, nil, nil)
+
+	uploadService := service.NewUploadService(repo, pool, nil, config.Uploads{
+		MaxSize:  1 << 20,
+		PartSize: 5 << 20,
+	})
+	uploadHandler := handler.NewUploadHandler(uploadService)
+
+	r := chi.NewRouter()
+	r.Options("/uploads", uploadHandler.Options)
+	r.Group(func(r chi.Router) {
+		r.Use(userHandler.AuthMiddleware)
+		r.Post("/uploads", uploadHandler.Create)
+		r.Head("/uploads/{upload_id}", uploadHandler.Head)
+		r.Patch("/uploads/{upload_id}", uploadHandler.Patch)
+		r.Get("/files/{file_id}", uploadHandler.GetFile)
+	})
+
+	token := RegisterAndLogin(t, userHandler, "Uploader", "uploader@example.com")
+
+	t.Run("Discovery", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/uploads", nil))
+
+		require.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "1.0.0", w.Header().Get("Tus-Version"))
+		assert.Equal(t, "1048576", w.Header().Get("Tus-Max-Size"))
+	})
+
+	tests := []struct {
+		name         string
+		length       string
+		version      string
+		expectedCode int
+	}{
+		{name: "Missing Length", length: "", version: "1.0.0", expectedCode: http.StatusBadRequest},
+		{name: "Empty File", length: "0", version: "1.0.0", expectedCode: http.StatusBadRequest},
+		{name: "Too Large", length: "2097152", version: "1.0.0", expectedCode: http.StatusRequestEntityTooLarge},
+		{name: "Wrong Version", length: "100", version: "0.2.2", expectedCode: http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/uploads", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Tus-Resumable", tt.version)
+			req.Header.Set("Upload-Length", tt.length)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code, w.Body.String())
+		})
+	}
+
+	t.Run("Unknown Upload", func(t *testing.T) {
+		req := httptest.NewRequest("HEAD", "/uploads/"+uuid.New().String(), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Patch Wrong Content Type", func(t *testing.T) {
+		req := httptest.NewRequest("PATCH", "/uploads/"+uuid.New().String(), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Upload-Offset", "0")
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+
+	t.Run("Unknown File", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/files/"+uuid.New().String(), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestUpload(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	repo := pgdb.New(pool)
+
+	s3 := newFakeS3(t, "images")
+	fileService := service.NewFileService(s3.client(t), "images", "localhost:9000", repo, pool, 1<<20)
+	userService := service.NewUserService(repo, secret_token)
+	userHandler := handler.NewUserHandler(userService, nil, fileService)
+
+	uploadService := service.NewUploadService(repo, pool, fileService, config.Uploads{
+		MaxSize:  1 << 20,
+		PartSize: 4,
+		TTL:      time.Hour,
+	})
+	uploadHandler := handler.NewUploadHandler(uploadService)
+
+	r := chi.NewRouter()
+	r.Group(func(r chi.Router) {
+		r.Use(userHandler.AuthMiddleware)
+		r.Post("/uploads", uploadHandler.Create)
+		r.Head("/uploads/{upload_id}", uploadHandler.Head)
+		r.Patch("/uploads/{upload_id}", uploadHandler.Patch)
+	})
+
+	token := RegisterAndLogin(t, userHandler, "Uploader", "uploader@example.com")
+
+	send := func(ctx context.Context, method, path string, headers map[string]string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body)).WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	create := func(t *testing.T, size int) string {
+		w := send(t.Context(), "POST", "/uploads", map[string]string{"Upload-Length": strconv.Itoa(size)}, "")
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		return strings.TrimPrefix(w.Header().Get("Location"), "/api")
+	}
+
+	patch := func(ctx context.Context, path string, offset int, chunk string) *httptest.ResponseRecorder {
+		return send(ctx, "PATCH", path, map[string]string{
+			"Upload-Offset": strconv.Itoa(offset),
+			"Content-Type":  "application/offset+octet-stream",
+		}, chunk)
+	}
+
+	getFile := func(t *testing.T, w *httptest.ResponseRecorder) pgdb.File {
+		var fileID pgtype.UUID
+		require.NoError(t, fileID.Scan(w.Header().Get("X-File-Id")))
+		file, err := repo.GetFileByID(t.Context(), fileID)
+		require.NoError(t, err)
+		return file
+	}
+
+	var first pgdb.File
+	content := "upload-" + uuid.New().String()
+
+	t.Run("Aligned Chunks", func(t *testing.T) {
+		path := create(t, len(content))
+		completed, _ := s3.multipart()
+
+		w := patch(t.Context(), path, 0, content[:3])
+		assert.Equal(t, http.StatusBadRequest, w.Code, "a chunk shorter than a part")
+
+		// only whole parts are kept, the rest is sent again
+		w = patch(t.Context(), path, 0, content[:10])
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+		assert.Equal(t, "8", w.Header().Get("Upload-Offset"))
+
+		w = patch(t.Context(), path, 0, content[:8])
+		assert.Equal(t, http.StatusConflict, w.Code, "a stale offset")
+		assert.Equal(t, "8", w.Header().Get("Upload-Offset"))
+
+		w = send(t.Context(), "HEAD", path, nil, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "8", w.Header().Get("Upload-Offset"))
+		assert.Empty(t, w.Header().Get("X-File-Id"))
+
+		w = patch(t.Context(), path, 8, content[8:])
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+		assert.Equal(t, strconv.Itoa(len(content)), w.Header().Get("Upload-Offset"))
+
+		first = getFile(t, w)
+		assert.Equal(t, int64(len(content)), first.Size)
+		assert.True(t, s3.has(first.ObjectKey))
+
+		after, _ := s3.multipart()
+		assert.Equal(t, completed+1, after)
+	})
+
+	t.Run("Retry After Failed Commit", func(t *testing.T) {
+		path := create(t, 8)
+		completed, _ := s3.multipart()
+
+		// the parts are glued, but the request dies before the file is recorded
+		ctx, cancel := context.WithCancel(t.Context())
+		s3.mu.Lock()
+		s3.onComplete = cancel
+		s3.mu.Unlock()
+		defer func() {
+			s3.mu.Lock()
+			s3.onComplete = nil
+			s3.mu.Unlock()
+		}()
+
+		w := patch(ctx, path, 0, uuid.New().String()[:8])
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+
+		w = send(t.Context(), "HEAD", path, nil, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "8", w.Header().Get("Upload-Offset"))
+		assert.Empty(t, w.Header().Get("X-File-Id"))
+
+		w = patch(t.Context(), path, 8, "")
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+		file := getFile(t, w)
+		assert.True(t, s3.has(file.ObjectKey))
+
+		after, _ := s3.multipart()
+		assert.Equal(t, completed+1, after, "the parts are glued only once")
+	})
+
+	t.Run("Duplicate Content", func(t *testing.T) {
+		require.NotEmpty(t, first.ObjectKey)
+		path := create(t, len(content))
+		completed, aborted := s3.multipart()
+
+		w := patch(t.Context(), path, 0, content)
+		require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+
+		file := getFile(t, w)
+		assert.NotEqual(t, first.ID, file.ID)
+		assert.Equal(t, first.ObjectKey, file.ObjectKey, "the stored copy is reused")
+
+		afterCompleted, afterAborted := s3.multipart()
+		assert.Equal(t, completed, afterCompleted)
+		assert.Equal(t, aborted+1, afterAborted)
+	})
+}
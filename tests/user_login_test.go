@@ -21,7 +21,7 @@ func TestLogin(t *testing.T) {
 
 	repo := pgdb.New(pool)
 	userService := service.NewUserService(repo, secret_token)
-	userHandler := handler.NewUserHandler(userService, secret_token, nil, nil)
+	userHandler := handler.NewUserHandler(userService, nil, nil)
 
 	r := chi.NewRouter()
 	r.Post("/register", userHandler.Register)
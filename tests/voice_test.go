@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeWAV - 16 bit PCM, amplitude(t) gives the envelope of a 440 Hz tone
+func makeWAV(sampleRate, channels int, duration time.Duration, amplitude func(t float64) float64) []byte {
+	frames := int(duration.Seconds() * float64(sampleRate))
+
+	var data bytes.Buffer
+	for i := 0; i < frames; i++ {
+		t := float64(i) / float64(sampleRate)
+		v := int16(amplitude(t) * math.Sin(2*math.Pi*440*t) * math.MaxInt16)
+		for ch := 0; ch < channels; ch++ {
+			binary.Write(&data, binary.LittleEndian, v)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+data.Len()))
+	buf.WriteString("WAVE")
+
+	buf.WriteString("fmt ")
+	for _, v := range []any{
+		uint32(16), uint16(1), uint16(channels), uint32(sampleRate),
+		uint32(sampleRate * channels * 2), uint16(channels * 2), uint16(16),
+	} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+
+	// unknown chunks must be skipped
+	buf.WriteString("LIST")
+	binary.Write(&buf, binary.LittleEndian, uint32(3))
+	buf.Write([]byte{1, 2, 3, 0})
+
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(data.Len()))
+	buf.Write(data.Bytes())
+	return buf.Bytes()
+}
+
+// oggPage - CRC is not checked by the analyzer, so it's left zero
+func oggPage(serial uint32, granule int64, body []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("OggS")
+	buf.Write([]byte{0, 0})
+	binary.Write(&buf, binary.LittleEndian, granule)
+	binary.Write(&buf, binary.LittleEndian, serial)
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // sequence
+	binary.Write(&buf, binary.LittleEndian, uint32(0)) // crc
+
+	var segments []byte
+	for n := len(body); ; n -= 255 {
+		if n < 255 {
+			segments = append(segments, byte(n))
+			break
+		}
+		segments = append(segments, 255)
+	}
+	buf.WriteByte(byte(len(segments)))
+	buf.Write(segments)
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func makeOpus(preSkip uint16, lastGranule int64) []byte {
+	head := []byte("OpusHead")
+	head = append(head, 1, 1)
+	head = binary.LittleEndian.AppendUint16(head, preSkip)
+	head = binary.LittleEndian.AppendUint32(head, 48000)
+	head = append(head, 0, 0, 0)
+
+	var buf bytes.Buffer
+	buf.Write(oggPage(7, 0, head))
+	buf.Write(oggPage(7, 0, []byte("OpusTags\x00\x00\x00\x00\x00\x00\x00\x00")))
+	buf.Write(oggPage(7, 48000, make([]byte, 600)))
+	buf.Write(oggPage(7, -1, make([]byte, 100)))    // no packet ends here
+	buf.Write(oggPage(9, 999999, make([]byte, 10))) // another stream
+	buf.Write(oggPage(7, lastGranule, make([]byte, 300)))
+	return buf.Bytes()
+}
+
+func TestAnalyzeAudio_WAV(t *testing.T) {
+	// silent first half, loud second half
+	wav := makeWAV(8000, 2, 1500*time.Millisecond, func(t float64) float64 {
+		if t < 0.75 {
+			return 0
+		}
+		return 0.5
+	})
+
+	info, err := service.AnalyzeAudio(bytes.NewReader(wav))
+	require.NoError(t, err)
+
+	assert.Equal(t, "audio/wav", info.ContentType)
+	assert.Equal(t, 1500*time.Millisecond, info.Duration)
+	require.Len(t, info.Waveform, service.WaveformBars)
+
+	half := service.WaveformBars / 2
+	for i := 0; i < half; i++ {
+		assert.Zero(t, info.Waveform[i], "bar %d", i)
+	}
+	for i := half; i < service.WaveformBars; i++ {
+		assert.Greater(t, info.Waveform[i], byte(240), "bar %d", i)
+	}
+}
+
+func TestAnalyzeAudio_Opus(t *testing.T) {
+	// 3 seconds after the 312 samples of pre-skip
+	info, err := service.AnalyzeAudio(bytes.NewReader(makeOpus(312, 3*48000+312)))
+	require.NoError(t, err)
+
+	assert.Equal(t, "audio/ogg", info.ContentType)
+	assert.Equal(t, 3*time.Second, info.Duration)
+	assert.Nil(t, info.Waveform)
+}
+
+func TestAnalyzeAudio_FailCases(t *testing.T) {
+	wav := makeWAV(8000, 1, time.Second, func(float64) float64 { return 1 })
+
+	// withFormat - the same file claiming other channels, block align and bits
+	withFormat := func(channels, blockAlign, bits uint16) []byte {
+		patched := bytes.Clone(wav)
+		binary.LittleEndian.PutUint16(patched[22:], channels)
+		binary.LittleEndian.PutUint16(patched[32:], blockAlign)
+		binary.LittleEndian.PutUint16(patched[34:], bits)
+		return patched
+	}
+
+	// hours of audio at 1 Hz
+	slow := bytes.Clone(wav)
+	binary.LittleEndian.PutUint32(slow[24:], 1)
+
+	vorbis := oggPage(1, 0, append([]byte("\x01vorbis"), make([]byte, 30)...))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Empty", data: nil},
+		{name: "Not Audio", data: []byte("%PDF-1.7 definitely not audio")},
+		{name: "Not WAVE", data: append([]byte("RIFF\x00\x00\x00\x00AVI "), make([]byte, 32)...)},
+		{name: "Truncated WAV", data: wav[:len(wav)/2]},
+		{name: "Zero Block Align", data: withFormat(4096, 0, 16)},
+		{name: "Wrapped Block Align", data: withFormat(2049, 4, 32)},
+		{name: "Vorbis", data: vorbis},
+		{name: "Truncated Ogg", data: makeOpus(312, 48000)[:50]},
+		{name: "Too Long WAV", data: slow},
+		{name: "Too Long Ogg", data: makeOpus(312, 1<<62)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.AnalyzeAudio(bytes.NewReader(tt.data))
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, service.ErrUnsupportedAudio), err.Error())
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/repo/pgdb"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/Adopten123/go-messenger/internal/ws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+func TestFloodControl(t *testing.T) {
+	limits := ws.Limits{
+		MaxFrameSize:   1024,
+		Message:        service.Rate{Limit: 5, Window: 5 * time.Second},
+		ChatMessage:    service.Rate{Limit: 3, Window: 3 * time.Second},
+		MarkRead:       service.Rate{Limit: 2, Window: time.Second},
+		TypingInterval: 3 * time.Second,
+		MaxViolations:  2,
+	}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	message := func(chatID string) ws.IncomingMessage {
+		return ws.IncomingMessage{Type: ws.EventNewMessage, ChatID: chatID, Content: "hi"}
+	}
+
+	t.Run("Per Chat And Per User", func(t *testing.T) {
+		flood := ws.NewFloodControl(limits, now)
+		for range 3 {
+			verdict, _ := flood.Admit(message("chat-1"), now)
+			assert.Equal(t, ws.Allow, verdict)
+		}
+
+		verdict, retryAfter := flood.Admit(message("chat-1"), now)
+		assert.Equal(t, ws.Reject, verdict)
+		assert.Equal(t, time.Second, retryAfter)
+
+		// the user still has budget for other chats
+		for range 2 {
+			verdict, _ := flood.Admit(message("chat-2"), now)
+			assert.Equal(t, ws.Allow, verdict)
+		}
+		verdict, _ = flood.Admit(message("chat-3"), now)
+		assert.Equal(t, ws.Reject, verdict)
+
+		// and gets it back over time
+		verdict, _ = flood.Admit(message("chat-1"), now.Add(time.Second))
+		assert.Equal(t, ws.Allow, verdict)
+	})
+
+	t.Run("Typing Is Coalesced", func(t *testing.T) {
+		flood := ws.NewFloodControl(limits, now)
+		typing := ws.IncomingMessage{Type: ws.EventTyping, ChatID: "chat-1"}
+
+		verdict, _ := flood.Admit(typing, now)
+		assert.Equal(t, ws.Allow, verdict)
+		for i := range 100 {
+			verdict, _ := flood.Admit(typing, now.Add(time.Duration(i)*10*time.Millisecond))
+			require.Equal(t, ws.Drop, verdict)
+		}
+
+		verdict, _ = flood.Admit(ws.IncomingMessage{Type: ws.EventTyping, ChatID: "chat-2"}, now)
+		assert.Equal(t, ws.Allow, verdict)
+		verdict, _ = flood.Admit(typing, now.Add(3*time.Second))
+		assert.Equal(t, ws.Allow, verdict)
+	})
+
+	t.Run("Abuse Disconnects", func(t *testing.T) {
+		flood := ws.NewFloodControl(limits, now)
+		markRead := ws.IncomingMessage{Type: ws.EventMarkRead, ChatID: "chat-1"}
+
+		verdicts := make([]ws.Verdict, 0, 5)
+		for range 5 {
+			verdict, _ := flood.Admit(markRead, now)
+			verdicts = append(verdicts, verdict)
+		}
+		assert.Equal(t, []ws.Verdict{ws.Allow, ws.Allow, ws.Reject, ws.Reject, ws.Disconnect}, verdicts)
+	})
+}
+
+func TestNewLimits(t *testing.T) {
+	cfg := config.WebSocket{
+		MaxFrameSize:    65536,
+		MaxConnections:  10,
+		MessageRate:     "20/10s",
+		ChatMessageRate: "10/10s",
+		MarkReadRate:    "30/10s",
+		TypingInterval:  3 * time.Second,
+		MaxViolations:   10,
+	}
+	limits, err := ws.NewLimits(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, ws.DefaultLimits, limits)
+
+	cfg.ChatMessageRate = "fast"
+	_, err = ws.NewLimits(cfg)
+	assert.Error(t, err)
+}
+
+func TestFloodControl_PerUser(t *testing.T) {
+	pool := SetupTestDB(t)
+	defer pool.Close()
+	rdb := SetupTestRedis(t)
+	defer rdb.Close()
+
+	hub := ws.NewHub(pgdb.New(pool), rdb)
+	go hub.Run()
+
+	tickets := service.NewTicketService(rdb, nil)
+	wsHandler := ws.NewWSHandler(hub, tickets)
+	wsHandler.SetLimits(ws.Limits{
+		MaxFrameSize:   1024,
+		MaxConnections: 2,
+		Message:        service.Rate{Limit: 5, Window: time.Minute},
+		ChatMessage:    service.Rate{Limit: 5, Window: time.Minute},
+		MarkRead:       service.Rate{Limit: 2, Window: time.Minute},
+		TypingInterval: time.Second,
+		MaxViolations:  10,
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(wsHandler.HandleWS))
+	defer server.Close()
+
+	claims := service.AccessClaims{UserID: "user-" + rand.Text(), IssuedAt: time.Now()}
+	dial := func(t *testing.T) (*websocket.Conn, *http.Response, error) {
+		ticket, err := tickets.Issue(t.Context(), claims)
+		require.NoError(t, err)
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?ticket=" + ticket
+		return websocket.Dial(t.Context(), url, nil)
+	}
+
+	phone, _, err := dial(t)
+	require.NoError(t, err)
+	defer phone.CloseNow()
+	laptop, _, err := dial(t)
+	require.NoError(t, err)
+	defer laptop.CloseNow()
+
+	t.Run("Connection Limit", func(t *testing.T) {
+		_, resp, err := dial(t)
+		require.Error(t, err)
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	})
+
+	t.Run("Devices Share The Budget", func(t *testing.T) {
+		// errors of both connections, until nothing arrives for a while
+		errs := make(chan ws.OutgoingMessage, 4)
+		for _, conn := range []*websocket.Conn{phone, laptop} {
+			go func() {
+				for {
+					var msg ws.OutgoingMessage
+					if err := wsjson.Read(context.Background(), conn, &msg); err != nil {
+						return
+					}
+					if msg.Type == ws.EventError {
+						errs <- msg
+					}
+				}
+			}()
+		}
+
+		markRead := ws.IncomingMessage{Type: ws.EventMarkRead, ChatID: "not-a-chat"}
+		require.NoError(t, wsjson.Write(t.Context(), phone, markRead))
+		require.NoError(t, wsjson.Write(t.Context(), laptop, markRead))
+		require.NoError(t, wsjson.Write(t.Context(), phone, markRead))
+
+		select {
+		case msg := <-errs:
+			assert.Equal(t, "rate limit exceeded", msg.Error)
+		case <-time.After(2 * time.Second):
+			t.Fatal("the third mark_read of the user was not rejected")
+		}
+
+		select {
+		case msg := <-errs:
+			t.Fatalf("unexpected error frame: %+v", msg)
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+}
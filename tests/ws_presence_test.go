@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/ws"
+	"github.com/stretchr/testify/assert"
+)
+
+type presenceEvent struct {
+	userID string
+	online bool
+}
+
+func TestPresenceDebouncer(t *testing.T) {
+	const delay = 50 * time.Millisecond
+
+	var mu sync.Mutex
+	var events []presenceEvent
+	debouncer := ws.NewPresenceDebouncer(delay, func(userID string, online bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, presenceEvent{userID, online})
+	})
+
+	announced := func() []presenceEvent {
+		time.Sleep(3 * delay)
+		mu.Lock()
+		defer mu.Unlock()
+		got := events
+		events = nil
+		return got
+	}
+
+	t.Run("Change Is Announced Once", func(t *testing.T) {
+		debouncer.Set("alice", true)
+		debouncer.Set("alice", true)
+		assert.Equal(t, []presenceEvent{{"alice", true}}, announced())
+	})
+
+	t.Run("Flapping Is Not", func(t *testing.T) {
+		debouncer.Set("alice", false)
+		debouncer.Set("alice", true)
+		debouncer.Set("alice", false)
+		debouncer.Set("alice", true)
+		assert.Empty(t, announced())
+	})
+
+	t.Run("Last State Wins", func(t *testing.T) {
+		debouncer.Set("bob", true)
+		debouncer.Set("bob", false)
+		debouncer.Set("bob", true)
+		debouncer.Set("alice", false)
+		assert.ElementsMatch(t, []presenceEvent{{"bob", true}, {"alice", false}}, announced())
+	})
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Adopten123/go-messenger/internal/config"
+	"github.com/Adopten123/go-messenger/internal/handler"
+	"github.com/Adopten123/go-messenger/internal/service"
+	"github.com/Adopten123/go-messenger/internal/ws"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenInQueryRejected(t *testing.T) {
+	userService := service.NewUserService(nil, secret_token)
+	userHandler := handler.NewUserHandler(userService, nil, nil)
+
+	protected := userHandler.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	token, err := userService.Keys().Sign(jwt.MapClaims{
+		"user_id": "user-1",
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	protected.ServeHTTP(w, httptest.NewRequest("GET", "/ws?token="+token, nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	protected.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTicketRedeem(t *testing.T) {
+	rdb := SetupTestRedis(t)
+	defer rdb.Close()
+	ctx := t.Context()
+
+	revocations := service.NewRevocationService(rdb, config.Auth{AccessTTL: 15 * time.Minute})
+	tickets := service.NewTicketService(rdb, revocations)
+
+	newClaims := func() service.AccessClaims {
+		issuedAt := time.Now().Add(-time.Second)
+		return service.AccessClaims{
+			UserID:    "user-" + rand.Text(),
+			SessionID: "session-" + rand.Text(),
+			TokenID:   rand.Text(),
+			IssuedAt:  issuedAt,
+			ExpiresAt: issuedAt.Add(15 * time.Minute),
+		}
+	}
+
+	t.Run("Single Use", func(t *testing.T) {
+		claims := newClaims()
+		ticket, err := tickets.Issue(ctx, claims)
+		require.NoError(t, err)
+
+		redeemed, err := tickets.Redeem(ctx, ticket)
+		require.NoError(t, err)
+		assert.Equal(t, claims.UserID, redeemed.UserID)
+		assert.Equal(t, claims.SessionID, redeemed.SessionID)
+
+		_, err = tickets.Redeem(ctx, ticket)
+		assert.ErrorIs(t, err, service.ErrInvalidTicket)
+	})
+
+	t.Run("Revoked Token", func(t *testing.T) {
+		revoke := map[string]func(claims service.AccessClaims) error{
+			"Token": func(claims service.AccessClaims) error {
+				return revocations.RevokeToken(ctx, claims)
+			},
+			"Session": func(claims service.AccessClaims) error {
+				return revocations.RevokeSession(ctx, claims.UserID, claims.SessionID)
+			},
+			"User": func(claims service.AccessClaims) error {
+				return revocations.RevokeUser(ctx, claims.UserID)
+			},
+		}
+
+		for name, fn := range revoke {
+			claims := newClaims()
+			ticket, err := tickets.Issue(ctx, claims)
+			require.NoError(t, err)
+			require.NoError(t, fn(claims))
+
+			_, err = tickets.Redeem(ctx, ticket)
+			assert.ErrorIs(t, err, service.ErrInvalidTicket, name)
+		}
+	})
+
+	t.Run("Rejected Upgrade", func(t *testing.T) {
+		wsHandler := ws.NewWSHandler(nil, tickets)
+		upgrade := func(ticket string) int {
+			w := httptest.NewRecorder()
+			wsHandler.HandleWS(w, httptest.NewRequest("GET", "/api/ws?ticket="+ticket, nil))
+			return w.Code
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, upgrade(""))
+		assert.Equal(t, http.StatusUnauthorized, upgrade("unknown"))
+
+		// aged past TicketTTL
+		expired, err := tickets.Issue(ctx, newClaims())
+		require.NoError(t, err)
+		require.NoError(t, rdb.PExpire(ctx, "ws_ticket:"+expired, time.Millisecond).Err())
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(t, http.StatusUnauthorized, upgrade(expired))
+
+		revoked := newClaims()
+		ticket, err := tickets.Issue(ctx, revoked)
+		require.NoError(t, err)
+		require.NoError(t, revocations.RevokeToken(ctx, revoked))
+		assert.Equal(t, http.StatusUnauthorized, upgrade(ticket))
+	})
+}